@@ -38,6 +38,7 @@ func main() {
 	mgr := matrix.NewManager(
 		slogger,
 		cfg.CryptoDBPath,
+		cfg.TimelineCacheLimit,
 	)
 
 	wsHub := ws.NewHub(slogger)
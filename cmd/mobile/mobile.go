@@ -46,7 +46,7 @@ func Start(dataDir string) (string, error) {
 		return "", fmt.Errorf("failed to create crypto db directory: %w", err)
 	}
 
-	mgr := matrix.NewManager(slogger, cryptoDBPath)
+	mgr := matrix.NewManager(slogger, cryptoDBPath, 0)
 	wsHub := ws.NewHub(slogger)
 	svc := service.New(mgr, wsHub, slogger)
 	h := handlers.New(wsHub, svc, slogger)
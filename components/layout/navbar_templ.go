@@ -242,7 +242,13 @@ func ServerNavbarActions() templ.Component {
 		}
 		templ_7745c5c3_Err = ui.IconGroup([]templ.Component{
 			ui.IconButton("fa-solid fa-bell text-[13px]", "default", templ.Attributes{}),
-			ui.IconButton("fa-solid fa-thumbtack text-[13px]", "default", templ.Attributes{}),
+			ui.IconButton("fa-solid fa-thumbtack text-[13px]", "default", templ.Attributes{
+				"title":     "Pinned messages",
+				"hx-get":    "/pins",
+				"hx-target": "#thread-panel",
+				"hx-swap":   "innerHTML",
+				"hx-vals":   "js:{roomID: document.getElementById('chat-container')?.dataset?.roomId || ''}",
+			}),
 			ui.IconButton("fa-solid fa-users text-[13px]", "default", templ.Attributes{}),
 		}, false, true).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
@@ -252,7 +258,13 @@ func ServerNavbarActions() templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = ui.SearchInputWithIcon("Search", "search", templ.Attributes{}).Render(ctx, templ_7745c5c3_Buffer)
+		templ_7745c5c3_Err = ui.SearchInputWithIcon("Search", "q", templ.Attributes{
+			"hx-get":     "/search",
+			"hx-trigger": "keyup[key=='Enter']",
+			"hx-target":  "#thread-panel",
+			"hx-swap":    "innerHTML",
+			"hx-vals":    "js:{room: document.getElementById('chat-container')?.dataset?.roomId || ''}",
+		}).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
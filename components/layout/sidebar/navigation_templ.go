@@ -178,7 +178,11 @@ func spaceModals(spaceDetail models.SpaceDetail, friends []models.User) templ.Co
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = ui.Modal("create-category-modal", "Create Category", ui.ModalSizeSmall, spaces.CreateCategory()).Render(ctx, templ_7745c5c3_Buffer)
+		templ_7745c5c3_Err = ui.Modal("create-category-modal", "Create Category", ui.ModalSizeSmall, spaces.CreateCategory(spaceDetail.ID)).Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = ui.Modal("leave-space-modal", "Leave Space", ui.ModalSizeSmall, spaces.LeaveSpaceLoader(spaceDetail.ID)).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -267,6 +271,7 @@ func spaceHeaderWithDropdown(spaceDetail models.SpaceDetail) templ.Component {
 			[]ui.DropdownItem{
 				{Label: "Invite People", Icon: "fa-solid fa-user-plus", Color: "primary", Action: "invite-modal"},
 				{Label: "Space Settings", Icon: "fa-solid fa-gear", Action: "space-settings-modal"},
+				{Label: "Create Category", Icon: "fa-solid fa-folder-plus", Action: "create-category-modal"},
 				{Separator: true},
 				{Label: "Leave Space", Icon: "fa-solid fa-arrow-right-from-bracket", Color: "danger", Action: "leave-space-modal"},
 			},
@@ -310,7 +315,7 @@ func spaceHeaderTrigger(spaceName string) templ.Component {
 		var templ_7745c5c3_Var7 string
 		templ_7745c5c3_Var7, templ_7745c5c3_Err = templ.JoinStringErrs(spaceName)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/layout/sidebar/navigation.templ`, Line: 105, Col: 14}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/layout/sidebar/navigation.templ`, Line: 107, Col: 14}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var7))
 		if templ_7745c5c3_Err != nil {
@@ -354,7 +359,7 @@ func sidebarContent(viewType string, data interface{}) templ.Component {
 			}
 		} else if viewType == "space" {
 			if spaceDetail, ok := data.(models.SpaceDetail); ok {
-				templ_7745c5c3_Err = ChannelsSection(spaceDetail.Channels).Render(ctx, templ_7745c5c3_Buffer)
+				templ_7745c5c3_Err = ChannelsSection(spaceDetail.Channels, spaceDetail.Categories).Render(ctx, templ_7745c5c3_Buffer)
 				if templ_7745c5c3_Err != nil {
 					return templ_7745c5c3_Err
 				}
@@ -8,6 +8,8 @@ package ui
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
+import "github.com/arko-chat/arko/internal/models"
+
 func MessageInput(placeholder string, name string, htmxAttrs templ.Attributes) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
@@ -29,7 +31,15 @@ func MessageInput(placeholder string, name string, htmxAttrs templ.Attributes) t
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div x-data=\"{shiftPressed: false}\" class=\"px-4 pb-4 pt-2 shrink-0\"><form")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div x-data=\"{shiftPressed: false, replyTo: null}\" @reply-to.window=\"replyTo = $event.detail; document.getElementById('textarea-messageinput')?.focus()\" class=\"px-4 pb-4 pt-2 shrink-0\"><template x-if=\"replyTo\"><div class=\"flex items-center gap-2 px-3 py-1.5 mb-1 rounded-md bg-surface-alt border border-border-divider text-xs text-content-muted\"><i class=\"fa-solid fa-reply fa-flip-horizontal text-[10px] shrink-0\"></i> <span class=\"shrink-0\">Replying to <span class=\"font-semibold text-content-secondary\" x-text=\"replyTo.author\"></span></span> <span class=\"truncate flex-1 text-content-faint\" x-text=\"replyTo.content\"></span>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = IconButton("fa-solid fa-xmark", "default", templ.Attributes{"type": "button", "title": "Cancel reply", "@click": "replyTo = null"}).Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "</div></template><form")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -37,7 +47,7 @@ func MessageInput(placeholder string, name string, htmxAttrs templ.Attributes) t
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, " class=\"w-full\" x-data=\"messageInput\" enctype=\"multipart/form-data\" @submit=\"onSubmit\" @keydown.shift=\"shiftPressed = true\" @keyup.shift=\"shiftPressed = false\"><input type=\"file\" name=\"attachments\" id=\"file-upload-input\" multiple class=\"hidden\" @change=\"onFilesSelected($event.target.files)\"><div id=\"message-input-body\" class=\"rounded-lg border border-border-divider bg-surface-input transition-colors focus-within:border-brand/40 focus-within:ring-1 focus-within:ring-brand/20 flex flex-col\" :class=\"dragOver ? 'border-brand/60 ring-1 ring-brand/30 bg-brand/5' : ''\"><div class=\"h-[--toolbar-h] flex items-center gap-0.5 px-2 border-b border-border-subtle shrink-0\" x-data=\"{\n\t\t\t\t\t\twrap(open, close = null) {\n\t\t\t\t\t\t\tconst ta = document.querySelector('#textarea-messageinput');\n\t\t\t\t\t\t\tif (!ta) return;\n\t\t\t\t\t\t\tconst s = ta.selectionStart, e = ta.selectionEnd;\n\t\t\t\t\t\t\tconst sel = ta.value.slice(s, e);\n\t\t\t\t\t\t\tconst cl = close ?? open;\n\t\t\t\t\t\t\tconst replacement = open + sel + cl;\n\t\t\t\t\t\t\tta.setRangeText(replacement, s, e, 'end');\n\t\t\t\t\t\t\tta.setSelectionRange(s + open.length, s + open.length + sel.length);\n\t\t\t\t\t\t\tta.focus();\n\t\t\t\t\t\t},\n\t\t\t\t\t\tcodeBlock() {\n\t\t\t\t\t\t\tconst ta = document.querySelector('#textarea-messageinput');\n\t\t\t\t\t\t\tif (!ta) return;\n\t\t\t\t\t\t\tconst s = ta.selectionStart, e = ta.selectionEnd;\n\t\t\t\t\t\t\tconst sel = ta.value.slice(s, e);\n\t\t\t\t\t\t\tconst open = '```\\n', close = '\\n```';\n\t\t\t\t\t\t\tconst replacement = open + sel + close;\n\t\t\t\t\t\t\tta.setRangeText(replacement, s, e, 'end');\n\t\t\t\t\t\t\tta.setSelectionRange(s + open.length, s + open.length + sel.length);\n\t\t\t\t\t\t\tta.focus();\n\t\t\t\t\t\t},\n\t\t\t\t\t\tline(prefix) {\n\t\t\t\t\t\t\tconst ta = document.querySelector('#textarea-messageinput');\n\t\t\t\t\t\t\tif (!ta) return;\n\t\t\t\t\t\t\tconst s = ta.selectionStart;\n\t\t\t\t\t\t\tconst lineStart = ta.value.lastIndexOf('\\n', s - 1) + 1;\n\t\t\t\t\t\t\tconst lineEnd = ta.value.indexOf('\\n', s);\n\t\t\t\t\t\t\tconst end = lineEnd === -1 ? ta.value.length : lineEnd;\n\t\t\t\t\t\t\tconst sel = ta.value.slice(lineStart, end);\n\t\t\t\t\t\t\tconst replacement = prefix + sel;\n\t\t\t\t\t\t\tta.setRangeText(replacement, lineStart, end, 'end');\n\t\t\t\t\t\t\tta.focus();\n\t\t\t\t\t\t}\n\t\t\t\t\t}\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, " class=\"w-full\" x-data=\"messageInput\" enctype=\"multipart/form-data\" @submit=\"onSubmit\" @htmx:ws-after-send.camel=\"replyTo = null\" @keydown.shift=\"shiftPressed = true\" @keyup.shift=\"shiftPressed = false\" @keydown.escape=\"replyTo = null\"><input type=\"hidden\" name=\"replyTo\" :value=\"replyTo ? replyTo.eventID : ''\"> <input type=\"file\" name=\"attachments\" id=\"file-upload-input\" multiple class=\"hidden\" @change=\"onFilesSelected($event.target.files)\"><div id=\"message-input-body\" @keydown.capture=\"onMentionKeydown($event)\" class=\"relative rounded-lg border border-border-divider bg-surface-input transition-colors focus-within:border-brand/40 focus-within:ring-1 focus-within:ring-brand/20 flex flex-col\" :class=\"dragOver ? 'border-brand/60 ring-1 ring-brand/30 bg-brand/5' : ''\"><div class=\"h-[--toolbar-h] flex items-center gap-0.5 px-2 border-b border-border-subtle shrink-0\" x-data=\"{\n\t\t\t\t\t\twrap(open, close = null) {\n\t\t\t\t\t\t\tconst ta = document.querySelector('#textarea-messageinput');\n\t\t\t\t\t\t\tif (!ta) return;\n\t\t\t\t\t\t\tconst s = ta.selectionStart, e = ta.selectionEnd;\n\t\t\t\t\t\t\tconst sel = ta.value.slice(s, e);\n\t\t\t\t\t\t\tconst cl = close ?? open;\n\t\t\t\t\t\t\tconst replacement = open + sel + cl;\n\t\t\t\t\t\t\tta.setRangeText(replacement, s, e, 'end');\n\t\t\t\t\t\t\tta.setSelectionRange(s + open.length, s + open.length + sel.length);\n\t\t\t\t\t\t\tta.focus();\n\t\t\t\t\t\t},\n\t\t\t\t\t\tcodeBlock() {\n\t\t\t\t\t\t\tconst ta = document.querySelector('#textarea-messageinput');\n\t\t\t\t\t\t\tif (!ta) return;\n\t\t\t\t\t\t\tconst s = ta.selectionStart, e = ta.selectionEnd;\n\t\t\t\t\t\t\tconst sel = ta.value.slice(s, e);\n\t\t\t\t\t\t\tconst open = '```\\n', close = '\\n```';\n\t\t\t\t\t\t\tconst replacement = open + sel + close;\n\t\t\t\t\t\t\tta.setRangeText(replacement, s, e, 'end');\n\t\t\t\t\t\t\tta.setSelectionRange(s + open.length, s + open.length + sel.length);\n\t\t\t\t\t\t\tta.focus();\n\t\t\t\t\t\t},\n\t\t\t\t\t\tline(prefix) {\n\t\t\t\t\t\t\tconst ta = document.querySelector('#textarea-messageinput');\n\t\t\t\t\t\t\tif (!ta) return;\n\t\t\t\t\t\t\tconst s = ta.selectionStart;\n\t\t\t\t\t\t\tconst lineStart = ta.value.lastIndexOf('\\n', s - 1) + 1;\n\t\t\t\t\t\t\tconst lineEnd = ta.value.indexOf('\\n', s);\n\t\t\t\t\t\t\tconst end = lineEnd === -1 ? ta.value.length : lineEnd;\n\t\t\t\t\t\t\tconst sel = ta.value.slice(lineStart, end);\n\t\t\t\t\t\t\tconst replacement = prefix + sel;\n\t\t\t\t\t\t\tta.setRangeText(replacement, lineStart, end, 'end');\n\t\t\t\t\t\t\tta.focus();\n\t\t\t\t\t\t}\n\t\t\t\t\t}\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -53,7 +63,7 @@ func MessageInput(placeholder string, name string, htmxAttrs templ.Attributes) t
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "<div class=\"w-px h-3.5 bg-border-divider mx-1\"></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<div class=\"w-px h-3.5 bg-border-divider mx-1\"></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -69,7 +79,7 @@ func MessageInput(placeholder string, name string, htmxAttrs templ.Attributes) t
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<div class=\"w-px h-3.5 bg-border-divider mx-1\"></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "<div class=\"w-px h-3.5 bg-border-divider mx-1\"></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -85,7 +95,7 @@ func MessageInput(placeholder string, name string, htmxAttrs templ.Attributes) t
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "<div class=\"flex-1\"></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "<div class=\"flex-1\"></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -97,15 +107,37 @@ func MessageInput(placeholder string, name string, htmxAttrs templ.Attributes) t
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = IconButton("fa-solid fa-at", "default", templ.Attributes{"type": "button", "title": "Mention"}).Render(ctx, templ_7745c5c3_Buffer)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "<div class=\"relative\" x-data=\"{ open: false }\" @click.outside=\"open = false\" @close-sticker-picker.window=\"open = false\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = IconButton("fa-solid fa-note-sticky", "default", templ.Attributes{
+			"type":      "button",
+			"title":     "Stickers",
+			"@click":    "open = !open",
+			"hx-get":    "/stickers",
+			"hx-vals":   "js:{roomID: document.getElementById('chat-container')?.dataset?.roomId || ''}",
+			"hx-target": "#sticker-picker",
+			"hx-swap":   "innerHTML",
+		}).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "</div><template x-if=\"pendingFiles.length > 0\"><div data-preview-bar class=\"flex flex-wrap gap-2 px-3 py-2 border-b border-border-subtle shrink-0\"><template x-for=\"(file, index) in pendingFiles\" :key=\"index\"><div class=\"relative group/preview\"><template x-if=\"file.isImage\"><div class=\"relative w-16 h-16 rounded-md overflow-hidden border border-border-divider bg-surface-sunken shrink-0\"><img :src=\"file.previewURL\" class=\"w-full h-full object-cover\"><div class=\"absolute inset-0 bg-black/40 opacity-0 group-hover/preview:opacity-100 transition-opacity flex items-center justify-center\"><span class=\"text-white text-[10px] font-medium text-center leading-tight truncate w-full px-1\" x-text=\"file.name\"></span></div></div></template><template x-if=\"!file.isImage\"><div class=\"flex items-center gap-2 px-2.5 py-1.5 rounded-md border border-border-divider bg-surface-sunken max-w-[160px]\"><i class=\"fa-solid fa-file text-[11px] text-content-muted shrink-0\"></i><div class=\"min-w-0\"><p class=\"text-[11px] font-medium text-content-primary truncate\" x-text=\"file.name\"></p><p class=\"text-[10px] text-content-muted\" x-text=\"file.sizeLabel\"></p></div></div></template><button type=\"button\" class=\"absolute -top-1.5 -right-1.5 w-4 h-4 rounded-full bg-surface-raised border border-border-divider text-content-muted hover:text-danger hover:border-danger/50 flex items-center justify-center transition-colors z-10\" @click=\"removeFile(index)\"><i class=\"fa-solid fa-xmark text-[8px]\"></i></button></div></template></div></template>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "<div id=\"sticker-picker\" x-show=\"open\" x-cloak class=\"absolute bottom-full right-0 mb-2 z-50\"></div></div>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = IconButton("fa-solid fa-at", "default", templ.Attributes{"type": "button", "title": "Mention", "@click": "startMention()"}).Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, "</div><template x-if=\"pendingFiles.length > 0\"><div data-preview-bar class=\"flex flex-wrap gap-2 px-3 py-2 border-b border-border-subtle shrink-0\"><template x-for=\"(file, index) in pendingFiles\" :key=\"index\"><div class=\"relative group/preview\"><template x-if=\"file.isImage\"><div class=\"relative w-16 h-16 rounded-md overflow-hidden border border-border-divider bg-surface-sunken shrink-0\"><img :src=\"file.previewURL\" class=\"w-full h-full object-cover\"><div class=\"absolute inset-0 bg-black/40 opacity-0 group-hover/preview:opacity-100 transition-opacity flex items-center justify-center\"><span class=\"text-white text-[10px] font-medium text-center leading-tight truncate w-full px-1\" x-text=\"file.name\"></span></div></div></template><template x-if=\"!file.isImage\"><div class=\"flex items-center gap-2 px-2.5 py-1.5 rounded-md border border-border-divider bg-surface-sunken max-w-[160px]\"><i class=\"fa-solid fa-file text-[11px] text-content-muted shrink-0\"></i><div class=\"min-w-0\"><p class=\"text-[11px] font-medium text-content-primary truncate\" x-text=\"file.name\"></p><p class=\"text-[10px] text-content-muted\" x-text=\"file.sizeLabel\"></p></div></div></template><button type=\"button\" class=\"absolute -top-1.5 -right-1.5 w-4 h-4 rounded-full bg-surface-raised border border-border-divider text-content-muted hover:text-danger hover:border-danger/50 flex items-center justify-center transition-colors z-10\" @click=\"removeFile(index)\"><i class=\"fa-solid fa-xmark text-[8px]\"></i></button></div></template></div></template><div id=\"mention-suggestions\" class=\"absolute bottom-full left-0 mb-2 z-50 empty:hidden\" @click.outside=\"closeMentions()\"></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		templ_7745c5c3_Err = MessageTextarea(placeholder, "", templ.Attributes{
+			"@keyup":       "onMentionInput($event)",
+			"@click":       "onMentionInput($event)",
 			"id":           "textarea-messageinput",
 			"name":         name,
 			"autocomplete": "off",
@@ -117,20 +149,20 @@ func MessageInput(placeholder string, name string, htmxAttrs templ.Attributes) t
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "</div><div class=\"flex items-center justify-between mt-1.5 px-0.5\"><span class=\"text-[10px] text-content-faint\"><kbd class=\"font-mono\">Enter</kbd> to send · <kbd class=\"font-mono\">Shift+Enter</kbd> ")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 10, "</div><div class=\"flex items-center justify-between mt-1.5 px-0.5\"><span class=\"text-[10px] text-content-faint\"><kbd class=\"font-mono\">Enter</kbd> to send · <kbd class=\"font-mono\">Shift+Enter</kbd> ")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		var templ_7745c5c3_Var2 string
 		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs("for")
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/ui/message_input.templ`, Line: 132, Col: 99}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/ui/message_input.templ`, Line: 171, Col: 99}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, " new line</span>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 11, " new line</span>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -141,7 +173,55 @@ func MessageInput(placeholder string, name string, htmxAttrs templ.Attributes) t
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, "</div></form></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 12, "</div></form></div>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		return nil
+	})
+}
+
+func ThreadInput(placeholder string, htmxAttrs templ.Attributes) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var3 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var3 == nil {
+			templ_7745c5c3_Var3 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 13, "<div x-data=\"{shiftPressed: false}\" class=\"px-4 pb-4 pt-2 shrink-0 border-t border-border-divider\"><form")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templ.RenderAttributes(ctx, templ_7745c5c3_Buffer, htmxAttrs)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 14, " class=\"w-full\" @keydown.shift=\"shiftPressed = true\" @keyup.shift=\"shiftPressed = false\"><div class=\"rounded-lg border border-border-divider bg-surface-input transition-colors focus-within:border-brand/40 focus-within:ring-1 focus-within:ring-brand/20\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = MessageTextarea(placeholder, "", templ.Attributes{
+			"name":         "message",
+			"autocomplete": "off",
+		}).Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 15, "</div></form></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -149,4 +229,116 @@ func MessageInput(placeholder string, name string, htmxAttrs templ.Attributes) t
 	})
 }
 
+func MentionSuggestions(users []models.User, showRoom bool) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var4 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var4 == nil {
+			templ_7745c5c3_Var4 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		if len(users) > 0 || showRoom {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 16, "<div class=\"w-64 py-1 bg-surface-float border border-border-subtle rounded-lg shadow-lg\">")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			for _, u := range users {
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 17, "<button type=\"button\" data-mention=\"")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				var templ_7745c5c3_Var5 string
+				templ_7745c5c3_Var5, templ_7745c5c3_Err = templ.JoinStringErrs(u.ID)
+				if templ_7745c5c3_Err != nil {
+					return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/ui/message_input.templ`, Line: 209, Col: 24}
+				}
+				_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var5))
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 18, "\" class=\"w-full flex items-center gap-2 px-2.5 py-1.5 text-left hover:bg-hover-primary transition-colors\" @mousedown.prevent=\"insertMention($el.dataset.mention)\"><img src=\"")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				var templ_7745c5c3_Var6 string
+				templ_7745c5c3_Var6, templ_7745c5c3_Err = templ.JoinStringErrs(u.Avatar)
+				if templ_7745c5c3_Err != nil {
+					return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/ui/message_input.templ`, Line: 213, Col: 24}
+				}
+				_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var6))
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 19, "\" alt=\"\" class=\"w-5 h-5 rounded-full shrink-0\"> <span class=\"text-xs font-medium text-content-primary truncate\">")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				var templ_7745c5c3_Var7 string
+				templ_7745c5c3_Var7, templ_7745c5c3_Err = templ.JoinStringErrs(u.Name)
+				if templ_7745c5c3_Err != nil {
+					return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/ui/message_input.templ`, Line: 214, Col: 77}
+				}
+				_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var7))
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 20, "</span> <span class=\"text-[10px] text-content-faint truncate\">")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				var templ_7745c5c3_Var8 string
+				templ_7745c5c3_Var8, templ_7745c5c3_Err = templ.JoinStringErrs(u.ID)
+				if templ_7745c5c3_Err != nil {
+					return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/ui/message_input.templ`, Line: 215, Col: 65}
+				}
+				_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var8))
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 21, "</span></button> ")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+			}
+			if showRoom {
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 22, "<button type=\"button\" data-mention=\"@room\" class=\"w-full flex items-center gap-2 px-2.5 py-1.5 text-left hover:bg-hover-primary transition-colors\" @mousedown.prevent=\"insertMention($el.dataset.mention)\"><i class=\"fa-solid fa-bullhorn w-5 text-center text-[11px] text-content-muted shrink-0\"></i> <span class=\"text-xs font-medium text-content-primary\">")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				var templ_7745c5c3_Var9 string
+				templ_7745c5c3_Var9, templ_7745c5c3_Err = templ.JoinStringErrs("@room")
+				if templ_7745c5c3_Err != nil {
+					return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/ui/message_input.templ`, Line: 226, Col: 69}
+				}
+				_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var9))
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 23, "</span> <span class=\"text-[10px] text-content-faint truncate\">Notify everyone in this room</span></button>")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 24, "</div>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		return nil
+	})
+}
+
 var _ = templruntime.GeneratedTemplate
@@ -23,14 +23,27 @@ interface FileEntry {
 
 interface MessageInputData {
   pendingFiles: FileEntry[];
+  mentionQuery: string | null;
+  mentionStart: number;
   onFilesSelected(fileList: FileList | File[]): void;
   removeFile(index: number): void;
   onSubmit(e: SubmitEvent): void;
+  startMention(): void;
+  onMentionInput(e: Event): void;
+  onMentionKeydown(e: KeyboardEvent): void;
+  insertMention(userID: string): void;
+  closeMentions(): void;
+}
+
+function messageTextarea(): HTMLTextAreaElement | null {
+  return document.getElementById("textarea-messageinput") as HTMLTextAreaElement | null;
 }
 
 function messageInput(): MessageInputData {
   return {
     pendingFiles: [],
+    mentionQuery: null,
+    mentionStart: 0,
 
     onFilesSelected(fileList: FileList | File[]) {
       for (const file of Array.from(fileList)) {
@@ -44,25 +57,95 @@ function messageInput(): MessageInputData {
       this.pendingFiles.splice(index, 1);
     },
 
-    onSubmit(e: SubmitEvent) {
-      console.log("i am submitting")
+    onSubmit(_e: SubmitEvent) {
       if (this.pendingFiles.length === 0) return;
-      const form = e.target as HTMLFormElement;
-      const fd = new FormData(form);
-      for (const entry of this.pendingFiles) {
-        fd.append("attachments", entry.file, entry.name);
+      const roomID = document.getElementById("chat-container")?.dataset?.roomId;
+      if (!roomID) return;
+
+      const entries = this.pendingFiles;
+      this.pendingFiles = [];
+
+      for (const entry of entries) {
+        const fd = new FormData();
+        fd.append("file", entry.file, entry.name);
+        fetch(`/rooms/${roomID}/upload`, {
+          method: "POST",
+          body: fd,
+        })
+          .then(async (resp) => {
+            if (!resp.ok) {
+              console.error("upload failed", entry.name, await resp.text());
+            }
+          })
+          .finally(() => {
+            if (entry.previewURL) URL.revokeObjectURL(entry.previewURL);
+          });
       }
-      fetch(form.action || window.location.pathname, {
-        method: "POST",
-        body: fd,
-      }).then(() => {
-        for (const entry of this.pendingFiles) {
-          if (entry.previewURL) URL.revokeObjectURL(entry.previewURL);
-        }
-        this.pendingFiles = [];
-        form.reset();
+    },
+
+    startMention() {
+      const ta = messageTextarea();
+      if (!ta) return;
+      const prefix = ta.selectionStart > 0 && !/\s/.test(ta.value[ta.selectionStart - 1]) ? " @" : "@";
+      ta.setRangeText(prefix, ta.selectionStart, ta.selectionEnd, "end");
+      ta.focus();
+      this.onMentionInput({ target: ta } as unknown as Event);
+    },
+
+    onMentionInput(e: Event) {
+      const ta = e.target as HTMLTextAreaElement;
+      const before = ta.value.slice(0, ta.selectionStart);
+      const match = /(^|\s)@([^\s@]*)$/.exec(before);
+      if (!match) {
+        this.closeMentions();
+        return;
+      }
+
+      const query = match[2];
+      if (query === this.mentionQuery) return;
+      this.mentionQuery = query;
+      this.mentionStart = ta.selectionStart - query.length - 1;
+
+      const roomID = document.getElementById("chat-container")?.dataset?.roomId;
+      if (!roomID) return;
+      htmx.ajax("GET", `/rooms/${roomID}/mentions`, {
+        target: "#mention-suggestions",
+        swap: "innerHTML",
+        values: { q: query },
       });
     },
+
+    onMentionKeydown(e: KeyboardEvent) {
+      if (this.mentionQuery === null) return;
+
+      if (e.key === "Escape") {
+        e.stopPropagation();
+        this.closeMentions();
+        return;
+      }
+
+      if (e.key !== "Enter" && e.key !== "Tab") return;
+      const first = document.querySelector<HTMLElement>("#mention-suggestions [data-mention]");
+      if (!first?.dataset.mention) return;
+
+      e.preventDefault();
+      e.stopPropagation();
+      this.insertMention(first.dataset.mention);
+    },
+
+    insertMention(userID: string) {
+      const ta = messageTextarea();
+      if (!ta) return;
+      ta.setRangeText(`${userID} `, this.mentionStart, ta.selectionStart, "end");
+      ta.focus();
+      this.closeMentions();
+    },
+
+    closeMentions() {
+      this.mentionQuery = null;
+      const el = document.getElementById("mention-suggestions");
+      if (el) el.innerHTML = "";
+    },
   };
 }
 
@@ -128,11 +211,78 @@ function chatDrop(): ChatDropData {
   };
 }
 
+interface WidgetRequest {
+  api: string;
+  widgetId: string;
+  requestId: string;
+  action: string;
+  data?: { content?: unknown };
+}
+
+// stickerWidget speaks just enough of the widget API for sticker pickers
+// to hand us the sticker they want to send.
+function stickerWidget() {
+  return {
+    onMessage: null as ((e: MessageEvent) => void) | null,
+
+    init() {
+      const frame = (this as unknown as { $el: HTMLIFrameElement }).$el;
+      const widgetId = frame.dataset.widgetId ?? "";
+      const roomID = frame.dataset.roomId ?? "";
+      const origin = new URL(frame.src).origin;
+
+      this.onMessage = (e: MessageEvent) => {
+        if (e.source !== frame.contentWindow || e.origin !== origin) return;
+        const req = e.data as WidgetRequest;
+        if (req?.api !== "fromWidget" || req.widgetId !== widgetId) return;
+
+        let response: unknown = {};
+        switch (req.action) {
+          case "supported_api_versions":
+            response = { supported_versions: ["0.0.1", "0.0.2"] };
+            break;
+          case "m.sticker":
+            if (req.data?.content) {
+              fetch(`/rooms/${roomID}/sticker`, {
+                method: "POST",
+                body: new URLSearchParams({
+                  content: JSON.stringify(req.data.content),
+                }),
+              });
+              window.dispatchEvent(new CustomEvent("close-sticker-picker"));
+            }
+            break;
+        }
+        frame.contentWindow?.postMessage({ ...req, response }, origin);
+      };
+      window.addEventListener("message", this.onMessage);
+
+      frame.addEventListener("load", () => {
+        frame.contentWindow?.postMessage(
+          {
+            api: "toWidget",
+            widgetId,
+            requestId: `capabilities-${Date.now()}`,
+            action: "capabilities",
+            data: {},
+          },
+          origin
+        );
+      });
+    },
+
+    destroy() {
+      if (this.onMessage) window.removeEventListener("message", this.onMessage);
+    },
+  };
+}
+
 document.addEventListener("alpine:init", () => {
   console.log("Alpine.js initialized");
 
   Alpine.data("messageInput", messageInput);
   Alpine.data("chatDrop", chatDrop);
+  Alpine.data("stickerWidget", stickerWidget);
 });
 
 Alpine.start();
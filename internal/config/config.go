@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
 const (
@@ -14,6 +15,9 @@ const (
 
 type Config struct {
 	CryptoDBPath string `json:"crypto_db_path"`
+	// TimelineCacheLimit is how many messages per room are kept on disk.
+	// Zero uses the default and a negative value disables the cache.
+	TimelineCacheLimit int `json:"timeline_cache_limit,omitempty"`
 }
 
 func Load() (*Config, error) {
@@ -49,4 +53,9 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("CRYPTO_DB_PATH"); v != "" {
 		cfg.CryptoDBPath = v
 	}
+	if v := os.Getenv("TIMELINE_CACHE_LIMIT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.TimelineCacheLimit = n
+		}
+	}
 }
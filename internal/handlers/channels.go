@@ -46,6 +46,17 @@ func (h *Handler) HandleChannels(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	focusID := ""
+	if eventID := r.URL.Query().Get("event"); eventID != "" {
+		focusID, err = h.svc.Chat.JumpToEvent(channelID, eventID)
+		if err != nil {
+			h.logger.Warn("failed to jump to event", "eventID", eventID, "err", err)
+		}
+	} else if err := h.svc.Chat.ReturnToPresent(channelID); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
 	h.svc.Chat.SubscribeTyping(channelID)
 
 	typingUsers := h.svc.Chat.GetTypingUsers(channelID)
@@ -61,6 +72,7 @@ func (h *Handler) HandleChannels(w http.ResponseWriter, r *http.Request) {
 		Tree:        tree,
 		RoomID:      ch.ID,
 		TypingUsers: typingUsers,
+		FocusID:     focusID,
 	}
 
 	h.svc.WebView.SetTitle(fmt.Sprintf("#%s", ch.Name))
@@ -60,8 +60,9 @@ func (h *Handler) HandleCreateChannel(w http.ResponseWriter, r *http.Request) {
 
 	topic := r.FormValue("topic")
 	public := r.FormValue("public") == "true"
+	categoryID := r.FormValue("category")
 
-	channel, err := h.svc.Spaces.CreateChannel(spaceID, name, topic, public)
+	channel, err := h.svc.Spaces.CreateChannel(spaceID, categoryID, name, topic, public)
 	if err != nil {
 		h.serverError(w, r, err)
 		return
@@ -69,3 +70,28 @@ func (h *Handler) HandleCreateChannel(w http.ResponseWriter, r *http.Request) {
 
 	h.htmxRedirect(w, "/spaces/"+spaceID+"/channels/"+channel.ID)
 }
+
+func (h *Handler) HandleCreateCategory(w http.ResponseWriter, r *http.Request) {
+	spaceID := chi.URLParam(r, "spaceID")
+
+	if err := r.ParseForm(); err != nil {
+		h.clientError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = ui.Alert("Category name is required").Render(r.Context(), w)
+		return
+	}
+
+	public := r.FormValue("private") != "true"
+
+	if _, err := h.svc.Spaces.CreateCategory(spaceID, name, public); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	h.htmxRedirect(w, "/spaces/"+spaceID)
+}
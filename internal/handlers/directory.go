@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/arko-chat/arko/components/ui"
+	"github.com/arko-chat/arko/internal/matrix"
+)
+
+func (h *Handler) HandleDirectory(w http.ResponseWriter, r *http.Request) {
+	server := strings.TrimSpace(r.FormValue("server"))
+	query := strings.TrimSpace(r.FormValue("q"))
+
+	page, err := h.svc.Spaces.SearchDirectory(server, query, r.FormValue("since"))
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	if err := ui.DirectoryResults(page).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleJoin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.clientError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	var via []string
+	if server := r.FormValue("via"); server != "" {
+		via = []string{server}
+	}
+
+	roomID, isSpace, err := h.svc.Spaces.JoinRoom(r.FormValue("target"), via)
+	if errors.Is(err, matrix.ErrInvalidJoinTarget) {
+		h.clientError(w, r, http.StatusBadRequest, "That isn't a room address or link.")
+		return
+	}
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	if isSpace {
+		h.htmxRedirect(w, "/spaces/"+roomID)
+		return
+	}
+
+	path, err := h.svc.Chat.RoomPath(roomID)
+	if err != nil {
+		path = "/"
+	}
+	h.htmxRedirect(w, path)
+}
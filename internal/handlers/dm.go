@@ -45,6 +45,17 @@ func (h *Handler) HandleDM(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	focusID := ""
+	if eventID := r.URL.Query().Get("event"); eventID != "" {
+		focusID, err = h.svc.Chat.JumpToEvent(roomID, eventID)
+		if err != nil {
+			h.logger.Warn("failed to jump to event", "eventID", eventID, "err", err)
+		}
+	} else if err := h.svc.Chat.ReturnToPresent(roomID); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
 	h.svc.Chat.SubscribeTyping(roomID)
 
 	typingUsers := h.svc.Chat.GetTypingUsers(roomID)
@@ -57,6 +68,7 @@ func (h *Handler) HandleDM(w http.ResponseWriter, r *http.Request) {
 		Tree:        tree,
 		RoomID:      roomID,
 		TypingUsers: typingUsers,
+		FocusID:     focusID,
 	}
 
 	h.svc.WebView.SetTitle(friend.Name)
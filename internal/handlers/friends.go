@@ -9,8 +9,10 @@ import (
 	"github.com/arko-chat/arko/components/layout/sidebar"
 	friendmodal "github.com/arko-chat/arko/components/modals/friends"
 	"github.com/arko-chat/arko/internal/htmx"
+	"github.com/arko-chat/arko/internal/models"
 	dmpage "github.com/arko-chat/arko/pages/dm"
 	friendspage "github.com/arko-chat/arko/pages/friends"
+	"github.com/go-chi/chi/v5"
 )
 
 func (h *Handler) HandleFriends(w http.ResponseWriter, r *http.Request) {
@@ -66,13 +68,22 @@ func (h *Handler) HandleFriendsFilter(
 		filter = "online"
 	}
 
-	_, err := h.svc.Friends.FilterFriends(filter)
+	users, err := h.svc.Friends.FilterFriends(filter)
 	if err != nil {
 		h.serverError(w, r, err)
 		return
 	}
 
-	if err := friends.View(filter).Render(r.Context(), w); err != nil {
+	var invites []models.Invite
+	if filter == "pending" {
+		invites, err = h.svc.Friends.ListInvites()
+		if err != nil {
+			h.serverError(w, r, err)
+			return
+		}
+	}
+
+	if err := friends.View(filter, users, invites).Render(r.Context(), w); err != nil {
 		h.serverError(w, r, err)
 	}
 }
@@ -186,3 +197,25 @@ func (h *Handler) HandleCreateDM(w http.ResponseWriter, r *http.Request) {
 		h.serverError(w, r, err)
 	}
 }
+
+func (h *Handler) HandleBlockUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+
+	if err := h.svc.Friends.BlockUser(userID); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUnblockUser answers with an empty body, which removes the user's
+// row from the blocked list.
+func (h *Handler) HandleUnblockUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+
+	if err := h.svc.Friends.UnblockUser(userID); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+}
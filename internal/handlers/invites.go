@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/arko-chat/arko/components/ui"
+	"github.com/arko-chat/arko/internal/matrix"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) HandleSpaceInvites(w http.ResponseWriter, r *http.Request) {
+	invites, err := h.svc.Friends.ListInvites()
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	if err := ui.SpaceInvites(invites).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleAcceptInvite(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+
+	invite, err := h.svc.Friends.AcceptInvite(roomID)
+	if errors.Is(err, matrix.ErrNotInvited) {
+		h.clientError(w, r, http.StatusNotFound, "This invite is no longer pending.")
+		return
+	}
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	switch {
+	case invite.IsDirect:
+		h.htmxRedirect(w, "/dm/"+invite.Inviter.ID)
+	case invite.IsSpace:
+		h.htmxRedirect(w, "/spaces/"+roomID)
+	default:
+		path, err := h.svc.Chat.RoomPath(roomID)
+		if err != nil {
+			path = "/"
+		}
+		h.htmxRedirect(w, path)
+	}
+}
+
+func (h *Handler) HandleDeclineInvite(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+
+	err := h.svc.Friends.DeclineInvite(roomID)
+	if errors.Is(err, matrix.ErrNotInvited) {
+		h.clientError(w, r, http.StatusNotFound, "This invite is no longer pending.")
+		return
+	}
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,8 +3,11 @@ package handlers
 import (
 	"errors"
 	"io"
+	"mime"
 	"net/http"
 	"strings"
+
+	"github.com/arko-chat/arko/internal/matrix"
 )
 
 type MediaResponse struct {
@@ -17,13 +20,53 @@ const MaxCacheableMediaSize = 3 * 1024 * 1024
 
 var errMediaTooLarge = errors.New("media too large for cache")
 
+// inlineMediaTypes are the only content types rendered inline. The type of an
+// encrypted file comes from the sender, so anything else is forced to a
+// download to keep it from running in the webview origin.
+var inlineMediaTypes = map[string]struct{}{
+	"image/png":       {},
+	"image/jpeg":      {},
+	"image/gif":       {},
+	"image/webp":      {},
+	"image/avif":      {},
+	"video/mp4":       {},
+	"video/webm":      {},
+	"video/ogg":       {},
+	"video/quicktime": {},
+	"audio/mpeg":      {},
+	"audio/mp4":       {},
+	"audio/ogg":       {},
+	"audio/webm":      {},
+	"audio/wav":       {},
+	"audio/x-wav":     {},
+	"audio/flac":      {},
+	"audio/aac":       {},
+}
+
+func setMediaHeaders(w http.ResponseWriter, contentType string) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if _, ok := inlineMediaTypes[mediaType]; err == nil && ok {
+		w.Header().Set("Content-Type", mediaType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+}
+
 func (h *Handler) HandleProxyMedia(w http.ResponseWriter, r *http.Request) {
 	sess := h.session(r)
 	if sess == nil {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	h.proxyMedia(w, r, sess.Homeserver, sess.AccessToken, h.svc.Chat.EncryptedMedia)
+}
 
+// proxyMedia serves a file from the homeserver, decrypting it with the keys
+// lookup finds for the ref param if it has one.
+func (h *Handler) proxyMedia(w http.ResponseWriter, r *http.Request, hs, token string, lookup func(ref string) (*matrix.EncryptedMedia, bool)) {
 	mediaPath := r.URL.Query().Get("path")
 	if mediaPath == "" {
 		http.Error(w, "missing path param", http.StatusBadRequest)
@@ -35,15 +78,30 @@ func (h *Handler) HandleProxyMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var encrypted *matrix.EncryptedMedia
+	if ref := r.URL.Query().Get("ref"); ref != "" {
+		m, ok := lookup(ref)
+		if !ok || m.Path != mediaPath {
+			http.Error(w, "unknown media", http.StatusNotFound)
+			return
+		}
+		encrypted = m
+	}
+
+	cacheKey := "hpm:" + mediaPath
+	if encrypted != nil {
+		cacheKey = "hpme:" + r.URL.Query().Get("ref") + ":" + mediaPath
+	}
+
 	media, err := h.mediaCache.Get(
-		"hpm:"+mediaPath,
+		cacheKey,
 		func() (MediaResponse, error) {
-			mediaURL := strings.TrimRight(sess.Homeserver, "/") + mediaPath
+			mediaURL := strings.TrimRight(hs, "/") + mediaPath
 			req, err := http.NewRequestWithContext(r.Context(), "GET", mediaURL, nil)
 			if err != nil {
 				return MediaResponse{}, err
 			}
-			req.Header.Set("Authorization", "Bearer "+sess.AccessToken)
+			req.Header.Set("Authorization", "Bearer "+token)
 
 			resp, err := http.DefaultClient.Do(req)
 			if err != nil {
@@ -65,8 +123,16 @@ func (h *Handler) HandleProxyMedia(w http.ResponseWriter, r *http.Request) {
 				return MediaResponse{}, errMediaTooLarge
 			}
 
+			contentType := resp.Header.Get("Content-Type")
+			if encrypted != nil && resp.StatusCode == http.StatusOK {
+				if err := encrypted.Decrypt(body); err != nil {
+					return MediaResponse{}, err
+				}
+				contentType = encrypted.MimeType
+			}
+
 			return MediaResponse{
-				ContentType: resp.Header.Get("Content-Type"),
+				ContentType: contentType,
 				Body:        body,
 				StatusCode:  resp.StatusCode,
 			}, nil
@@ -75,20 +141,27 @@ func (h *Handler) HandleProxyMedia(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		if errors.Is(err, errMediaTooLarge) {
-			h.proxyLargeMedia(w, r, sess.Homeserver, sess.AccessToken, mediaPath)
+			h.proxyLargeMedia(w, r, hs, token, mediaPath, encrypted)
 			return
 		}
+		if errors.Is(err, matrix.ErrMediaHashMismatch) {
+			h.logger.Warn("refusing to serve tampered media", "path", mediaPath)
+		}
 		http.Error(w, "upstream error", http.StatusBadGateway)
 		return
 	}
 
-	w.Header().Set("Content-Type", media.ContentType)
-	w.Header().Set("Cache-Control", "public, max-age=86400")
+	setMediaHeaders(w, media.ContentType)
+	if encrypted != nil {
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
 	w.WriteHeader(media.StatusCode)
 	w.Write(media.Body)
 }
 
-func (h *Handler) proxyLargeMedia(w http.ResponseWriter, r *http.Request, hs, token, path string) {
+func (h *Handler) proxyLargeMedia(w http.ResponseWriter, r *http.Request, hs, token, path string, encrypted *matrix.EncryptedMedia) {
 	mediaURL := strings.TrimRight(hs, "/") + path
 	req, _ := http.NewRequestWithContext(r.Context(), "GET", mediaURL, nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -100,7 +173,17 @@ func (h *Handler) proxyLargeMedia(w http.ResponseWriter, r *http.Request, hs, to
 	}
 	defer resp.Body.Close()
 
-	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	if encrypted == nil || resp.StatusCode != http.StatusOK {
+		setMediaHeaders(w, resp.Header.Get("Content-Type"))
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	setMediaHeaders(w, encrypted.MimeType)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if err := encrypted.DecryptStream(w, resp.Body); err != nil {
+		h.logger.Warn("failed to decrypt media", "path", path, "err", err)
+		http.Error(w, "upstream error", http.StatusBadGateway)
+	}
 }
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/arko-chat/arko/internal/cache"
+	"github.com/arko-chat/arko/internal/matrix"
+	"maunium.net/go/mautrix/crypto/attachment"
+)
+
+func encryptMedia(t *testing.T, plaintext []byte, path, mimeType string) (*matrix.EncryptedMedia, []byte) {
+	t.Helper()
+
+	sent := attachment.NewEncryptedFile()
+	ciphertext := sent.Encrypt(plaintext)
+
+	data, _ := json.Marshal(sent)
+	var file attachment.EncryptedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return matrix.NewEncryptedMedia(path, mimeType, file), ciphertext
+}
+
+func TestProxyMedia(t *testing.T) {
+	const mediaPath = "/_matrix/client/v1/media/download/example.com/abc"
+
+	small := []byte("a picture of a cat")
+	large := bytes.Repeat([]byte("x"), MaxCacheableMediaSize+1)
+
+	tests := []struct {
+		name string
+		path string
+		ref  string
+		// served is what the homeserver returns for mediaPath
+		served          func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia)
+		wantStatus      int
+		wantBody        []byte
+		wantContentType string
+		wantAttachment  bool
+	}{
+		{
+			name: "unencrypted image is served inline",
+			path: mediaPath,
+			served: func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia) {
+				return small, "image/png", nil
+			},
+			wantStatus:      http.StatusOK,
+			wantBody:        small,
+			wantContentType: "image/png",
+		},
+		{
+			name: "unencrypted html is forced to a download",
+			path: mediaPath,
+			served: func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia) {
+				return []byte("<script>alert(1)</script>"), "text/html; charset=utf-8", nil
+			},
+			wantStatus:      http.StatusOK,
+			wantBody:        []byte("<script>alert(1)</script>"),
+			wantContentType: "application/octet-stream",
+			wantAttachment:  true,
+		},
+		{
+			name: "encrypted image is decrypted",
+			path: mediaPath,
+			ref:  "ref",
+			served: func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia) {
+				media, ciphertext := encryptMedia(t, small, mediaPath, "image/png")
+				return ciphertext, "application/octet-stream", media
+			},
+			wantStatus:      http.StatusOK,
+			wantBody:        small,
+			wantContentType: "image/png",
+		},
+		{
+			name: "encrypted svg is forced to a download",
+			path: mediaPath,
+			ref:  "ref",
+			served: func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia) {
+				media, ciphertext := encryptMedia(t, small, mediaPath, "image/svg+xml")
+				return ciphertext, "application/octet-stream", media
+			},
+			wantStatus:      http.StatusOK,
+			wantBody:        small,
+			wantContentType: "application/octet-stream",
+			wantAttachment:  true,
+		},
+		{
+			name: "tampered ciphertext is rejected",
+			path: mediaPath,
+			ref:  "ref",
+			served: func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia) {
+				media, ciphertext := encryptMedia(t, small, mediaPath, "image/png")
+				ciphertext[0] ^= 0xff
+				return ciphertext, "application/octet-stream", media
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "large encrypted file is streamed",
+			path: mediaPath,
+			ref:  "ref",
+			served: func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia) {
+				media, ciphertext := encryptMedia(t, large, mediaPath, "video/mp4")
+				return ciphertext, "application/octet-stream", media
+			},
+			wantStatus:      http.StatusOK,
+			wantBody:        large,
+			wantContentType: "video/mp4",
+		},
+		{
+			name: "large tampered ciphertext is rejected before streaming",
+			path: mediaPath,
+			ref:  "ref",
+			served: func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia) {
+				media, ciphertext := encryptMedia(t, large, mediaPath, "video/mp4")
+				ciphertext[len(ciphertext)-1] ^= 0xff
+				return ciphertext, "application/octet-stream", media
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "unknown ref",
+			path: mediaPath,
+			ref:  "other",
+			served: func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia) {
+				media, ciphertext := encryptMedia(t, small, mediaPath, "image/png")
+				return ciphertext, "application/octet-stream", media
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "ref registered for another path",
+			path: mediaPath,
+			ref:  "ref",
+			served: func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia) {
+				media, ciphertext := encryptMedia(t, small, mediaPath+"other", "image/png")
+				return ciphertext, "application/octet-stream", media
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "path outside the media api",
+			path: "/_matrix/client/v3/account/whoami",
+			served: func(t *testing.T) ([]byte, string, *matrix.EncryptedMedia) {
+				return []byte("{}"), "application/json", nil
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType, media := tt.served(t)
+
+			homeserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != mediaPath || r.Header.Get("Authorization") != "Bearer token" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", contentType)
+				w.Write(body)
+			}))
+			defer homeserver.Close()
+
+			lookup := func(ref string) (*matrix.EncryptedMedia, bool) {
+				return media, media != nil && ref == "ref"
+			}
+
+			h := &Handler{
+				logger:     slog.New(slog.DiscardHandler),
+				mediaCache: cache.New[MediaResponse](time.Hour),
+			}
+
+			query := url.Values{"path": {tt.path}}
+			if tt.ref != "" {
+				query.Set("ref", tt.ref)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/media?"+query.Encode(), nil)
+			w := httptest.NewRecorder()
+			h.proxyMedia(w, r, homeserver.URL, "token", lookup)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if bytes.Contains(w.Body.Bytes(), small[:8]) || bytes.Contains(w.Body.Bytes(), large[:8]) {
+					t.Error("expected no plaintext in the response")
+				}
+				return
+			}
+
+			if !bytes.Equal(w.Body.Bytes(), tt.wantBody) {
+				t.Errorf("expected a body of %d bytes, got %d", len(tt.wantBody), w.Body.Len())
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("expected content type %q, got %q", tt.wantContentType, got)
+			}
+			if got := w.Header().Get("Content-Disposition") == "attachment"; got != tt.wantAttachment {
+				t.Errorf("expected attachment %v, got %v", tt.wantAttachment, got)
+			}
+			if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("expected nosniff, got %q", got)
+			}
+			if got := w.Header().Get("Content-Security-Policy"); got != "sandbox" {
+				t.Errorf("expected a sandbox policy, got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	messagemodal "github.com/arko-chat/arko/components/modals/messages"
+	"github.com/arko-chat/arko/components/ui"
+	"github.com/arko-chat/arko/internal/matrix"
+	"github.com/arko-chat/arko/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) HandleReact(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+	roomID := r.FormValue("roomID")
+	emoji := strings.TrimSpace(r.FormValue("emoji"))
+
+	if roomID == "" || emoji == "" {
+		h.clientError(w, r, http.StatusBadRequest, "Missing reaction.")
+		return
+	}
+
+	msg, err := h.svc.Chat.ToggleReaction(roomID, messageID, emoji)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	if err := ui.MessageReactions(msg).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleRetrySend(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+	roomID := r.FormValue("roomID")
+	if roomID == "" {
+		h.clientError(w, r, http.StatusBadRequest, "Missing room.")
+		return
+	}
+
+	if err := h.svc.Chat.RetrySend(roomID, messageID); err != nil {
+		if errors.Is(err, matrix.ErrNotQueued) {
+			h.clientError(w, r, http.StatusConflict, "This message is no longer waiting to be sent.")
+			return
+		}
+		h.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) HandleDiscardSend(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+	roomID := r.FormValue("roomID")
+	if roomID == "" {
+		h.clientError(w, r, http.StatusBadRequest, "Missing room.")
+		return
+	}
+
+	if err := h.svc.Chat.DiscardSend(roomID, messageID); err != nil {
+		if errors.Is(err, matrix.ErrNotQueued) || errors.Is(err, matrix.ErrSending) {
+			h.clientError(w, r, http.StatusConflict, "This message can't be discarded anymore.")
+			return
+		}
+		h.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) HandleThread(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+	roomID := r.FormValue("roomID")
+	if roomID == "" {
+		h.clientError(w, r, http.StatusBadRequest, "Missing room.")
+		return
+	}
+
+	thread, root, err := h.svc.Chat.GetThread(roomID, messageID)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	err = ui.ThreadPanel(root, thread.Replies(), thread.Count(), thread.HasMore()).Render(r.Context(), w)
+	if err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleNextThreadReplies(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+	roomID := r.FormValue("roomID")
+	if roomID == "" {
+		h.clientError(w, r, http.StatusBadRequest, "Missing room.")
+		return
+	}
+
+	replies, hasMore, err := h.svc.Chat.LoadNextThreadReplies(roomID, messageID, 30)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	root := models.Message{ID: messageID, RoomID: roomID}
+	if err := ui.ThreadReplies(root, replies, hasMore).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleJump(w http.ResponseWriter, r *http.Request) {
+	eventID, err := url.PathUnescape(chi.URLParam(r, "messageID"))
+	roomID := r.FormValue("roomID")
+	if err != nil || roomID == "" {
+		h.clientError(w, r, http.StatusBadRequest, "Missing room.")
+		return
+	}
+
+	path, err := h.svc.Chat.RoomPath(roomID)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	h.redirect(w, r, path+"?event="+url.QueryEscape(eventID))
+}
+
+func (h *Handler) HandlePinnedMessages(w http.ResponseWriter, r *http.Request) {
+	roomID := r.FormValue("roomID")
+	if roomID == "" {
+		h.clientError(w, r, http.StatusBadRequest, "Missing room.")
+		return
+	}
+
+	messages, err := h.svc.Chat.PinnedMessages(roomID)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	if err := ui.PinnedMessagesPanel(messages).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandlePin(w http.ResponseWriter, r *http.Request) {
+	h.setPinned(w, r, true)
+}
+
+func (h *Handler) HandleUnpin(w http.ResponseWriter, r *http.Request) {
+	h.setPinned(w, r, false)
+}
+
+func (h *Handler) setPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	eventID, err := url.PathUnescape(chi.URLParam(r, "messageID"))
+	roomID := r.FormValue("roomID")
+	if err != nil || roomID == "" {
+		h.clientError(w, r, http.StatusBadRequest, "Missing room.")
+		return
+	}
+
+	if err := h.svc.Chat.SetPinned(roomID, eventID, pinned); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	// unpinning from the panel re-renders it
+	if r.FormValue("panel") != "" {
+		h.HandlePinnedMessages(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) HandleCloseThread(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) HandleEditForm(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+	roomID := r.FormValue("roomID")
+
+	msg, err := h.svc.Chat.GetMessage(roomID, messageID)
+	if err != nil {
+		h.clientError(w, r, http.StatusNotFound, "Message not found.")
+		return
+	}
+
+	if !msg.IsOwn {
+		h.clientError(w, r, http.StatusForbidden, "You can only edit your own messages.")
+		return
+	}
+
+	if err := ui.MessageEditForm(msg).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleMessageContent(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+	roomID := r.FormValue("roomID")
+
+	msg, err := h.svc.Chat.GetMessage(roomID, messageID)
+	if err != nil {
+		h.clientError(w, r, http.StatusNotFound, "Message not found.")
+		return
+	}
+
+	if err := ui.MessageContent(msg).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleEditHistory(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+	roomID := r.FormValue("roomID")
+
+	history, err := h.svc.Chat.GetEditHistory(roomID, messageID)
+	if err != nil {
+		h.clientError(w, r, http.StatusNotFound, "Message not found.")
+		return
+	}
+
+	if err := messagemodal.EditHistory(history).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleDeleteConfirm(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+	roomID := r.FormValue("roomID")
+
+	msg, err := h.svc.Chat.GetMessage(roomID, messageID)
+	if err != nil {
+		h.clientError(w, r, http.StatusNotFound, "Message not found.")
+		return
+	}
+
+	if !msg.CanRedact {
+		h.clientError(w, r, http.StatusForbidden, "You can't delete this message.")
+		return
+	}
+
+	if err := messagemodal.DeleteMessageForm(msg).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+	roomID := r.FormValue("roomID")
+	reason := strings.TrimSpace(r.FormValue("reason"))
+
+	if roomID == "" {
+		h.clientError(w, r, http.StatusBadRequest, "Missing room.")
+		return
+	}
+
+	if err := h.svc.Chat.RedactMessage(roomID, messageID, reason); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
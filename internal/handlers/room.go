@@ -1,12 +1,99 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
+	"github.com/arko-chat/arko/components"
 	"github.com/arko-chat/arko/components/ui"
+	"github.com/arko-chat/arko/internal/htmx"
+	"github.com/arko-chat/arko/internal/matrix"
+	roomspage "github.com/arko-chat/arko/pages/rooms"
 	"github.com/go-chi/chi/v5"
 )
 
+func (h *Handler) HandleRoom(w http.ResponseWriter, r *http.Request) {
+	state := h.session(r)
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "roomID")
+
+	user, err := h.svc.User.GetCurrentUser()
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	spaces, err := h.svc.Spaces.ListSpaces()
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	room, err := h.svc.Spaces.GetChannel("", roomID)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	members, _ := h.svc.Chat.GetRoomMembers(roomID)
+
+	tree, err := h.svc.Chat.GetRoomMessageTree(roomID)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	focusID := ""
+	if eventID := r.URL.Query().Get("event"); eventID != "" {
+		focusID, err = h.svc.Chat.JumpToEvent(roomID, eventID)
+		if err != nil {
+			h.logger.Warn("failed to jump to event", "eventID", eventID, "err", err)
+		}
+	} else if err := h.svc.Chat.ReturnToPresent(roomID); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	h.svc.Chat.SubscribeTyping(roomID)
+
+	typingUsers := h.svc.Chat.GetTypingUsers(roomID)
+
+	fl, _ := h.svc.Friends.ListFriends()
+
+	props := roomspage.ContentProps{
+		User:        user,
+		FriendsList: fl,
+		Spaces:      spaces,
+		Room:        room,
+		Members:     members,
+		Tree:        tree,
+		TypingUsers: typingUsers,
+		FocusID:     focusID,
+	}
+
+	h.svc.WebView.SetTitle(fmt.Sprintf("#%s", room.Name))
+
+	if htmx.IsHTMX(r) {
+		if err := roomspage.Content(props).Render(ctx, w); err != nil {
+			h.serverError(w, r, err)
+		}
+		return
+	}
+
+	if err := roomspage.Page(roomspage.PageProps{
+		PageProps: components.PageProps{
+			State: state,
+			Title: h.svc.WebView.GetTitle(),
+		},
+		ContentProps: props,
+	}).Render(ctx, w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
 func (h *Handler) HandleNextMessages(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	roomID := chi.URLParam(r, "roomID")
@@ -27,6 +114,28 @@ func (h *Handler) HandleNextMessages(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handler) HandleNewerMessages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "roomID")
+
+	hasMore, err := h.svc.Chat.LoadNewerMessages(roomID, 30)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	if !hasMore {
+		if err := ui.JumpToPresentOOB("").Render(ctx, w); err != nil {
+			h.serverError(w, r, err)
+		}
+		return
+	}
+
+	if err := ui.NewerMessageScrollSensor(roomID).Render(ctx, w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
 func (h *Handler) HandleTyping(w http.ResponseWriter, r *http.Request) {
 	s := h.session(r)
 	if s == nil || !s.LoggedIn {
@@ -46,3 +155,115 @@ func (h *Handler) HandleTyping(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+
+	limit, err := h.svc.Chat.UploadLimit()
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	// leave some room for the multipart framing
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1<<20)
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			h.clientError(w, r, http.StatusRequestEntityTooLarge, uploadTooLarge(limit))
+			return
+		}
+		h.clientError(w, r, http.StatusBadRequest, "Missing file.")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+	if int64(len(data)) > limit {
+		h.clientError(w, r, http.StatusRequestEntityTooLarge, uploadTooLarge(limit))
+		return
+	}
+
+	mimeType := header.Header.Get("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = http.DetectContentType(data)
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+
+	if err := h.svc.Chat.SendAttachment(roomID, header.Filename, mimeType, data); err != nil {
+		if errors.Is(err, matrix.ErrAttachmentTooLarge) {
+			h.clientError(w, r, http.StatusRequestEntityTooLarge, uploadTooLarge(limit))
+			return
+		}
+		h.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func uploadTooLarge(limit int64) string {
+	return fmt.Sprintf("File is too large. The server allows up to %d MB.", limit/(1024*1024))
+}
+
+func (h *Handler) HandleStickerPicker(w http.ResponseWriter, r *http.Request) {
+	roomID := r.FormValue("roomID")
+	if roomID == "" {
+		h.clientError(w, r, http.StatusBadRequest, "Missing room.")
+		return
+	}
+
+	packs, widget, err := h.svc.Chat.GetStickers(roomID)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	if err := ui.StickerPicker(roomID, packs, widget).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleSendSticker(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+
+	var err error
+	if content := r.FormValue("content"); content != "" {
+		err = h.svc.Chat.SendWidgetSticker(roomID, []byte(content))
+	} else {
+		packID, stickerID := r.FormValue("pack"), r.FormValue("sticker")
+		if packID == "" || stickerID == "" {
+			h.clientError(w, r, http.StatusBadRequest, "Missing sticker.")
+			return
+		}
+		err = h.svc.Chat.SendPackSticker(roomID, packID, stickerID)
+	}
+
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) HandleMentionSuggestions(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	query := strings.TrimPrefix(strings.TrimSpace(r.FormValue("q")), "@")
+
+	users, err := h.svc.Chat.SearchMentions(roomID, query)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	showRoom := strings.HasPrefix("room", strings.ToLower(query))
+	if err := ui.MentionSuggestions(users, showRoom).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
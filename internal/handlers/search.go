@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arko-chat/arko/components/ui"
+	"github.com/arko-chat/arko/internal/models"
+	"github.com/arko-chat/arko/internal/search"
+)
+
+const searchDateLayout = "2006-01-02"
+
+func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	filters := ui.SearchFilters{
+		Query:  strings.TrimSpace(r.FormValue("q")),
+		RoomID: r.FormValue("current"),
+		InRoom: r.FormValue("room") != "",
+		Sender: strings.TrimSpace(r.FormValue("from")),
+		After:  r.FormValue("after"),
+		Before: r.FormValue("before"),
+	}
+	if filters.RoomID == "" {
+		filters.RoomID = r.FormValue("room")
+	}
+
+	q := search.Query{Text: filters.Query, Sender: filters.Sender}
+	if filters.InRoom {
+		q.RoomIDs = []string{filters.RoomID}
+	}
+	if filters.After != "" {
+		after, err := time.ParseInLocation(searchDateLayout, filters.After, time.Local)
+		if err != nil {
+			h.clientError(w, r, http.StatusBadRequest, "Invalid date.")
+			return
+		}
+		q.After = after
+	}
+	if filters.Before != "" {
+		before, err := time.ParseInLocation(searchDateLayout, filters.Before, time.Local)
+		if err != nil {
+			h.clientError(w, r, http.StatusBadRequest, "Invalid date.")
+			return
+		}
+		// include the whole day the user picked
+		q.Before = before.AddDate(0, 0, 1)
+	}
+
+	var results []models.SearchResult
+	if q.Text != "" {
+		var err error
+		results, err = h.svc.Chat.SearchMessages(q)
+		if err != nil {
+			h.serverError(w, r, err)
+			return
+		}
+	}
+
+	if err := ui.SearchPanel(filters, results).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/arko-chat/arko/components"
+	spacemodal "github.com/arko-chat/arko/components/modals/spaces"
 	"github.com/arko-chat/arko/internal/htmx"
 	spacespage "github.com/arko-chat/arko/pages/spaces"
 	"github.com/go-chi/chi/v5"
@@ -60,3 +61,67 @@ func (h *Handler) HandleSpaces(w http.ResponseWriter, r *http.Request) {
 		h.serverError(w, r, err)
 	}
 }
+
+func (h *Handler) HandleJoinChannel(w http.ResponseWriter, r *http.Request) {
+	spaceID := chi.URLParam(r, "spaceID")
+	channelID := chi.URLParam(r, "channelID")
+
+	if err := h.svc.Spaces.JoinSpaceChild(parentOr(r, spaceID), channelID); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	h.htmxRedirect(w, "/spaces/"+spaceID+"/channels/"+channelID)
+}
+
+func (h *Handler) HandleJoinCategory(w http.ResponseWriter, r *http.Request) {
+	spaceID := chi.URLParam(r, "spaceID")
+	categoryID := chi.URLParam(r, "categoryID")
+
+	if err := h.svc.Spaces.JoinSpaceChild(parentOr(r, spaceID), categoryID); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	h.htmxRedirect(w, "/spaces/"+spaceID)
+}
+
+func (h *Handler) HandleLeaveSpaceForm(w http.ResponseWriter, r *http.Request) {
+	spaceID := chi.URLParam(r, "spaceID")
+
+	preview, err := h.svc.Spaces.LeaveSpacePreview(spaceID)
+	if err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	if err := spacemodal.LeaveSpace(preview).Render(r.Context(), w); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+func (h *Handler) HandleLeaveSpace(w http.ResponseWriter, r *http.Request) {
+	spaceID := chi.URLParam(r, "spaceID")
+
+	if err := r.ParseForm(); err != nil {
+		h.clientError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	leaveChildren := r.FormValue("children") == "true"
+	forget := r.FormValue("forget") == "true"
+
+	if err := h.svc.Spaces.LeaveSpace(spaceID, leaveChildren, forget); err != nil {
+		h.serverError(w, r, err)
+		return
+	}
+
+	h.htmxRedirect(w, "/")
+}
+
+func parentOr(r *http.Request, spaceID string) string {
+	if parent := r.FormValue("parent"); parent != "" {
+		return parent
+	}
+	return spaceID
+}
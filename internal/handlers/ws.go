@@ -35,6 +35,9 @@ func (h *Handler) HandleWS(w http.ResponseWriter, r *http.Request) {
 	go client.WritePump()
 
 	h.svc.Verification.ListenVerifyEvents(r.Context())
+	h.svc.Chat.SubscribeUnread()
+	h.svc.Notifications.Subscribe()
+	h.svc.Friends.SubscribeInvites()
 
 	client.ReadPump(func(ctx context.Context, raw []byte) {
 		var msg ws.ClientRequest
@@ -45,6 +48,7 @@ func (h *Handler) HandleWS(w http.ResponseWriter, r *http.Request) {
 		switch msg.Action {
 		case "SUBSCRIBE_ROOM":
 			client.SetActiveRoom(msg.RoomID)
+			go h.svc.Chat.MarkRead(msg.RoomID)
 		case "SAS_CONFIRM":
 			if err := h.svc.Verification.ConfirmVerification(ctx); err != nil {
 				h.logger.Error("ws SAS_CONFIRM failed", "err", err)
@@ -66,9 +70,31 @@ func (h *Handler) HandleWS(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				return
 			}
-			if err := h.svc.Chat.SendRoomMessage(msg.RoomID, author, msg.Message); err != nil {
+			if err := h.svc.Chat.SendRoomMessage(msg.RoomID, author, msg.Message, msg.ReplyTo); err != nil {
 				h.logger.Error("ws chat send failed", "err", err)
 			}
+		case "EDIT_MESSAGE":
+			if strings.TrimSpace(msg.Message) == "" || msg.MessageID == "" {
+				return
+			}
+			author, err := h.svc.User.GetCurrentUser()
+			if err != nil {
+				return
+			}
+			if err := h.svc.Chat.EditMessage(msg.RoomID, author, msg.MessageID, msg.Message); err != nil {
+				h.logger.Error("ws edit failed", "err", err)
+			}
+		case "THREAD_MESSAGE":
+			if strings.TrimSpace(msg.Message) == "" || msg.ThreadID == "" {
+				return
+			}
+			author, err := h.svc.User.GetCurrentUser()
+			if err != nil {
+				return
+			}
+			if err := h.svc.Chat.SendThreadMessage(msg.RoomID, author, msg.ThreadID, msg.Message); err != nil {
+				h.logger.Error("ws thread send failed", "err", err)
+			}
 		}
 	})
 }
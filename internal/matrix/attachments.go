@@ -0,0 +1,280 @@
+package matrix
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/crypto/attachment"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+const defaultUploadLimit = 50 * 1024 * 1024
+
+var ErrAttachmentTooLarge = errors.New("attachment exceeds the server upload limit")
+
+func (m *MatrixSession) UploadLimit() int64 {
+	limit, err := m.mediaCache.Get("upload", func() (int64, error) {
+		resp, err := m.GetClient().GetMediaConfig(m.Context())
+		if err != nil {
+			return 0, err
+		}
+		if resp.UploadSize <= 0 {
+			return defaultUploadLimit, nil
+		}
+		return resp.UploadSize, nil
+	})
+	if err != nil {
+		m.logger.Warn("failed to fetch media config", "err", err)
+		return defaultUploadLimit
+	}
+	return limit
+}
+
+func attachmentType(msgType event.MessageType) (models.AttachmentType, bool) {
+	switch msgType {
+	case event.MsgImage:
+		return models.AttachmentImage, true
+	case event.MsgVideo:
+		return models.AttachmentVideo, true
+	case event.MsgAudio:
+		return models.AttachmentAudio, true
+	case event.MsgFile:
+		return models.AttachmentFile, true
+	}
+	return "", false
+}
+
+func attachmentMsgType(mimeType string) event.MessageType {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return event.MsgImage
+	case strings.HasPrefix(mimeType, "video/"):
+		return event.MsgVideo
+	case strings.HasPrefix(mimeType, "audio/"):
+		return event.MsgAudio
+	}
+	return event.MsgFile
+}
+
+func fileType(mimeType, name string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	case mimeType == "application/pdf":
+		return "pdf"
+	}
+
+	switch strings.ToLower(path.Ext(name)) {
+	case ".zip", ".tar", ".gz", ".tgz", ".7z", ".rar":
+		return "zip"
+	case ".go", ".js", ".ts", ".py", ".rs", ".c", ".h", ".java", ".json", ".yaml", ".yml", ".sh":
+		return "code"
+	}
+	return ""
+}
+
+func formatFileSize(size int) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := int64(size) / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGT"[exp])
+}
+
+func mediaURL(uri id.ContentURIString) string {
+	parsed, err := uri.Parse()
+	if err != nil || parsed.IsEmpty() {
+		return ""
+	}
+	return "/api/media?path=" + url.QueryEscape(mxcToHTTP(parsed))
+}
+
+func (t *MessageTree) attachmentFromContent(kind models.AttachmentType, content *event.MessageEventContent) models.Attachment {
+	name := content.FileName
+	if name == "" {
+		name = content.Body
+	}
+
+	a := models.Attachment{
+		Type:    kind,
+		Name:    name,
+		AltText: content.Body,
+	}
+
+	if info := content.Info; info != nil {
+		a.MimeType = info.MimeType
+		a.Width = info.Width
+		a.Height = info.Height
+		if info.Size > 0 {
+			a.Size = formatFileSize(info.Size)
+		}
+	}
+	a.FileType = fileType(a.MimeType, name)
+
+	if content.File != nil {
+		ref := t.matrixSession.registerEncryptedMedia(content.File, a.MimeType)
+		if ref != "" {
+			a.URL = mediaURL(content.File.URL) + "&ref=" + ref
+		}
+	} else {
+		a.URL = mediaURL(content.URL)
+	}
+
+	return a
+}
+
+// attachmentCaption returns the caption of a media event, which is only
+// present when the body differs from the file name.
+func attachmentCaption(content *event.MessageEventContent) string {
+	if content.FileName == "" || content.FileName == content.Body {
+		return ""
+	}
+	return content.Body
+}
+
+type progressReader struct {
+	io.Reader
+	total    int
+	read     int
+	reported int
+	onChange func(percent int)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.Reader.Read(b)
+	p.read += n
+
+	percent := p.read * 100 / max(p.total, 1)
+	// only report in steps of 5% to avoid flooding the listeners
+	if percent-p.reported >= 5 || (percent == 100 && p.reported != 100) {
+		p.reported = percent
+		p.onChange(percent)
+	}
+	return n, err
+}
+
+func (t *MessageTree) SendAttachment(name, mimeType string, data []byte) error {
+	ctx := t.matrixSession.Context()
+
+	if int64(len(data)) > t.matrixSession.UploadLimit() {
+		return ErrAttachmentTooLarge
+	}
+
+	nonce, err := generateNonce()
+	if err != nil {
+		return err
+	}
+
+	msgType := attachmentMsgType(mimeType)
+	kind, _ := attachmentType(msgType)
+
+	content := &event.MessageEventContent{
+		MsgType:  msgType,
+		Body:     name,
+		FileName: name,
+		Info: &event.FileInfo{
+			MimeType: mimeType,
+			Size:     len(data),
+		},
+	}
+
+	if msgType == event.MsgImage {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			content.Info.Width = cfg.Width
+			content.Info.Height = cfg.Height
+		}
+	}
+
+	placeholder := t.defaultMessage("", nonce)
+	placeholder.Attachments = []models.Attachment{{
+		Type:      kind,
+		Name:      name,
+		Size:      formatFileSize(len(data)),
+		FileType:  fileType(mimeType, name),
+		MimeType:  mimeType,
+		Uploading: true,
+	}}
+	t.Set(placeholder)
+
+	setUpload := func(fn func(*models.Attachment)) {
+		t.updateMessage(nonce, func(m *models.Message) {
+			if len(m.Attachments) > 0 {
+				fn(&m.Attachments[0])
+			}
+		})
+	}
+
+	req := mautrix.ReqUploadMedia{
+		ContentType: mimeType,
+		FileName:    name,
+	}
+
+	var file *attachment.EncryptedFile
+	if t.isEncrypted.Load() {
+		file = attachment.NewEncryptedFile()
+		data = bytes.Clone(data)
+		file.EncryptInPlace(data)
+
+		// the server must not learn anything about encrypted media
+		req.ContentType = "application/octet-stream"
+		req.FileName = ""
+	}
+
+	req.ContentLength = int64(len(data))
+	req.Content = &progressReader{
+		Reader: bytes.NewReader(data),
+		total:  len(data),
+		onChange: func(percent int) {
+			setUpload(func(a *models.Attachment) { a.Progress = percent })
+		},
+	}
+
+	resp, err := t.matrixSession.GetClient().UploadMedia(ctx, req)
+	if err != nil {
+		setUpload(func(a *models.Attachment) {
+			a.Uploading = false
+			a.Failed = true
+		})
+		return fmt.Errorf("upload media: %w", err)
+	}
+
+	if file != nil {
+		content.File = &event.EncryptedFileInfo{
+			EncryptedFile: *file,
+			URL:           resp.ContentURI.CUString(),
+		}
+	} else {
+		content.URL = resp.ContentURI.CUString()
+	}
+
+	// the upload is done, sending the event can be retried from here on
+	setUpload(func(a *models.Attachment) { a.Progress = 100 })
+	if current, ok := t.GetMessage(nonce); ok {
+		placeholder = current
+	}
+	if err := t.queueEvent(event.EventMessage, content, placeholder); err != nil {
+		return fmt.Errorf("send attachment: %w", err)
+	}
+	return nil
+}
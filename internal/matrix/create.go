@@ -21,6 +21,15 @@ type CreateChannelParams struct {
 	Name    string
 	Topic   string
 	SpaceID string
+	// CategoryID is the subspace to create the channel in, if not the
+	// space itself.
+	CategoryID string
+	Public     bool
+}
+
+type CreateCategoryParams struct {
+	Name    string
+	SpaceID string
 	Public  bool
 }
 
@@ -62,6 +71,11 @@ func (m *MatrixSession) CreateSpace(params CreateSpaceParams) (models.Space, err
 func (m *MatrixSession) CreateChannel(params CreateChannelParams) (models.Channel, error) {
 	ctx := m.context
 
+	parentID := params.SpaceID
+	if params.CategoryID != "" {
+		parentID = params.CategoryID
+	}
+
 	preset := "private_chat"
 	if params.Public {
 		preset = "public_chat"
@@ -70,7 +84,7 @@ func (m *MatrixSession) CreateChannel(params CreateChannelParams) (models.Channe
 	initialState := []*event.Event{
 		{
 			Type:     event.StateSpaceParent,
-			StateKey: ptr(params.SpaceID),
+			StateKey: ptr(parentID),
 			Content: event.Content{
 				Parsed: &event.SpaceParentEventContent{
 					Via: []string{m.client.UserID.Homeserver()},
@@ -91,18 +105,68 @@ func (m *MatrixSession) CreateChannel(params CreateChannelParams) (models.Channe
 		return models.Channel{}, fmt.Errorf("create channel: %w", err)
 	}
 
-	if err := m.addChildToSpace(ctx, id.RoomID(params.SpaceID), resp.RoomID); err != nil {
+	if err := m.addChildToSpace(ctx, id.RoomID(parentID), resp.RoomID); err != nil {
 		m.logger.Warn("failed to add space child relation", "error", err)
 	}
 
-	m.channelsCache.Invalidate("gsc:" + params.SpaceID)
+	m.channelsCache.Clear()
 
 	return models.Channel{
-		ID:      resp.RoomID.String(),
-		Name:    params.Name,
-		Type:    models.ChannelText,
-		SpaceID: params.SpaceID,
-		Topic:   params.Topic,
+		ID:         resp.RoomID.String(),
+		Name:       params.Name,
+		Type:       models.ChannelText,
+		SpaceID:    params.SpaceID,
+		CategoryID: parentID,
+		Topic:      params.Topic,
+	}, nil
+}
+
+// CreateCategory creates a subspace of a space, which is shown as a
+// category of channels.
+func (m *MatrixSession) CreateCategory(params CreateCategoryParams) (models.Category, error) {
+	ctx := m.context
+
+	preset := "private_chat"
+	if params.Public {
+		preset = "public_chat"
+	}
+
+	req := &mautrix.ReqCreateRoom{
+		Name:   params.Name,
+		Preset: preset,
+		CreationContent: map[string]interface{}{
+			"type": event.RoomTypeSpace,
+		},
+		InitialState: []*event.Event{
+			{
+				Type:     event.StateSpaceParent,
+				StateKey: ptr(params.SpaceID),
+				Content: event.Content{
+					Parsed: &event.SpaceParentEventContent{
+						Via:       []string{m.client.UserID.Homeserver()},
+						Canonical: true,
+					},
+				},
+			},
+		},
+	}
+
+	resp, err := m.client.CreateRoom(ctx, req)
+	if err != nil {
+		return models.Category{}, fmt.Errorf("create category: %w", err)
+	}
+
+	if err := m.addChildToSpace(ctx, id.RoomID(params.SpaceID), resp.RoomID); err != nil {
+		m.logger.Warn("failed to add space child relation", "error", err)
+	}
+
+	m.channelsCache.Clear()
+
+	return models.Category{
+		ID:       resp.RoomID.String(),
+		Name:     params.Name,
+		SpaceID:  params.SpaceID,
+		ParentID: params.SpaceID,
 	}, nil
 }
 
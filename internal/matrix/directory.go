@@ -0,0 +1,167 @@
+package matrix
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/arko-chat/arko/internal/models"
+)
+
+const directoryPageSize = 30
+
+var ErrInvalidJoinTarget = errors.New("not a room address or link")
+
+// JoinTarget is a room to join, given by ID or alias, with the servers to
+// join it through.
+type JoinTarget struct {
+	Room string
+	Via  []string
+}
+
+// ParseJoinTarget accepts a room alias, a room ID, or a matrix.to or matrix:
+// link to either. Links to an event join the event's room.
+func ParseJoinTarget(input string) (JoinTarget, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return JoinTarget{}, ErrInvalidJoinTarget
+	}
+
+	if input[0] == '#' || input[0] == '!' {
+		room, query, _ := strings.Cut(input, "?")
+		values, _ := url.ParseQuery(query)
+		return validJoinTarget(JoinTarget{Room: room, Via: values["via"]})
+	}
+
+	uri, err := id.ParseMatrixURIOrMatrixToURL(input)
+	if err != nil {
+		return JoinTarget{}, ErrInvalidJoinTarget
+	}
+	if uri.Sigil1 != '#' && uri.Sigil1 != '!' {
+		return JoinTarget{}, ErrInvalidJoinTarget
+	}
+	return validJoinTarget(JoinTarget{Room: uri.PrimaryIdentifier(), Via: uri.Via})
+}
+
+func validJoinTarget(target JoinTarget) (JoinTarget, error) {
+	switch target.Room[0] {
+	case '#':
+		localpart, server, ok := strings.Cut(target.Room[1:], ":")
+		if !ok || localpart == "" || server == "" {
+			return JoinTarget{}, ErrInvalidJoinTarget
+		}
+	case '!':
+		// newer room versions drop the server part from room IDs
+		if len(target.Room) < 2 {
+			return JoinTarget{}, ErrInvalidJoinTarget
+		}
+	default:
+		return JoinTarget{}, ErrInvalidJoinTarget
+	}
+	return target, nil
+}
+
+// reqPublicRoomsFilter is the body of POST /publicRooms, which mautrix only
+// wraps in its unfiltered GET form.
+type reqPublicRoomsFilter struct {
+	Limit  int               `json:"limit,omitempty"`
+	Since  string            `json:"since,omitempty"`
+	Filter publicRoomsFilter `json:"filter"`
+}
+
+type publicRoomsFilter struct {
+	GenericSearchTerm string `json:"generic_search_term,omitempty"`
+}
+
+// SearchDirectory lists public rooms from a server's room directory. An
+// empty server means the user's own homeserver.
+func (m *MatrixSession) SearchDirectory(server, query, since string) (models.DirectoryPage, error) {
+	client := m.GetClient()
+
+	params := map[string]string{}
+	if server != "" {
+		params["server"] = server
+	}
+	req := reqPublicRoomsFilter{
+		Limit:  directoryPageSize,
+		Since:  since,
+		Filter: publicRoomsFilter{GenericSearchTerm: query},
+	}
+
+	var resp mautrix.RespPublicRooms
+	urlPath := client.BuildURLWithQuery(mautrix.ClientURLPath{"v3", "publicRooms"}, params)
+	if _, err := client.MakeRequest(m.Context(), "POST", urlPath, req, &resp); err != nil {
+		return models.DirectoryPage{}, fmt.Errorf("public rooms: %w", err)
+	}
+
+	joined := make(map[id.RoomID]struct{})
+	if rooms, err := client.JoinedRooms(m.Context()); err == nil {
+		for _, roomID := range rooms.JoinedRooms {
+			joined[roomID] = struct{}{}
+		}
+	}
+
+	page := models.DirectoryPage{
+		Server:    server,
+		Query:     query,
+		NextBatch: resp.NextBatch,
+		Rooms:     make([]models.DirectoryRoom, 0, len(resp.Chunk)),
+	}
+	for _, room := range resp.Chunk {
+		_, isJoined := joined[room.RoomID]
+		page.Rooms = append(page.Rooms, models.DirectoryRoom{
+			ID:      room.RoomID.String(),
+			Alias:   room.CanonicalAlias.String(),
+			Name:    directoryRoomName(room),
+			Topic:   room.Topic,
+			Avatar:  resolveContentURIString(room.AvatarURL, room.RoomID.String(), "shapes"),
+			Members: room.NumJoinedMembers,
+			IsSpace: room.RoomType == event.RoomTypeSpace,
+			Joined:  isJoined,
+			Server:  server,
+		})
+	}
+	return page, nil
+}
+
+func directoryRoomName(room *mautrix.PublicRoomInfo) string {
+	switch {
+	case room.Name != "":
+		return room.Name
+	case room.CanonicalAlias != "":
+		return room.CanonicalAlias.String()
+	default:
+		return room.RoomID.String()
+	}
+}
+
+// JoinRoom joins a room by alias, ID or link and reports whether it's a
+// space. via is used when the input doesn't name any servers itself.
+func (m *MatrixSession) JoinRoom(input string, via []string) (string, bool, error) {
+	target, err := ParseJoinTarget(input)
+	if err != nil {
+		return "", false, err
+	}
+	if len(target.Via) == 0 {
+		target.Via = via
+	}
+
+	ctx := m.Context()
+	resp, err := m.GetClient().JoinRoom(ctx, target.Room, &mautrix.ReqJoinRoom{Via: target.Via})
+	if err != nil {
+		return "", false, fmt.Errorf("join room: %w", err)
+	}
+
+	var createEvt event.CreateEventContent
+	_ = m.GetClient().StateEvent(ctx, resp.RoomID, event.StateCreate, "", &createEvt)
+
+	m.spacesCache.Invalidate("ls:" + m.id)
+	m.channelsCache.Clear()
+
+	return resp.RoomID.String(), createEvt.Type == event.RoomTypeSpace, nil
+}
@@ -0,0 +1,74 @@
+package matrix
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseJoinTarget(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		room  string
+		via   []string
+		err   bool
+	}{
+		{name: "alias", input: "#arko:example.com", room: "#arko:example.com"},
+		{name: "alias with spaces", input: "  #arko:example.com\n", room: "#arko:example.com"},
+		{name: "room ID", input: "!abc:example.com", room: "!abc:example.com"},
+		{
+			name:  "room ID with via",
+			input: "!abc:example.com?via=example.com&via=other.org",
+			room:  "!abc:example.com",
+			via:   []string{"example.com", "other.org"},
+		},
+		{name: "matrix.to alias", input: "https://matrix.to/#/#arko:example.com", room: "#arko:example.com"},
+		{
+			name:  "matrix.to room ID",
+			input: "https://matrix.to/#/!abc:example.com?via=example.com",
+			room:  "!abc:example.com",
+			via:   []string{"example.com"},
+		},
+		{
+			name:  "matrix.to event",
+			input: "https://matrix.to/#/!abc:example.com/$event?via=example.com",
+			room:  "!abc:example.com",
+			via:   []string{"example.com"},
+		},
+		{name: "matrix URI alias", input: "matrix:r/arko:example.com", room: "#arko:example.com"},
+		{
+			name:  "matrix URI room ID",
+			input: "matrix:roomid/abc:example.com?via=example.com",
+			room:  "!abc:example.com",
+			via:   []string{"example.com"},
+		},
+		{name: "matrix.to user", input: "https://matrix.to/#/@user:example.com", err: true},
+		{name: "matrix URI user", input: "matrix:u/user:example.com", err: true},
+		{name: "alias without server", input: "#arko", err: true},
+		{name: "other link", input: "https://example.com/#/#arko:example.com", err: true},
+		{name: "empty", input: "", err: true},
+		{name: "plain text", input: "arko", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := ParseJoinTarget(tt.input)
+			if tt.err {
+				if !errors.Is(err, ErrInvalidJoinTarget) {
+					t.Errorf("expected ErrInvalidJoinTarget, got %v (%+v)", err, target)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if target.Room != tt.room {
+				t.Errorf("expected room %s, got %s", tt.room, target.Room)
+			}
+			if !slices.Equal(target.Via, tt.via) {
+				t.Errorf("expected via %v, got %v", tt.via, target.Via)
+			}
+		})
+	}
+}
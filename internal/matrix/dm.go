@@ -82,6 +82,7 @@ func (m *MatrixSession) CreateDMRoom(otherUserID string) (models.User, string, e
 	}
 
 	m.dmCache.Invalidate("ldm:" + m.id)
+	m.directCache.Invalidate("dr:" + m.id)
 
 	user := models.User{
 		ID:     otherUserID,
@@ -0,0 +1,253 @@
+package matrix
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+type editVersion struct {
+	eventID   id.EventID
+	sender    string
+	content   string
+	formatted string
+	timestamp time.Time
+}
+
+// editIndex keeps every m.replace event by the (hashed) ID of the message it
+// edits. Edits are only applied once the original is known, since only edits
+// from the original sender count.
+type editIndex struct {
+	mu        sync.Mutex
+	byTarget  map[string][]editVersion
+	originals map[string]models.MessageEdit
+	seen      map[id.EventID]struct{}
+}
+
+func newEditIndex() *editIndex {
+	return &editIndex{
+		byTarget:  make(map[string][]editVersion),
+		originals: make(map[string]models.MessageEdit),
+		seen:      make(map[id.EventID]struct{}),
+	}
+}
+
+func (e *editIndex) add(targetID string, v editVersion) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.seen[v.eventID]; ok {
+		return false
+	}
+	e.seen[v.eventID] = struct{}{}
+
+	versions := append(e.byTarget[targetID], v)
+	slices.SortStableFunc(versions, func(a, b editVersion) int {
+		return a.timestamp.Compare(b.timestamp)
+	})
+	e.byTarget[targetID] = versions
+	return true
+}
+
+func (e *editIndex) apply(m *models.Message) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.originals[m.ID]; !ok && !m.Edited {
+		e.originals[m.ID] = models.MessageEdit{
+			Content:          m.Content,
+			FormattedContent: m.FormattedContent,
+			Timestamp:        m.Timestamp,
+		}
+	}
+
+	versions := e.byTarget[m.ID]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].sender != m.Author.ID {
+			continue
+		}
+		m.Content = versions[i].content
+		m.FormattedContent = versions[i].formatted
+		m.Edited = true
+		m.EditedAt = versions[i].timestamp
+		return
+	}
+}
+
+func (e *editIndex) remove(evtID id.EventID) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for targetID, versions := range e.byTarget {
+		for i, v := range versions {
+			if v.eventID != evtID {
+				continue
+			}
+			e.byTarget[targetID] = slices.Delete(versions, i, i+1)
+			return targetID, true
+		}
+	}
+	return "", false
+}
+
+// rename moves an edit from its transaction ID to the event ID it was sent
+// as. If the sync echo got there first, the placeholder is dropped.
+func (e *editIndex) rename(oldID, newID id.EventID) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for targetID, versions := range e.byTarget {
+		i := slices.IndexFunc(versions, func(v editVersion) bool { return v.eventID == oldID })
+		if i < 0 {
+			continue
+		}
+
+		delete(e.seen, oldID)
+		if _, ok := e.seen[newID]; ok {
+			e.byTarget[targetID] = slices.Delete(versions, i, i+1)
+		} else {
+			versions[i].eventID = newID
+			e.seen[newID] = struct{}{}
+		}
+		return true
+	}
+	return false
+}
+
+// forget drops the edits and the original of a message that left the tree
+// a while ago.
+func (e *editIndex) forget(targetID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, v := range e.byTarget[targetID] {
+		delete(e.seen, v.eventID)
+	}
+	delete(e.byTarget, targetID)
+	delete(e.originals, targetID)
+}
+
+func (e *editIndex) original(messageID string) (models.MessageEdit, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	original, ok := e.originals[messageID]
+	return original, ok
+}
+
+func (e *editIndex) versions(targetID string) []editVersion {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.byTarget[targetID])
+}
+
+func (e *editIndex) history(m models.Message) []models.MessageEdit {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var history []models.MessageEdit
+	if original, ok := e.originals[m.ID]; ok {
+		history = append(history, original)
+	}
+	for _, v := range e.byTarget[m.ID] {
+		if v.sender != m.Author.ID {
+			continue
+		}
+		history = append(history, models.MessageEdit{
+			Content:          v.content,
+			FormattedContent: v.formatted,
+			Timestamp:        v.timestamp,
+		})
+	}
+	slices.Reverse(history)
+	return history
+}
+
+func replaceTarget(evt *event.Event) (id.EventID, *event.MessageEventContent) {
+	content, ok := evt.Content.Parsed.(*event.MessageEventContent)
+	if !ok || content.RelatesTo == nil || content.NewContent == nil {
+		return "", nil
+	}
+	if content.RelatesTo.Type != event.RelReplace || content.RelatesTo.EventID == "" {
+		return "", nil
+	}
+	return content.RelatesTo.EventID, content.NewContent
+}
+
+func (t *MessageTree) handleEdit(evt *event.Event, target id.EventID, newContent *event.MessageEventContent) {
+	if evt.Unsigned.RedactedBecause != nil {
+		return
+	}
+
+	targetID := safeHashClass(target.String())
+	added := t.edits.add(targetID, editVersion{
+		eventID:   evt.ID,
+		sender:    evt.Sender.String(),
+		content:   newContent.Body,
+		formatted: formattedBody(newContent),
+		timestamp: time.UnixMilli(evt.Timestamp),
+	})
+	if !added {
+		return
+	}
+
+	// applied by decorate once the original is loaded
+	t.updateMessage(targetID, t.edits.apply)
+}
+
+func (t *MessageTree) revertEdits(m *models.Message) {
+	if original, ok := t.edits.original(m.ID); ok {
+		m.Content = original.Content
+		m.FormattedContent = original.FormattedContent
+		m.Edited = false
+		m.EditedAt = time.Time{}
+	}
+	t.edits.apply(m)
+}
+
+func (t *MessageTree) EditHistory(messageID string) ([]models.MessageEdit, error) {
+	msg, ok := t.GetMessage(messageID)
+	if !ok {
+		return nil, fmt.Errorf("message %s not found", messageID)
+	}
+	return t.edits.history(msg), nil
+}
+
+func (t *MessageTree) EditMessage(messageID, body string) error {
+	msg, ok := t.GetMessage(messageID)
+	if !ok || msg.EventID == "" {
+		return fmt.Errorf("message %s not found", messageID)
+	}
+	if msg.Author.ID != t.matrixSession.id {
+		return fmt.Errorf("cannot edit another user's message")
+	}
+	if msg.Redacted {
+		return fmt.Errorf("cannot edit a deleted message")
+	}
+	if msg.Content == body {
+		return nil
+	}
+
+	newContent := t.textContent(body)
+
+	content := &event.MessageEventContent{
+		MsgType:    event.MsgText,
+		Body:       "* " + newContent.Body,
+		Mentions:   newContent.Mentions,
+		NewContent: newContent,
+	}
+	if newContent.FormattedBody != "" {
+		content.Format = event.FormatHTML
+		content.FormattedBody = "* " + newContent.FormattedBody
+	}
+	content.RelatesTo = (&event.RelatesTo{}).SetReplace(id.EventID(msg.EventID))
+
+	if err := t.queueRelation(event.EventMessage, content, messageID); err != nil {
+		return fmt.Errorf("send edit: %w", err)
+	}
+	return nil
+}
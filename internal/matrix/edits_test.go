@@ -0,0 +1,114 @@
+package matrix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix/id"
+)
+
+func TestEditIndex_ApplyAndRevert(t *testing.T) {
+	const (
+		alice = "@alice:example.com"
+		bob   = "@bob:example.com"
+	)
+	base := time.UnixMilli(1700000000000)
+
+	edit := func(evtID id.EventID, sender, content string, offset time.Duration) editVersion {
+		return editVersion{
+			eventID:   evtID,
+			sender:    sender,
+			content:   content,
+			timestamp: base.Add(offset),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		steps       func(tree *MessageTree, m *models.Message)
+		wantContent string
+		wantEdited  bool
+		wantHistory int
+	}{
+		{
+			name: "edit is applied",
+			steps: func(tree *MessageTree, m *models.Message) {
+				tree.edits.add(m.ID, edit("$e1", alice, "edited", time.Second))
+				tree.edits.apply(m)
+			},
+			wantContent: "edited",
+			wantEdited:  true,
+			wantHistory: 2,
+		},
+		{
+			name: "newest edit wins whatever the arrival order",
+			steps: func(tree *MessageTree, m *models.Message) {
+				tree.edits.add(m.ID, edit("$e2", alice, "second", 2*time.Second))
+				tree.edits.add(m.ID, edit("$e1", alice, "first", time.Second))
+				tree.edits.apply(m)
+			},
+			wantContent: "second",
+			wantEdited:  true,
+			wantHistory: 3,
+		},
+		{
+			name: "edits from other senders are ignored",
+			steps: func(tree *MessageTree, m *models.Message) {
+				tree.edits.add(m.ID, edit("$e1", bob, "hijacked", time.Second))
+				tree.edits.apply(m)
+			},
+			wantContent: "original",
+			wantHistory: 1,
+		},
+		{
+			name: "redacting the only edit restores the original",
+			steps: func(tree *MessageTree, m *models.Message) {
+				tree.edits.add(m.ID, edit("$e1", alice, "edited", time.Second))
+				tree.edits.apply(m)
+				tree.edits.remove("$e1")
+				tree.revertEdits(m)
+			},
+			wantContent: "original",
+			wantHistory: 1,
+		},
+		{
+			name: "redacting the newest edit falls back to the previous one",
+			steps: func(tree *MessageTree, m *models.Message) {
+				tree.edits.add(m.ID, edit("$e1", alice, "first", time.Second))
+				tree.edits.add(m.ID, edit("$e2", alice, "second", 2*time.Second))
+				tree.edits.apply(m)
+				tree.edits.remove("$e2")
+				tree.revertEdits(m)
+			},
+			wantContent: "first",
+			wantEdited:  true,
+			wantHistory: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := &MessageTree{edits: newEditIndex()}
+			m := models.Message{
+				ID:        "m1",
+				EventID:   "$m1",
+				Author:    models.User{ID: alice},
+				Content:   "original",
+				Timestamp: base,
+			}
+			tree.edits.apply(&m)
+			tt.steps(tree, &m)
+
+			if m.Content != tt.wantContent {
+				t.Errorf("expected content %q, got %q", tt.wantContent, m.Content)
+			}
+			if m.Edited != tt.wantEdited {
+				t.Errorf("expected edited %v, got %v", tt.wantEdited, m.Edited)
+			}
+			if got := len(tree.edits.history(m)); got != tt.wantHistory {
+				t.Errorf("expected %d history entries, got %d", tt.wantHistory, got)
+			}
+		})
+	}
+}
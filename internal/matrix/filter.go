@@ -0,0 +1,56 @@
+package matrix
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+)
+
+// syncTimelineLimit is how many timeline events a sync returns per room.
+// History beyond that is paginated by the message tree when a room is opened.
+const syncTimelineLimit = 20
+
+// unrenderedTypes are dropped from the timeline and room state. Wildcards
+// are matched by the server.
+var unrenderedTypes = []event.Type{
+	{Type: "m.call.*", Class: event.MessageEventType},
+	{Type: "org.matrix.msc3401.call.member", Class: event.StateEventType},
+	{Type: "m.policy.rule.*", Class: event.StateEventType},
+	{Type: "org.matrix.mjolnir.rule.*", Class: event.StateEventType},
+	event.StateServerACL,
+	event.StateGuestAccess,
+	event.StateThirdPartyInvite,
+}
+
+// syncFilter lazy loads members, so a room's state only carries the members
+// that sent something in the returned timeline. Full member lists are
+// fetched with /members when they're needed.
+func syncFilter() *mautrix.Filter {
+	return &mautrix.Filter{
+		Room: &mautrix.RoomFilter{
+			State: &mautrix.FilterPart{
+				LazyLoadMembers: true,
+				NotTypes:        unrenderedTypes,
+			},
+			Timeline: &mautrix.FilterPart{
+				Limit:           syncTimelineLimit,
+				LazyLoadMembers: true,
+				NotTypes:        unrenderedTypes,
+			},
+		},
+	}
+}
+
+// filterKey identifies a filter definition, so an uploaded filter is only
+// reused while the definition it was created from stays the same.
+func filterKey(f *mautrix.Filter) string {
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,41 @@
+package matrix
+
+import (
+	"strings"
+
+	"github.com/arko-chat/arko/internal/models"
+	"github.com/arko-chat/arko/internal/sanitizer"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+func sanitizedMediaURL(mxc string) string {
+	return mediaURL(id.ContentURIString(mxc))
+}
+
+func formattedBody(content *event.MessageEventContent) string {
+	if content.Format != event.FormatHTML || content.FormattedBody == "" {
+		return ""
+	}
+	return sanitizer.Sanitize(content.FormattedBody, sanitizedMediaURL)
+}
+
+// setFormattedBody renders the Markdown source into formatted_body, unless
+// the result is nothing more than the plain text in a paragraph.
+func setFormattedBody(content *event.MessageEventContent, source string) {
+	formatted := strings.TrimSpace(models.RenderMarkdown(source))
+	if formatted == "" || isPlainParagraph(formatted) {
+		return
+	}
+	content.Format = event.FormatHTML
+	content.FormattedBody = formatted
+}
+
+func isPlainParagraph(formatted string) bool {
+	inner, ok := strings.CutPrefix(formatted, "<p>")
+	if !ok {
+		return false
+	}
+	inner, ok = strings.CutSuffix(inner, "</p>")
+	return ok && !strings.Contains(inner, "<")
+}
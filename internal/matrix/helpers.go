@@ -7,6 +7,7 @@ import (
 	"hash/fnv"
 	"net/url"
 
+	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 )
 
@@ -87,3 +88,14 @@ func resolveContentURIString(
 	path := mxcToHTTP(parsed)
 	return "/api/media?path=" + url.QueryEscape(path)
 }
+
+func redactedEventID(evt *event.Event) id.EventID {
+	if evt.Redacts != "" {
+		return evt.Redacts
+	}
+	_ = evt.Content.ParseRaw(evt.Type)
+	if content, ok := evt.Content.Parsed.(*event.RedactionEventContent); ok {
+		return content.Redacts
+	}
+	return ""
+}
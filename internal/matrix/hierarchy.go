@@ -0,0 +1,231 @@
+package matrix
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/arko-chat/arko/internal/models"
+)
+
+// maxHierarchyPages bounds how much of a very large space is walked.
+const maxHierarchyPages = 10
+
+type spaceChild struct {
+	roomID    id.RoomID
+	order     string
+	suggested bool
+	ts        int64
+}
+
+// getSpaceCategories walks a space with /hierarchy. The first category is
+// the space itself and holds its direct channels; every subspace below it,
+// at any depth, becomes a category of its own.
+func (m *MatrixSession) getSpaceCategories(spaceID id.RoomID) ([]models.Category, error) {
+	return m.channelsCache.Get("gsc:"+spaceID.String(), func() ([]models.Category, error) {
+		rooms, err := m.fetchHierarchy(m.context, spaceID)
+		if err != nil {
+			return nil, err
+		}
+
+		joined := make(map[id.RoomID]struct{})
+		if resp, err := m.client.JoinedRooms(m.context); err == nil {
+			for _, roomID := range resp.JoinedRooms {
+				joined[roomID] = struct{}{}
+			}
+		}
+
+		categories := m.buildCategories(spaceID, rooms, joined)
+
+		for _, category := range categories {
+			for _, channel := range category.Channels {
+				if channel.Joinable {
+					continue
+				}
+				go func() {
+					tree := m.GetMessageTree(channel.ID)
+					tree.Initialize(m.context)
+				}()
+			}
+		}
+
+		return categories, nil
+	})
+}
+
+func (m *MatrixSession) fetchHierarchy(ctx context.Context, spaceID id.RoomID) ([]*mautrix.ChildRoomsChunk, error) {
+	var rooms []*mautrix.ChildRoomsChunk
+	req := &mautrix.ReqHierarchy{}
+	for range maxHierarchyPages {
+		resp, err := m.client.Hierarchy(ctx, spaceID, req)
+		if err != nil {
+			return nil, fmt.Errorf("space hierarchy: %w", err)
+		}
+		rooms = append(rooms, resp.Rooms...)
+		if resp.NextBatch == "" {
+			break
+		}
+		req.From = resp.NextBatch
+	}
+	return rooms, nil
+}
+
+func (m *MatrixSession) buildCategories(
+	spaceID id.RoomID,
+	rooms []*mautrix.ChildRoomsChunk,
+	joined map[id.RoomID]struct{},
+) []models.Category {
+	byID := make(map[id.RoomID]*mautrix.ChildRoomsChunk, len(rooms))
+	for _, room := range rooms {
+		byID[room.RoomID] = room
+	}
+
+	root := models.Category{ID: spaceID.String(), SpaceID: spaceID.String()}
+	if room, ok := byID[spaceID]; ok {
+		root.Name = room.Name
+	}
+	categories := []models.Category{root}
+
+	visited := map[id.RoomID]struct{}{spaceID: {}}
+	var walk func(parent id.RoomID, index int)
+	walk = func(parent id.RoomID, index int) {
+		room, ok := byID[parent]
+		if !ok {
+			return
+		}
+		for _, child := range spaceChildren(room) {
+			info, ok := byID[child.roomID]
+			if !ok {
+				continue
+			}
+			if _, seen := visited[child.roomID]; seen {
+				continue
+			}
+			visited[child.roomID] = struct{}{}
+
+			_, isJoined := joined[child.roomID]
+			name := m.hierarchyRoomName(info, isJoined)
+
+			if info.RoomType == event.RoomTypeSpace {
+				categories = append(categories, models.Category{
+					ID:        child.roomID.String(),
+					Name:      name,
+					SpaceID:   spaceID.String(),
+					ParentID:  parent.String(),
+					Suggested: child.suggested,
+					Joinable:  !isJoined,
+				})
+				walk(child.roomID, len(categories)-1)
+				continue
+			}
+
+			categories[index].Channels = append(categories[index].Channels, models.Channel{
+				ID:         child.roomID.String(),
+				Name:       name,
+				Type:       models.ChannelText,
+				SpaceID:    spaceID.String(),
+				CategoryID: parent.String(),
+				Topic:      info.Topic,
+				Suggested:  child.suggested,
+				Joinable:   !isJoined,
+			})
+		}
+	}
+	walk(spaceID, 0)
+
+	return categories
+}
+
+// spaceChildren lists a space's children in the order the spec gives:
+// children with an order string first, sorted by it, then the rest by when
+// they were added.
+func spaceChildren(room *mautrix.ChildRoomsChunk) []spaceChild {
+	var children []spaceChild
+	for _, evt := range room.ChildrenState {
+		if evt.StateKey == nil {
+			continue
+		}
+		_ = evt.Content.ParseRaw(event.StateSpaceChild)
+		content, ok := evt.Content.Parsed.(*event.SpaceChildEventContent)
+		// a child without via servers has been removed
+		if !ok || len(content.Via) == 0 {
+			continue
+		}
+		children = append(children, spaceChild{
+			roomID:    id.RoomID(*evt.StateKey),
+			order:     content.Order,
+			suggested: content.Suggested,
+			ts:        evt.Timestamp,
+		})
+	}
+
+	slices.SortStableFunc(children, func(a, b spaceChild) int {
+		if (a.order == "") != (b.order == "") {
+			if a.order == "" {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Or(
+			cmp.Compare(a.order, b.order),
+			cmp.Compare(a.ts, b.ts),
+			cmp.Compare(a.roomID, b.roomID),
+		)
+	})
+	return children
+}
+
+func (m *MatrixSession) hierarchyRoomName(info *mautrix.ChildRoomsChunk, joined bool) string {
+	switch {
+	case info.Name != "":
+		return info.Name
+	case joined:
+		return m.getRoomName(info.RoomID)
+	case info.CanonicalAlias != "":
+		return info.CanonicalAlias.String()
+	default:
+		return info.RoomID.String()
+	}
+}
+
+// getSpaceChildren returns every channel in a space, including the ones in
+// its subspaces.
+func (m *MatrixSession) getSpaceChildren(spaceID id.RoomID) ([]models.Channel, error) {
+	categories, err := m.getSpaceCategories(spaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []models.Channel
+	for _, category := range categories {
+		channels = append(channels, category.Channels...)
+	}
+	return channels, nil
+}
+
+// JoinSpaceChild joins a room listed in a space, using the via servers from
+// the space's m.space.child event. A parent that isn't joined can't be
+// read, so the join then relies on the server knowing the room already.
+func (m *MatrixSession) JoinSpaceChild(parentID, childID string) error {
+	ctx := m.context
+
+	var child event.SpaceChildEventContent
+	err := m.client.StateEvent(ctx, id.RoomID(parentID), event.StateSpaceChild, childID, &child)
+	if err != nil {
+		m.logger.Debug("failed to read space child", "parentID", parentID, "childID", childID, "err", err)
+	}
+
+	_, err = m.client.JoinRoom(ctx, childID, &mautrix.ReqJoinRoom{Via: child.Via})
+	if err != nil {
+		return fmt.Errorf("join room: %w", err)
+	}
+
+	m.channelsCache.Clear()
+	m.spacesCache.Invalidate("ls:" + m.id)
+	return nil
+}
@@ -0,0 +1,191 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/arko-chat/arko/internal/models"
+)
+
+// loadIgnoredUsers reads m.ignored_user_list when the session starts. A
+// sync resumed from a stored token doesn't repeat account data, so the
+// list can't be left to the sync handler.
+func (m *MatrixSession) loadIgnoredUsers(ctx context.Context) {
+	var content event.IgnoredUserListEventContent
+	err := m.GetClient().GetAccountData(ctx, event.AccountDataIgnoredUserList.Type, &content)
+	if err != nil && !errors.Is(err, mautrix.MNotFound) {
+		m.logger.Warn("failed to fetch ignored users", "err", err)
+		return
+	}
+	m.applyIgnoredUsers(content.IgnoredUsers)
+}
+
+func (m *MatrixSession) handleIgnoredUsers(evt *event.Event) {
+	if content, ok := evt.Content.Parsed.(*event.IgnoredUserListEventContent); ok {
+		m.applyIgnoredUsers(content.IgnoredUsers)
+	}
+}
+
+// applyIgnoredUsers stores the ignore list and updates everything already
+// on screen: messages and typing notices of newly ignored users go away,
+// and rooms are reloaded when someone is unignored so their messages come
+// back.
+func (m *MatrixSession) applyIgnoredUsers(users map[id.UserID]event.IgnoredUser) {
+	ignored := make(map[string]struct{}, len(users))
+	for userID := range users {
+		ignored[userID.String()] = struct{}{}
+	}
+
+	var previous map[string]struct{}
+	if old := m.ignored.Swap(&ignored); old != nil {
+		previous = *old
+	}
+
+	added := make(map[string]struct{})
+	for userID := range ignored {
+		if _, ok := previous[userID]; !ok {
+			added[userID] = struct{}{}
+		}
+	}
+	unignored := false
+	for userID := range previous {
+		if _, ok := ignored[userID]; !ok {
+			unignored = true
+			break
+		}
+	}
+	if len(added) == 0 && !unignored {
+		return
+	}
+
+	if m.typingTracker != nil {
+		m.typingTracker.SetIgnored(ignored)
+	}
+
+	ctx := m.Context()
+	m.messageTrees.Range(func(_ string, tree *MessageTree) bool {
+		if len(added) > 0 {
+			tree.dropAuthors(added)
+		}
+		if unignored {
+			go tree.reloadUnignored(ctx)
+		}
+		return true
+	})
+
+	go m.notifyInvites()
+}
+
+func (m *MatrixSession) isIgnored(userID string) bool {
+	ignored := m.ignored.Load()
+	if ignored == nil {
+		return false
+	}
+	_, ok := (*ignored)[userID]
+	return ok
+}
+
+// SetUserIgnored adds a user to m.ignored_user_list or removes them from
+// it. The list is read from the server first so changes made by other
+// clients aren't lost.
+func (m *MatrixSession) SetUserIgnored(userID string, ignored bool) error {
+	if userID == m.id {
+		return fmt.Errorf("can't ignore yourself")
+	}
+
+	ctx := m.Context()
+	client := m.GetClient()
+
+	var content event.IgnoredUserListEventContent
+	err := client.GetAccountData(ctx, event.AccountDataIgnoredUserList.Type, &content)
+	if err != nil && !errors.Is(err, mautrix.MNotFound) {
+		return fmt.Errorf("get ignored users: %w", err)
+	}
+	if content.IgnoredUsers == nil {
+		content.IgnoredUsers = make(map[id.UserID]event.IgnoredUser)
+	}
+
+	uid := id.UserID(userID)
+	if _, ok := content.IgnoredUsers[uid]; ok == ignored {
+		m.applyIgnoredUsers(content.IgnoredUsers)
+		return nil
+	}
+	if ignored {
+		content.IgnoredUsers[uid] = event.IgnoredUser{}
+	} else {
+		delete(content.IgnoredUsers, uid)
+	}
+
+	if err := client.SetAccountData(ctx, event.AccountDataIgnoredUserList.Type, &content); err != nil {
+		return fmt.Errorf("set ignored users: %w", err)
+	}
+	m.applyIgnoredUsers(content.IgnoredUsers)
+	return nil
+}
+
+// IgnoredUsers returns the profiles of the ignored users, sorted by name.
+func (m *MatrixSession) IgnoredUsers() []models.User {
+	ignored := m.ignored.Load()
+	if ignored == nil {
+		return nil
+	}
+
+	users := make([]models.User, 0, len(*ignored))
+	for userID := range *ignored {
+		profile, err := m.GetUserProfile(userID)
+		if err != nil {
+			profile = models.User{
+				ID:     userID,
+				Name:   id.UserID(userID).Localpart(),
+				Avatar: resolveContentURI(id.ContentURI{}, id.UserID(userID).Localpart(), "avataaars"),
+			}
+		}
+		users = append(users, profile)
+	}
+	slices.SortFunc(users, func(a, b models.User) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return users
+}
+
+// dropAuthors removes the messages of users who were just ignored.
+func (t *MessageTree) dropAuthors(users map[string]struct{}) {
+	// only taken out of the tree; the search index and timeline cache keep
+	// them for when the user is unignored
+	dropped := t.dropMessages(func(m models.Message) bool {
+		_, ok := users[m.Author.ID]
+		return ok
+	})
+
+	for _, msg := range dropped {
+		t.sendEventToListeners(MessageTreeEvent{
+			Message:   msg,
+			EventType: RemoveEvent,
+		})
+	}
+}
+
+// reloadUnignored fetches the latest page again, since messages of a user
+// who was ignored were never stored.
+func (t *MessageTree) reloadUnignored(ctx context.Context) {
+	if !t.initialized.Load() {
+		return
+	}
+
+	t.populating.Lock()
+	defer t.populating.Unlock()
+
+	t.view.Lock()
+	t.gap = nil
+	t.focus = nil
+	t.view.Unlock()
+
+	t.reloadLatest(ctx)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/arko-chat/arko/internal/models"
+	"github.com/arko-chat/arko/internal/search"
 	"github.com/arko-chat/arko/internal/session"
 	"maunium.net/go/mautrix"
 )
@@ -15,18 +16,44 @@ type SessionClient interface {
 	ListSpaces() ([]models.Space, error)
 	GetSpaceDetail(spaceID string) (models.SpaceDetail, error)
 	GetChannel(spaceID string, channelID string) (models.Channel, error)
+	GetRoomMembers(roomID string) ([]models.User, error)
 	ListDirectMessages() ([]models.User, error)
 	GetDMRoomID(otherUserID string) (string, error)
 	GetMessageTree(roomID string) *MessageTree
 	IsVerified() bool
 	CreateSpace(params CreateSpaceParams) (models.Space, error)
 	CreateChannel(params CreateChannelParams) (models.Channel, error)
+	CreateCategory(params CreateCategoryParams) (models.Category, error)
+	JoinSpaceChild(parentID, childID string) error
+	LeaveSpacePreview(spaceID string) (models.LeaveSpacePreview, error)
+	LeaveSpace(params LeaveSpaceParams) error
+	SearchDirectory(server, query, since string) (models.DirectoryPage, error)
+	JoinRoom(input string, via []string) (string, bool, error)
 	SearchUsers(query string) ([]models.User, error)
 	CreateDMRoom(otherUserID string) (models.User, string, error)
+	ListInvites() []models.Invite
+	AcceptInvite(roomID string) (models.Invite, error)
+	DeclineInvite(roomID string) error
+	InviteEvents() <-chan InviteEvent
+	CloseInviteListener(ch <-chan InviteEvent)
+	SetUserIgnored(userID string, ignored bool) error
+	IgnoredUsers() []models.User
 	GetTypingUsers(roomID string) []string
 	SendTyping(roomID string, typing bool, timeout time.Duration) error
 	TypingEvents() <-chan TypingEvent
 	CloseTypingListener(ch <-chan TypingEvent)
+	UploadLimit() int64
+	EncryptedMedia(ref string) (*EncryptedMedia, bool)
+	StickerPacks() ([]models.StickerPack, error)
+	StickerWidget(roomID string) *models.StickerWidget
+	SearchRoomMembers(roomID, query string, limit int) ([]models.User, error)
+	MarkRead(roomID string) error
+	SearchMessages(q search.Query) ([]models.SearchResult, error)
+	RoomParent(roomID string) (string, string)
+	UnreadEvents() <-chan UnreadEvent
+	CloseUnreadListener(ch <-chan UnreadEvent)
+	NotificationEvents() <-chan NotificationEvent
+	CloseNotificationListener(ch <-chan NotificationEvent)
 }
 
 type VerificationClient interface {
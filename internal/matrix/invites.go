@@ -0,0 +1,344 @@
+package matrix
+
+import (
+	"cmp"
+	"context"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"go.mau.fi/util/dbutil"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/arko-chat/arko/internal/models"
+)
+
+var ErrNotInvited = errors.New("no pending invite for this room")
+
+// InviteEvent carries the pending invites after one arrived or went away.
+type InviteEvent struct {
+	Invites []models.Invite
+}
+
+// inviteStore keeps pending invites across restarts. The sync token is
+// persisted, so an invite is only ever delivered once.
+type inviteStore struct {
+	db      *dbutil.Database
+	aead    cipher.AEAD
+	logger  *slog.Logger
+	invites *xsync.Map[string, models.Invite]
+}
+
+func newInviteStore(ctx context.Context, db *dbutil.Database, pickleKey []byte, logger *slog.Logger) (*inviteStore, error) {
+	s := &inviteStore{
+		logger:  logger,
+		invites: xsync.NewMap[string, models.Invite](),
+	}
+	if db == nil {
+		return s, nil
+	}
+
+	aead, err := storeAEAD(pickleKey, "arko invites")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS arko_invites (
+			room_id TEXT PRIMARY KEY,
+			data    BLOB NOT NULL
+		)`)
+	if err != nil {
+		return nil, fmt.Errorf("create invites table: %w", err)
+	}
+
+	rows, err := db.Query(ctx, `SELECT room_id, data FROM arko_invites`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			roomID string
+			data   []byte
+		)
+		if err := rows.Scan(&roomID, &data); err != nil {
+			return nil, err
+		}
+		var invite models.Invite
+		if err := openRow(aead, roomID, data, &invite); err != nil {
+			logger.Warn("dropping unreadable invite", "roomID", roomID, "err", err)
+			continue
+		}
+		s.invites.Store(roomID, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s.db = db
+	s.aead = aead
+	return s, nil
+}
+
+func (s *inviteStore) put(ctx context.Context, invite models.Invite) {
+	s.invites.Store(invite.RoomID, invite)
+	if s.db == nil {
+		return
+	}
+	data, err := sealRow(s.aead, invite.RoomID, invite)
+	if err == nil {
+		_, err = s.db.Exec(ctx, `
+			INSERT INTO arko_invites (room_id, data) VALUES ($1, $2)
+			ON CONFLICT (room_id) DO UPDATE SET data=excluded.data`,
+			invite.RoomID, data,
+		)
+	}
+	if err != nil {
+		s.logger.Warn("failed to persist invite", "roomID", invite.RoomID, "err", err)
+	}
+}
+
+func (s *inviteStore) remove(ctx context.Context, roomID string) bool {
+	if _, ok := s.invites.LoadAndDelete(roomID); !ok {
+		return false
+	}
+	if s.db == nil {
+		return true
+	}
+	if _, err := s.db.Exec(ctx, `DELETE FROM arko_invites WHERE room_id=$1`, roomID); err != nil {
+		s.logger.Warn("failed to remove invite", "roomID", roomID, "err", err)
+	}
+	return true
+}
+
+func (s *inviteStore) get(roomID string) (models.Invite, bool) {
+	return s.invites.Load(roomID)
+}
+
+// list returns the pending invites, newest first.
+func (s *inviteStore) list() []models.Invite {
+	var invites []models.Invite
+	s.invites.Range(func(_ string, invite models.Invite) bool {
+		invites = append(invites, invite)
+		return true
+	})
+	slices.SortFunc(invites, func(a, b models.Invite) int {
+		return cmp.Or(b.Timestamp.Compare(a.Timestamp), cmp.Compare(a.RoomID, b.RoomID))
+	})
+	return invites
+}
+
+// handleInvites tracks the sync's invite section. It runs before the syncer
+// parses the events, so the stripped state is decoded here from the raw
+// content. An initial sync lists every pending invite, so anything else
+// stored is stale.
+func (m *MatrixSession) handleInvites(ctx context.Context, resp *mautrix.RespSync, since string) bool {
+	changed := false
+
+	if since == "" {
+		for _, invite := range m.invites.list() {
+			if _, ok := resp.Rooms.Invite[id.RoomID(invite.RoomID)]; !ok {
+				changed = m.invites.remove(ctx, invite.RoomID) || changed
+			}
+		}
+	}
+
+	for roomID, room := range resp.Rooms.Invite {
+		invite, ok := m.inviteFromState(roomID, room.State.Events)
+		if !ok {
+			continue
+		}
+		if existing, ok := m.invites.get(invite.RoomID); ok {
+			invite.Timestamp = existing.Timestamp
+		}
+		m.invites.put(ctx, invite)
+		changed = true
+	}
+	for roomID := range resp.Rooms.Join {
+		changed = m.invites.remove(ctx, roomID.String()) || changed
+	}
+	for roomID := range resp.Rooms.Leave {
+		changed = m.invites.remove(ctx, roomID.String()) || changed
+	}
+
+	if changed {
+		go m.notifyInvites()
+	}
+	return true
+}
+
+func (m *MatrixSession) inviteFromState(roomID id.RoomID, events []*event.Event) (models.Invite, bool) {
+	invite := models.Invite{RoomID: roomID.String()}
+
+	var (
+		invited bool
+		alias   id.RoomAlias
+		inviter id.UserID
+		members = make(map[id.UserID]event.MemberEventContent)
+	)
+	for _, evt := range events {
+		raw := evt.Content.VeryRaw
+		switch evt.Type.Type {
+		case event.StateMember.Type:
+			var content event.MemberEventContent
+			if evt.StateKey == nil || json.Unmarshal(raw, &content) != nil {
+				continue
+			}
+			members[id.UserID(*evt.StateKey)] = content
+			if *evt.StateKey == m.id && content.Membership == event.MembershipInvite {
+				invited = true
+				inviter = evt.Sender
+				invite.IsDirect = content.IsDirect
+				if evt.Timestamp > 0 {
+					invite.Timestamp = time.UnixMilli(evt.Timestamp)
+				}
+			}
+		case event.StateRoomName.Type:
+			var content event.RoomNameEventContent
+			if json.Unmarshal(raw, &content) == nil {
+				invite.Name = content.Name
+			}
+		case event.StateRoomAvatar.Type:
+			var content event.RoomAvatarEventContent
+			if json.Unmarshal(raw, &content) == nil {
+				invite.Avatar = string(content.URL)
+			}
+		case event.StateTopic.Type:
+			var content event.TopicEventContent
+			if json.Unmarshal(raw, &content) == nil {
+				invite.Topic = content.Topic
+			}
+		case event.StateCanonicalAlias.Type:
+			var content event.CanonicalAliasEventContent
+			if json.Unmarshal(raw, &content) == nil {
+				alias = content.Alias
+			}
+		case event.StateCreate.Type:
+			var content event.CreateEventContent
+			if json.Unmarshal(raw, &content) == nil {
+				invite.IsSpace = content.Type == event.RoomTypeSpace
+			}
+		}
+	}
+	if !invited {
+		return models.Invite{}, false
+	}
+	if invite.Timestamp.IsZero() {
+		invite.Timestamp = time.Now()
+	}
+
+	member := members[inviter]
+	invite.Inviter = models.User{
+		ID:     inviter.String(),
+		Name:   cmp.Or(member.Displayname, inviter.Localpart()),
+		Avatar: resolveContentURIString(member.AvatarURL, inviter.Localpart(), "avataaars"),
+		Status: models.StatusOffline,
+	}
+
+	switch {
+	case invite.Name != "":
+	case invite.IsDirect:
+		invite.Name = invite.Inviter.Name
+	case alias != "":
+		invite.Name = alias.String()
+	default:
+		invite.Name = roomID.String()
+	}
+
+	if invite.IsDirect && invite.Avatar == "" {
+		invite.Avatar = invite.Inviter.Avatar
+	} else {
+		invite.Avatar = resolveContentURIString(id.ContentURIString(invite.Avatar), roomID.String(), "shapes")
+	}
+	return invite, true
+}
+
+// ListInvites returns the pending invites, leaving out the ones from
+// ignored users.
+func (m *MatrixSession) ListInvites() []models.Invite {
+	return slices.DeleteFunc(m.invites.list(), func(invite models.Invite) bool {
+		return m.isIgnored(invite.Inviter.ID)
+	})
+}
+
+// AcceptInvite joins an invited room. Accepted DMs are added to m.direct
+// so they show up with the inviter's other conversations.
+func (m *MatrixSession) AcceptInvite(roomID string) (models.Invite, error) {
+	invite, ok := m.invites.get(roomID)
+	if !ok {
+		return models.Invite{}, ErrNotInvited
+	}
+
+	ctx := m.Context()
+	if _, err := m.GetClient().JoinRoomByID(ctx, id.RoomID(roomID)); err != nil {
+		return models.Invite{}, fmt.Errorf("join room: %w", err)
+	}
+
+	if invite.IsDirect {
+		if err := m.setDMRoomAccountData(id.UserID(invite.Inviter.ID), id.RoomID(roomID)); err != nil {
+			m.logger.Warn("failed to update m.direct account data", "error", err)
+		}
+		m.dmCache.Invalidate("ldm:" + m.id)
+		m.directCache.Invalidate("dr:" + m.id)
+	}
+	m.spacesCache.Invalidate("ls:" + m.id)
+	m.channelsCache.Clear()
+
+	if m.invites.remove(ctx, roomID) {
+		go m.notifyInvites()
+	}
+	return invite, nil
+}
+
+func (m *MatrixSession) DeclineInvite(roomID string) error {
+	if _, ok := m.invites.get(roomID); !ok {
+		return ErrNotInvited
+	}
+
+	ctx := m.Context()
+	if _, err := m.GetClient().LeaveRoom(ctx, id.RoomID(roomID)); err != nil {
+		return fmt.Errorf("leave room: %w", err)
+	}
+
+	if m.invites.remove(ctx, roomID) {
+		go m.notifyInvites()
+	}
+	return nil
+}
+
+func (m *MatrixSession) InviteEvents() <-chan InviteEvent {
+	ch := make(chan InviteEvent, 16)
+	m.inviteListeners.Store(ch, struct{}{})
+	return ch
+}
+
+func (m *MatrixSession) CloseInviteListener(ch <-chan InviteEvent) {
+	m.inviteListeners.Range(func(listener chan InviteEvent, _ struct{}) bool {
+		if listener == ch {
+			m.inviteListeners.Delete(listener)
+			close(listener)
+			return false
+		}
+		return true
+	})
+}
+
+func (m *MatrixSession) notifyInvites() {
+	evt := InviteEvent{Invites: m.ListInvites()}
+	m.inviteListeners.Range(func(ch chan InviteEvent, _ struct{}) bool {
+		select {
+		case ch <- evt:
+		default:
+		}
+		return true
+	})
+}
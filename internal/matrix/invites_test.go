@@ -0,0 +1,131 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+func strippedEvent(t *testing.T, evtType event.Type, stateKey string, sender id.UserID, content any) *event.Event {
+	t.Helper()
+	raw, err := json.Marshal(map[string]any{
+		"type":      evtType.Type,
+		"state_key": stateKey,
+		"sender":    sender,
+		"content":   content,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var evt event.Event
+	if err := json.Unmarshal(raw, &evt); err != nil {
+		t.Fatal(err)
+	}
+	return &evt
+}
+
+func TestHandleInvites(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	invites, _ := newInviteStore(context.Background(), nil, nil, logger)
+	session := &MatrixSession{
+		id:              "@test:example.com",
+		logger:          logger,
+		invites:         invites,
+		inviteListeners: xsync.NewMap[chan InviteEvent, struct{}](),
+	}
+
+	inviter := id.UserID("@alice:example.com")
+	dmRoom := id.RoomID("!dm:example.com")
+	spaceRoom := id.RoomID("!space:example.com")
+
+	resp := &mautrix.RespSync{}
+	resp.Rooms.Invite = map[id.RoomID]*mautrix.SyncInvitedRoom{
+		dmRoom: {State: mautrix.SyncEventsList{Events: []*event.Event{
+			strippedEvent(t, event.StateMember, inviter.String(), inviter, map[string]any{
+				"membership":  "join",
+				"displayname": "Alice",
+			}),
+			strippedEvent(t, event.StateMember, session.id, inviter, map[string]any{
+				"membership": "invite",
+				"is_direct":  true,
+			}),
+		}}},
+		spaceRoom: {State: mautrix.SyncEventsList{Events: []*event.Event{
+			strippedEvent(t, event.StateCreate, "", inviter, map[string]any{"type": "m.space"}),
+			strippedEvent(t, event.StateRoomName, "", inviter, map[string]any{"name": "Arko"}),
+			strippedEvent(t, event.StateMember, session.id, inviter, map[string]any{
+				"membership": "invite",
+			}),
+		}}},
+	}
+	session.handleInvites(context.Background(), resp, "s1")
+
+	dm, ok := session.invites.get(dmRoom.String())
+	if !ok {
+		t.Fatal("expected DM invite")
+	}
+	if !dm.IsDirect || dm.Name != "Alice" || dm.Inviter.ID != inviter.String() {
+		t.Errorf("unexpected DM invite: %+v", dm)
+	}
+
+	space, ok := session.invites.get(spaceRoom.String())
+	if !ok {
+		t.Fatal("expected space invite")
+	}
+	if !space.IsSpace || space.Name != "Arko" || space.Inviter.Name != "alice" {
+		t.Errorf("unexpected space invite: %+v", space)
+	}
+
+	resp = &mautrix.RespSync{}
+	resp.Rooms.Join = map[id.RoomID]*mautrix.SyncJoinedRoom{dmRoom: {}}
+	session.handleInvites(context.Background(), resp, "s2")
+
+	if _, ok := session.invites.get(dmRoom.String()); ok {
+		t.Error("expected joined room to leave the invites")
+	}
+	if len(session.ListInvites()) != 1 {
+		t.Errorf("expected 1 invite, got %d", len(session.ListInvites()))
+	}
+}
+
+func TestListInvites_IgnoredInviter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	invites, _ := newInviteStore(context.Background(), nil, nil, logger)
+	session := &MatrixSession{
+		id:              "@test:example.com",
+		logger:          logger,
+		context:         context.Background(),
+		invites:         invites,
+		inviteListeners: xsync.NewMap[chan InviteEvent, struct{}](),
+		messageTrees:    xsync.NewMap[string, *MessageTree](),
+		typingTracker:   NewTypingTracker("@test:example.com"),
+	}
+
+	inviter := id.UserID("@spam:example.com")
+	resp := &mautrix.RespSync{}
+	resp.Rooms.Invite = map[id.RoomID]*mautrix.SyncInvitedRoom{
+		"!room:example.com": {State: mautrix.SyncEventsList{Events: []*event.Event{
+			strippedEvent(t, event.StateMember, session.id, inviter, map[string]any{
+				"membership": "invite",
+			}),
+		}}},
+	}
+	session.handleInvites(context.Background(), resp, "s1")
+
+	session.applyIgnoredUsers(map[id.UserID]event.IgnoredUser{inviter: {}})
+	if got := session.ListInvites(); len(got) != 0 {
+		t.Errorf("expected the ignored user's invite to be hidden, got %+v", got)
+	}
+
+	session.applyIgnoredUsers(nil)
+	if got := session.ListInvites(); len(got) != 1 {
+		t.Errorf("expected the invite to come back, got %+v", got)
+	}
+}
@@ -0,0 +1,261 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// timelineGap describes a chunk of history that isn't connected to the live
+// timeline, either because it was loaded around a jump target or because
+// the newer end of the tree was dropped. Backward pagination uses the tree's
+// prevBatch; forward pagination uses the token kept here.
+type timelineGap struct {
+	forward string
+	// newest is the newest event loaded into the chunk. Anything later
+	// belongs to the live timeline and stays out of the window until the
+	// two join.
+	newest time.Time
+	// liveFrom is the oldest live event at the time of the jump.
+	liveFrom time.Time
+}
+
+// JumpToEvent makes sure eventID and the messages around it are loaded,
+// fetching them with /context when they aren't part of the tree yet, and
+// centres the next Chronological on it. It returns the ID of the target
+// message.
+func (t *MessageTree) JumpToEvent(ctx context.Context, eventID string, limit int) (string, error) {
+	messageID := safeHashClass(eventID)
+
+	t.populating.Lock()
+	defer t.populating.Unlock()
+
+	t.view.Lock()
+	msg, loaded := t.messagesMap.Load(messageID)
+	if loaded && !t.gap.hides(*msg) {
+		t.focus = msg
+		t.view.Unlock()
+		return messageID, nil
+	}
+	gap := t.gap
+	t.gap = nil
+	t.view.Unlock()
+
+	// a second disconnected chunk can't be told apart from the first, so
+	// start over from an empty tree
+	if gap != nil {
+		t.dropMessages(func(m models.Message) bool {
+			return !m.IsPending()
+		})
+		t.prevBatchMu.Lock()
+		t.boundaries = t.boundaries[:0]
+		t.prevBatchMu.Unlock()
+	}
+
+	rid := id.RoomID(t.roomID)
+	_, _ = t.matrixSession.keyBackupMgr.RestoreRoomKeys(ctx, rid)
+	resp, threads, err := t.eventContext(ctx, id.EventID(eventID), limit)
+	if err != nil {
+		if gap != nil {
+			t.reloadLatest(ctx)
+		}
+		return "", err
+	}
+
+	chunk := make([]*event.Event, 0, len(resp.EventsBefore)+len(resp.EventsAfter)+1)
+	chunk = append(chunk, resp.EventsBefore...)
+	slices.Reverse(chunk)
+	if resp.Event != nil {
+		chunk = append(chunk, resp.Event)
+	}
+	chunk = append(chunk, resp.EventsAfter...)
+
+	chunkOldest, _ := oldestTimestamp(chunk)
+	chunkNewest, _ := newestTimestamp(chunk)
+
+	t.mu.RLock()
+	oldest, hasLive := t.BTreeG.Min()
+	t.mu.RUnlock()
+
+	gap = &timelineGap{forward: resp.End, newest: chunkNewest}
+	if hasLive {
+		gap.liveFrom = oldest.Timestamp
+	}
+	joined := resp.End == "" || t.reachesLive(gap, chunk)
+
+	t.prevBatchMu.Lock()
+	if !joined {
+		// the live timeline's tokens don't apply to the chunk
+		t.boundaries = t.boundaries[:0]
+	}
+	if resp.Start != "" {
+		t.boundaries = append(t.boundaries, pageBoundary{token: resp.Start, at: chunkOldest})
+	}
+	if resp.End != "" {
+		t.boundaries = append(t.boundaries, pageBoundary{token: resp.End, at: chunkNewest.Add(time.Millisecond)})
+	}
+	// a chunk overlapping the live timeline only helps if it reaches
+	// further back
+	if !joined || !hasLive || chunkOldest.Before(gap.liveFrom) {
+		t.prevBatch = resp.Start
+		t.noMoreHistory.Store(resp.Start == "")
+	}
+	t.prevBatchMu.Unlock()
+
+	t.view.Lock()
+	if !joined {
+		t.gap = gap
+	}
+	t.view.Unlock()
+
+	t.applyChunk(ctx, chunk, threads)
+
+	if msg, ok := t.messagesMap.Load(messageID); ok {
+		t.view.Lock()
+		t.focus = msg
+		t.view.Unlock()
+	}
+	return messageID, nil
+}
+
+// fetchNewer paginates a disconnected chunk forwards and closes the gap once
+// it reaches the live timeline.
+func (t *MessageTree) fetchNewer(ctx context.Context, limit int) {
+	t.view.RLock()
+	gap := t.gap
+	var forward string
+	if gap != nil {
+		forward = gap.forward
+	}
+	t.view.RUnlock()
+	if gap == nil {
+		return
+	}
+
+	resp, threads, err := t.messages(ctx, forward, "", mautrix.DirectionForward, limit)
+	if err != nil {
+		t.matrixSession.logger.Error("failed to get newer messages", "roomID", t.roomID, "error", err)
+		return
+	}
+
+	joined := resp.End == "" || resp.End == forward || t.reachesLive(gap, resp.Chunk)
+
+	newest, ok := newestTimestamp(resp.Chunk)
+	if ok && resp.End != "" {
+		t.prevBatchMu.Lock()
+		t.boundaries = append(t.boundaries, pageBoundary{token: resp.End, at: newest.Add(time.Millisecond)})
+		t.prevBatchMu.Unlock()
+	}
+
+	t.view.Lock()
+	gap.forward = resp.End
+	if ok && newest.After(gap.newest) {
+		gap.newest = newest
+	}
+	t.view.Unlock()
+
+	t.applyChunk(ctx, resp.Chunk, threads)
+
+	if joined {
+		t.view.Lock()
+		t.gap = nil
+		t.view.Unlock()
+	}
+}
+
+func (t *MessageTree) reachesLive(gap *timelineGap, chunk []*event.Event) bool {
+	for _, evt := range chunk {
+		if _, ok := t.messagesMap.Load(safeHashClass(evt.ID.String())); ok {
+			return true
+		}
+		if !gap.liveFrom.IsZero() && !time.UnixMilli(evt.Timestamp).Before(gap.liveFrom) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReturnToPresent drops a chunk that isn't connected to the live timeline
+// and loads the newest messages again.
+func (t *MessageTree) ReturnToPresent(ctx context.Context) {
+	t.populating.Lock()
+	defer t.populating.Unlock()
+
+	t.view.Lock()
+	gap := t.gap
+	t.gap = nil
+	t.focus = nil
+	t.view.Unlock()
+	if gap == nil {
+		return
+	}
+
+	t.reloadLatest(ctx)
+}
+
+func (t *MessageTree) reloadLatest(ctx context.Context) {
+	t.dropMessages(func(m models.Message) bool {
+		return !m.IsPending()
+	})
+
+	t.prevBatchMu.Lock()
+	t.prevBatch = ""
+	t.boundaries = t.boundaries[:0]
+	t.noMoreHistory.Store(false)
+	t.prevBatchMu.Unlock()
+
+	t.fetchOlder(ctx, windowPage)
+}
+
+// eventContext is client.Context, also returning the bundled thread
+// summaries of the events around the target.
+func (t *MessageTree) eventContext(ctx context.Context, eventID id.EventID, limit int) (*mautrix.RespContext, threadSummaries, error) {
+	client := t.matrixSession.GetClient()
+	url := client.BuildURLWithQuery(mautrix.ClientURLPath{"v3", "rooms", t.roomID, "context", eventID}, map[string]string{
+		"limit": strconv.Itoa(limit),
+	})
+
+	var raw struct {
+		Start        string            `json:"start"`
+		End          string            `json:"end"`
+		Event        json.RawMessage   `json:"event"`
+		EventsBefore []json.RawMessage `json:"events_before"`
+		EventsAfter  []json.RawMessage `json:"events_after"`
+	}
+	if _, err := client.MakeRequest(ctx, http.MethodGet, url, nil, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	resp := &mautrix.RespContext{Start: raw.Start, End: raw.End}
+	threads := make(threadSummaries)
+	decode := func(events []json.RawMessage) ([]*event.Event, error) {
+		chunk, summaries, err := decodeChunk(events)
+		maps.Copy(threads, summaries)
+		return chunk, err
+	}
+
+	var err error
+	if resp.EventsBefore, err = decode(raw.EventsBefore); err != nil {
+		return nil, nil, err
+	}
+	if resp.EventsAfter, err = decode(raw.EventsAfter); err != nil {
+		return nil, nil, err
+	}
+	if len(raw.Event) > 0 && string(raw.Event) != "null" {
+		target, err := decode([]json.RawMessage{raw.Event})
+		if err != nil {
+			return nil, nil, err
+		}
+		resp.Event = target[0]
+	}
+	return resp, threads, nil
+}
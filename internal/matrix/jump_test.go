@@ -0,0 +1,264 @@
+package matrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+)
+
+func TestMessageTree_JumpToEvent(t *testing.T) {
+	const roomID = "!room:example.com"
+	base := time.UnixMilli(1700000000000)
+	at := func(i int) time.Time { return base.Add(time.Duration(i) * time.Minute) }
+	evt := func(i int) map[string]any {
+		return map[string]any{
+			"type":             "m.room.message",
+			"event_id":         fmt.Sprintf("$e%d", i),
+			"room_id":          roomID,
+			"sender":           "@alice:example.com",
+			"origin_server_ts": at(i).UnixMilli(),
+			"content":          map[string]any{"msgtype": "m.text", "body": "hello"},
+		}
+	}
+	evts := func(is ...int) []map[string]any {
+		out := make([]map[string]any, 0, len(is))
+		for _, i := range is {
+			out = append(out, evt(i))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name           string
+		target         int
+		context        map[string]any
+		wantMessages   []int
+		wantGap        *timelineGap
+		wantPrev       string
+		wantBoundaries []pageBoundary
+	}{
+		{
+			name:           "target already loaded",
+			target:         12,
+			wantMessages:   []int{10, 11, 12, 13, 14},
+			wantPrev:       "live",
+			wantBoundaries: []pageBoundary{{token: "live-12", at: at(12)}},
+		},
+		{
+			name:   "chunk overlapping the live timeline",
+			target: 8,
+			context: map[string]any{
+				"start":         "s",
+				"end":           "e",
+				"event":         evt(8),
+				"events_before": evts(7, 6),
+				"events_after":  evts(9, 10),
+			},
+			wantMessages: []int{6, 7, 8, 9, 10, 11, 12, 13, 14},
+			wantPrev:     "s",
+			wantBoundaries: []pageBoundary{
+				{token: "live-12", at: at(12)},
+				{token: "s", at: at(6)},
+				{token: "e", at: at(10).Add(time.Millisecond)},
+			},
+		},
+		{
+			name:   "disconnected chunk",
+			target: 3,
+			context: map[string]any{
+				"start":         "s",
+				"end":           "e",
+				"event":         evt(3),
+				"events_before": evts(2),
+				"events_after":  evts(4),
+			},
+			wantMessages: []int{2, 3, 4, 10, 11, 12, 13, 14},
+			wantGap:      &timelineGap{forward: "e", newest: at(4), liveFrom: at(10)},
+			wantPrev:     "s",
+			wantBoundaries: []pageBoundary{
+				{token: "s", at: at(2)},
+				{token: "e", at: at(4).Add(time.Millisecond)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockMatrixServer()
+			defer server.Close()
+
+			server.mux.HandleFunc("/_matrix/client/v3/rooms/", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if tt.context == nil || r.URL.Path != fmt.Sprintf("/_matrix/client/v3/rooms/%s/context/$e%d", roomID, tt.target) {
+					t.Errorf("unexpected request to %s", r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(map[string]any{"errcode": "M_NOT_FOUND"})
+					return
+				}
+				json.NewEncoder(w).Encode(tt.context)
+			})
+
+			tree := newMessageTree(newTestMatrixSessionWithServer(server), roomID)
+			for i := 10; i < 15; i++ {
+				tree.set(models.Message{
+					ID:        safeHashClass(fmt.Sprintf("$e%d", i)),
+					EventID:   fmt.Sprintf("$e%d", i),
+					Author:    models.User{ID: "@alice:example.com"},
+					Content:   "hello",
+					Timestamp: at(i),
+				}, false)
+			}
+			tree.prevBatch = "live"
+			tree.boundaries = []pageBoundary{{token: "live-12", at: at(12)}}
+
+			messageID, err := tree.JumpToEvent(t.Context(), fmt.Sprintf("$e%d", tt.target), 10)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if want := safeHashClass(fmt.Sprintf("$e%d", tt.target)); messageID != want {
+				t.Errorf("expected message %s, got %s", want, messageID)
+			}
+			if tree.focus == nil || tree.focus.ID != messageID {
+				t.Errorf("expected the target to be focused, got %v", tree.focus)
+			}
+
+			if tree.Len() != len(tt.wantMessages) {
+				t.Errorf("expected %d messages, got %d", len(tt.wantMessages), tree.Len())
+			}
+			for _, i := range tt.wantMessages {
+				if _, ok := tree.GetMessage(safeHashClass(fmt.Sprintf("$e%d", i))); !ok {
+					t.Errorf("expected $e%d to be loaded", i)
+				}
+			}
+
+			switch {
+			case tt.wantGap == nil && tree.gap != nil:
+				t.Errorf("expected no gap, got %+v", *tree.gap)
+			case tt.wantGap != nil && tree.gap == nil:
+				t.Errorf("expected gap %+v, got none", *tt.wantGap)
+			case tt.wantGap != nil && *tree.gap != *tt.wantGap:
+				t.Errorf("expected gap %+v, got %+v", *tt.wantGap, *tree.gap)
+			}
+			if tree.prevBatch != tt.wantPrev {
+				t.Errorf("expected prevBatch %q, got %q", tt.wantPrev, tree.prevBatch)
+			}
+			if !slices.EqualFunc(tree.boundaries, tt.wantBoundaries, func(a, b pageBoundary) bool {
+				return a.token == b.token && a.at.Equal(b.at)
+			}) {
+				t.Errorf("expected boundaries %v, got %v", tt.wantBoundaries, tree.boundaries)
+			}
+		})
+	}
+}
+
+func TestMessageTree_FetchNewer(t *testing.T) {
+	const roomID = "!room:example.com"
+	base := time.UnixMilli(1700000000000)
+	at := func(i int) time.Time { return base.Add(time.Duration(i) * time.Minute) }
+	evts := func(is ...int) []map[string]any {
+		out := make([]map[string]any, 0, len(is))
+		for _, i := range is {
+			out = append(out, map[string]any{
+				"type":             "m.room.message",
+				"event_id":         fmt.Sprintf("$e%d", i),
+				"room_id":          roomID,
+				"sender":           "@alice:example.com",
+				"origin_server_ts": at(i).UnixMilli(),
+				"content":          map[string]any{"msgtype": "m.text", "body": "hello"},
+			})
+		}
+		return out
+	}
+
+	tests := []struct {
+		name           string
+		page           map[string]any
+		wantGap        *timelineGap
+		wantBoundaries []pageBoundary
+	}{
+		{
+			name: "page still short of the live timeline",
+			page: map[string]any{"start": "e", "end": "f", "chunk": evts(5, 6)},
+			wantGap: &timelineGap{
+				forward:  "f",
+				newest:   at(6),
+				liveFrom: at(10),
+			},
+			wantBoundaries: []pageBoundary{
+				{token: "e", at: at(4).Add(time.Millisecond)},
+				{token: "f", at: at(6).Add(time.Millisecond)},
+			},
+		},
+		{
+			name: "page reaching a live message closes the gap",
+			page: map[string]any{"start": "e", "end": "f", "chunk": evts(5, 6, 7, 8, 9, 10)},
+			wantBoundaries: []pageBoundary{
+				{token: "e", at: at(4).Add(time.Millisecond)},
+				{token: "f", at: at(10).Add(time.Millisecond)},
+			},
+		},
+		{
+			name: "end of the room closes the gap",
+			page: map[string]any{"start": "e", "chunk": evts(5, 6)},
+			wantBoundaries: []pageBoundary{
+				{token: "e", at: at(4).Add(time.Millisecond)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockMatrixServer()
+			defer server.Close()
+
+			server.mux.HandleFunc("/_matrix/client/v3/rooms/"+roomID+"/messages", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if q := r.URL.Query(); q.Get("from") != "e" || q.Get("dir") != "f" {
+					t.Errorf("expected to paginate forwards from e, got %s", r.URL.RawQuery)
+				}
+				json.NewEncoder(w).Encode(tt.page)
+			})
+
+			tree := newMessageTree(newTestMatrixSessionWithServer(server), roomID)
+			for _, i := range []int{2, 3, 4, 10, 11, 12} {
+				tree.set(models.Message{
+					ID:        safeHashClass(fmt.Sprintf("$e%d", i)),
+					EventID:   fmt.Sprintf("$e%d", i),
+					Author:    models.User{ID: "@alice:example.com"},
+					Content:   "hello",
+					Timestamp: at(i),
+				}, false)
+			}
+			tree.prevBatch = "s"
+			tree.boundaries = []pageBoundary{{token: "e", at: at(4).Add(time.Millisecond)}}
+			tree.gap = &timelineGap{forward: "e", newest: at(4), liveFrom: at(10)}
+
+			tree.fetchNewer(t.Context(), 10)
+
+			for _, evt := range tt.page["chunk"].([]map[string]any) {
+				if _, ok := tree.GetMessage(safeHashClass(evt["event_id"].(string))); !ok {
+					t.Errorf("expected %s to be loaded", evt["event_id"])
+				}
+			}
+
+			switch {
+			case tt.wantGap == nil && tree.gap != nil:
+				t.Errorf("expected no gap, got %+v", *tree.gap)
+			case tt.wantGap != nil && tree.gap == nil:
+				t.Errorf("expected gap %+v, got none", *tt.wantGap)
+			case tt.wantGap != nil && *tree.gap != *tt.wantGap:
+				t.Errorf("expected gap %+v, got %+v", *tt.wantGap, *tree.gap)
+			}
+			if !slices.EqualFunc(tree.boundaries, tt.wantBoundaries, func(a, b pageBoundary) bool {
+				return a.token == b.token && a.at.Equal(b.at)
+			}) {
+				t.Errorf("expected boundaries %v, got %v", tt.wantBoundaries, tree.boundaries)
+			}
+		})
+	}
+}
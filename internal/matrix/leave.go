@@ -0,0 +1,162 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/arko-chat/arko/internal/models"
+)
+
+// adminLevel is the power level the default presets give room creators.
+const adminLevel = 100
+
+type LeaveSpaceParams struct {
+	SpaceID string
+	// LeaveChildren also leaves every joined room and subspace in the
+	// space's hierarchy.
+	LeaveChildren bool
+	Forget        bool
+}
+
+// LeaveSpacePreview lists the joined rooms below a space and the rooms in
+// which the user is the last admin.
+func (m *MatrixSession) LeaveSpacePreview(spaceID string) (models.LeaveSpacePreview, error) {
+	ctx := m.Context()
+	preview := models.LeaveSpacePreview{
+		SpaceID: spaceID,
+		Name:    m.getRoomName(id.RoomID(spaceID)),
+	}
+
+	children, err := m.joinedSpaceChildren(ctx, id.RoomID(spaceID))
+	if err != nil {
+		return preview, err
+	}
+	preview.Children = children
+
+	if m.isLastAdmin(ctx, id.RoomID(spaceID)) {
+		preview.LastAdmin = append(preview.LastAdmin, preview.Name)
+	}
+	for _, child := range children {
+		if m.isLastAdmin(ctx, id.RoomID(child.ID)) {
+			preview.LastAdmin = append(preview.LastAdmin, child.Name)
+		}
+	}
+	return preview, nil
+}
+
+// joinedSpaceChildren walks the whole hierarchy rather than the cached
+// categories, which only hold what the sidebar shows.
+func (m *MatrixSession) joinedSpaceChildren(ctx context.Context, spaceID id.RoomID) ([]models.Channel, error) {
+	rooms, err := m.fetchHierarchy(ctx, spaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	joined, err := m.GetClient().JoinedRooms(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("joined rooms: %w", err)
+	}
+	isJoined := make(map[id.RoomID]struct{}, len(joined.JoinedRooms))
+	for _, roomID := range joined.JoinedRooms {
+		isJoined[roomID] = struct{}{}
+	}
+
+	var children []models.Channel
+	for _, room := range rooms {
+		if room.RoomID == spaceID {
+			continue
+		}
+		if _, ok := isJoined[room.RoomID]; !ok {
+			continue
+		}
+		children = append(children, models.Channel{
+			ID:      room.RoomID.String(),
+			Name:    m.hierarchyRoomName(room, true),
+			SpaceID: spaceID.String(),
+		})
+	}
+	return children, nil
+}
+
+// isLastAdmin reports whether the user is an admin of a room that no other
+// joined member could administer after they leave.
+func (m *MatrixSession) isLastAdmin(ctx context.Context, roomID id.RoomID) bool {
+	client := m.GetClient()
+
+	var pl event.PowerLevelsEventContent
+	if err := client.StateEvent(ctx, roomID, event.StatePowerLevels, "", &pl); err != nil {
+		return false
+	}
+	if pl.GetUserLevel(id.UserID(m.id)) < adminLevel {
+		return false
+	}
+
+	members, err := client.JoinedMembers(ctx, roomID)
+	if err != nil {
+		return false
+	}
+	for userID := range members.Joined {
+		if userID.String() != m.id && pl.GetUserLevel(userID) >= adminLevel {
+			return false
+		}
+	}
+	return true
+}
+
+// LeaveSpace leaves a space, and its joined children if asked. Children are
+// left first, so a failure leaves the space in place to try again from.
+func (m *MatrixSession) LeaveSpace(params LeaveSpaceParams) error {
+	ctx := m.Context()
+	spaceID := id.RoomID(params.SpaceID)
+
+	var rooms []id.RoomID
+	if params.LeaveChildren {
+		children, err := m.joinedSpaceChildren(ctx, spaceID)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			rooms = append(rooms, id.RoomID(child.ID))
+		}
+	}
+
+	var errs []error
+	for _, roomID := range rooms {
+		if err := m.leaveRoom(ctx, roomID, params.Forget); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		if err := m.leaveRoom(ctx, spaceID, params.Forget); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	m.spacesCache.Invalidate("ls:" + m.id)
+	m.channelsCache.Clear()
+
+	return errors.Join(errs...)
+}
+
+func (m *MatrixSession) leaveRoom(ctx context.Context, roomID id.RoomID, forget bool) error {
+	client := m.GetClient()
+
+	if _, err := client.LeaveRoom(ctx, roomID); err != nil {
+		return fmt.Errorf("leave %s: %w", roomID, err)
+	}
+	if forget {
+		if _, err := client.ForgetRoom(ctx, roomID); err != nil {
+			return fmt.Errorf("forget %s: %w", roomID, err)
+		}
+	}
+
+	if tree, ok := m.messageTrees.LoadAndDelete(roomID.String()); ok {
+		tree.Close()
+	}
+	m.readStates.Delete(roomID.String())
+	return nil
+}
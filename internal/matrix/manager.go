@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"sync/atomic"
 	"time"
 
@@ -28,6 +29,9 @@ type Manager struct {
 	logger       *slog.Logger
 	cryptoDBPath string
 	sentMsgIds   *lru.Cache[string, struct{}]
+	// timelineCacheLimit is how many messages per room are kept on disk;
+	// zero uses the default and a negative value turns the cache off
+	timelineCacheLimit int
 
 	matrixSessions *xsync.Map[string, *MatrixSession]
 	currSession    atomic.Pointer[MatrixSession]
@@ -37,16 +41,18 @@ type Manager struct {
 func NewManager(
 	logger *slog.Logger,
 	cryptoDBPath string,
+	timelineCacheLimit int,
 ) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 	newLru, _ := lru.New[string, struct{}](50)
 	m := &Manager{
-		ctx:            ctx,
-		cancel:         cancel,
-		logger:         logger,
-		cryptoDBPath:   cryptoDBPath,
-		sentMsgIds:     newLru,
-		matrixSessions: xsync.NewMap[string, *MatrixSession](),
+		ctx:                ctx,
+		cancel:             cancel,
+		logger:             logger,
+		cryptoDBPath:       cryptoDBPath,
+		sentMsgIds:         newLru,
+		timelineCacheLimit: timelineCacheLimit,
+		matrixSessions:     xsync.NewMap[string, *MatrixSession](),
 	}
 
 	m.restoreAllSessions()
@@ -281,6 +287,10 @@ func (m *Manager) Logout(ctx context.Context, userID string) error {
 	mSess.GetClient().Logout(ctx)
 	mSess.Close()
 	session.Delete(userID)
+
+	dbPath, searchPath := m.storePaths(userID)
+	removeStoreFiles(dbPath)
+	_ = os.Remove(searchPath)
 	return nil
 }
 
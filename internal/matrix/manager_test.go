@@ -12,7 +12,7 @@ func TestNewManager(t *testing.T) {
 		Level: slog.LevelDebug,
 	}))
 
-	mgr := NewManager(logger, t.TempDir())
+	mgr := NewManager(logger, t.TempDir(), 0)
 	if mgr == nil {
 		t.Fatal("expected manager, got nil")
 	}
@@ -29,7 +29,7 @@ func TestManager_HasClient_NonexistentUser(t *testing.T) {
 		Level: slog.LevelDebug,
 	}))
 
-	mgr := NewManager(logger, t.TempDir())
+	mgr := NewManager(logger, t.TempDir(), 0)
 	defer mgr.Shutdown()
 
 	if mgr.HasClient("@definitely_does_not_exist_12345:example.com") {
@@ -42,7 +42,7 @@ func TestManager_GetClient_NonexistentUser(t *testing.T) {
 		Level: slog.LevelDebug,
 	}))
 
-	mgr := NewManager(logger, t.TempDir())
+	mgr := NewManager(logger, t.TempDir(), 0)
 	defer mgr.Shutdown()
 
 	client, err := mgr.GetClient("@definitely_does_not_exist_12345:example.com")
@@ -59,7 +59,7 @@ func TestManager_GetMatrixSession_NonexistentUser(t *testing.T) {
 		Level: slog.LevelDebug,
 	}))
 
-	mgr := NewManager(logger, t.TempDir())
+	mgr := NewManager(logger, t.TempDir(), 0)
 	defer mgr.Shutdown()
 
 	sess := mgr.GetMatrixSession("@definitely_does_not_exist_12345:example.com")
@@ -73,7 +73,7 @@ func TestManager_GetVerificationState_NonexistentUser(t *testing.T) {
 		Level: slog.LevelDebug,
 	}))
 
-	mgr := NewManager(logger, t.TempDir())
+	mgr := NewManager(logger, t.TempDir(), 0)
 	defer mgr.Shutdown()
 
 	state := mgr.GetVerificationState("@definitely_does_not_exist_12345:example.com")
@@ -87,7 +87,7 @@ func TestManager_Shutdown_Idempotent(t *testing.T) {
 		Level: slog.LevelDebug,
 	}))
 
-	mgr := NewManager(logger, t.TempDir())
+	mgr := NewManager(logger, t.TempDir(), 0)
 
 	mgr.Shutdown()
 	mgr.Shutdown()
@@ -0,0 +1,139 @@
+package matrix
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix/crypto/attachment"
+	"maunium.net/go/mautrix/event"
+)
+
+var ErrMediaHashMismatch = errors.New("encrypted media hash mismatch")
+
+// EncryptedMedia is what the media proxy needs to serve an encrypted file.
+// It is looked up by an opaque reference so the key never ends up in a URL.
+type EncryptedMedia struct {
+	Path     string
+	MimeType string
+	file     attachment.EncryptedFile
+}
+
+func NewEncryptedMedia(path, mimeType string, file attachment.EncryptedFile) *EncryptedMedia {
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return &EncryptedMedia{Path: path, MimeType: mimeType, file: file}
+}
+
+func (m *MatrixSession) registerEncryptedMedia(file *event.EncryptedFileInfo, mimeType string) string {
+	uri, err := file.URL.Parse()
+	if err != nil || uri.IsEmpty() {
+		return ""
+	}
+
+	ref := encryptedMediaRef(file)
+	m.encryptedMedia.Store(ref, NewEncryptedMedia(mxcToHTTP(uri), mimeType, file.EncryptedFile))
+	return ref
+}
+
+// encryptedMediaRef covers the key as well as the URI, so the same file
+// shared again with a different key can't replace the first one.
+func encryptedMediaRef(file *event.EncryptedFileInfo) string {
+	h := sha256.New()
+	h.Write([]byte(file.URL))
+	h.Write([]byte{0})
+	h.Write([]byte(file.Key.Key))
+	h.Write([]byte{0})
+	h.Write([]byte(file.InitVector))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// forgetEncryptedMedia drops the keys of a message's attachments once the
+// message is no longer held by any tree.
+func (m *MatrixSession) forgetEncryptedMedia(msg models.Message) {
+	for _, a := range msg.Attachments {
+		if ref := attachmentRef(a.URL); ref != "" {
+			m.encryptedMedia.Delete(ref)
+		}
+	}
+}
+
+func (m *MatrixSession) EncryptedMedia(ref string) (*EncryptedMedia, bool) {
+	return m.encryptedMedia.Load(ref)
+}
+
+func (e *EncryptedMedia) expectedHash() ([]byte, error) {
+	if e.file.Hashes.SHA256 == "" {
+		return nil, ErrMediaHashMismatch
+	}
+	return base64.RawStdEncoding.DecodeString(trimPadding(e.file.Hashes.SHA256))
+}
+
+func trimPadding(s string) string {
+	for len(s) > 0 && s[len(s)-1] == '=' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// Decrypt verifies and decrypts data in place.
+func (e *EncryptedMedia) Decrypt(data []byte) error {
+	expected, err := e.expectedHash()
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(sum[:], expected) {
+		return ErrMediaHashMismatch
+	}
+
+	file := e.file
+	return file.DecryptInPlace(data)
+}
+
+// DecryptStream spools the ciphertext to a temporary file so the hash can be
+// checked before any plaintext is written to w.
+func (e *EncryptedMedia) DecryptStream(w io.Writer, r io.Reader) error {
+	expected, err := e.expectedHash()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "arko-media-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), r); err != nil {
+		return fmt.Errorf("read media: %w", err)
+	}
+	if !bytes.Equal(hash.Sum(nil), expected) {
+		return ErrMediaHashMismatch
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// DecryptStream expects the keys to be decoded already
+	file := e.file
+	if err := file.PrepareForDecryption(); err != nil {
+		return err
+	}
+	plain := file.DecryptStream(tmp)
+	defer plain.Close()
+
+	_, err = io.Copy(w, plain)
+	return err
+}
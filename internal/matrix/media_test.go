@@ -0,0 +1,90 @@
+package matrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"maunium.net/go/mautrix/crypto/attachment"
+)
+
+func TestEncryptedMedia_Decrypt(t *testing.T) {
+	plaintext := []byte("a picture of a cat")
+
+	tests := []struct {
+		name    string
+		tamper  func(file *attachment.EncryptedFile, ciphertext []byte) []byte
+		wantErr error
+	}{
+		{
+			name: "valid ciphertext",
+		},
+		{
+			name: "tampered ciphertext",
+			tamper: func(_ *attachment.EncryptedFile, ciphertext []byte) []byte {
+				ciphertext[0] ^= 0xff
+				return ciphertext
+			},
+			wantErr: ErrMediaHashMismatch,
+		},
+		{
+			name: "truncated ciphertext",
+			tamper: func(_ *attachment.EncryptedFile, ciphertext []byte) []byte {
+				return ciphertext[:len(ciphertext)-1]
+			},
+			wantErr: ErrMediaHashMismatch,
+		},
+		{
+			name: "missing hash",
+			tamper: func(file *attachment.EncryptedFile, ciphertext []byte) []byte {
+				file.Hashes.SHA256 = ""
+				return ciphertext
+			},
+			wantErr: ErrMediaHashMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := attachment.NewEncryptedFile()
+			ciphertext := sent.Encrypt(plaintext)
+
+			// the keys arrive as JSON, without the decoded copy the sender has
+			data, _ := json.Marshal(sent)
+			var file attachment.EncryptedFile
+			if err := json.Unmarshal(data, &file); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if tt.tamper != nil {
+				ciphertext = tt.tamper(&file, ciphertext)
+			}
+			media := NewEncryptedMedia("/_matrix/client/v1/media/download/example.com/abc", "image/png", file)
+
+			t.Run("in place", func(t *testing.T) {
+				data := bytes.Clone(ciphertext)
+				err := media.Decrypt(data)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				if err == nil && !bytes.Equal(data, plaintext) {
+					t.Errorf("expected %q, got %q", plaintext, data)
+				}
+			})
+
+			t.Run("streamed", func(t *testing.T) {
+				var out bytes.Buffer
+				err := media.DecryptStream(&out, bytes.NewReader(ciphertext))
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				if err != nil && out.Len() > 0 {
+					t.Errorf("expected no plaintext to be written, got %d bytes", out.Len())
+				}
+				if err == nil && !bytes.Equal(out.Bytes(), plaintext) {
+					t.Errorf("expected %q, got %q", plaintext, out.Bytes())
+				}
+			})
+		})
+	}
+}
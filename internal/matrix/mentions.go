@@ -0,0 +1,165 @@
+package matrix
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+var mxidPattern = regexp.MustCompile(`@[a-zA-Z0-9._=/+-]+:[a-zA-Z0-9.-]+(?::[0-9]+)?`)
+
+const roomMention = "@room"
+
+func matrixToURL(userID string) string {
+	return "https://matrix.to/#/" + userID
+}
+
+func (m *MatrixSession) SearchRoomMembers(roomID, query string, limit int) ([]models.User, error) {
+	members, err := m.getRoomMembers(id.RoomID(roomID))
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(strings.TrimPrefix(query, "@"))
+
+	type candidate struct {
+		user models.User
+		rank int
+	}
+
+	var candidates []candidate
+	for _, u := range members {
+		if u.ID == m.id {
+			continue
+		}
+
+		name := strings.ToLower(u.Name)
+		userID := strings.ToLower(strings.TrimPrefix(u.ID, "@"))
+
+		rank := -1
+		switch {
+		case query == "":
+			rank = 2
+		case strings.HasPrefix(name, query), strings.HasPrefix(userID, query):
+			rank = 0
+		case strings.Contains(name, query), strings.Contains(userID, query):
+			rank = 1
+		}
+		if rank >= 0 {
+			candidates = append(candidates, candidate{user: u, rank: rank})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].rank != candidates[j].rank {
+			return candidates[i].rank < candidates[j].rank
+		}
+		return strings.ToLower(candidates[i].user.Name) < strings.ToLower(candidates[j].user.Name)
+	})
+
+	users := make([]models.User, 0, min(limit, len(candidates)))
+	for _, c := range candidates[:min(limit, len(candidates))] {
+		users = append(users, c.user)
+	}
+	return users, nil
+}
+
+// resolveMentions finds user IDs and @room in a message body. It returns the
+// plain body with IDs replaced by display names, the Markdown source with
+// matrix.to pills for formatted_body, and the matching m.mentions.
+func (t *MessageTree) resolveMentions(body string) (string, string, *event.Mentions) {
+	mentions := &event.Mentions{}
+
+	members, err := t.matrixSession.getRoomMembers(id.RoomID(t.roomID))
+	if err != nil {
+		t.matrixSession.logger.Debug("failed to load members for mentions", "roomID", t.roomID, "err", err)
+	}
+
+	names := make(map[string]string, len(members))
+	for _, u := range members {
+		names[u.ID] = u.Name
+	}
+
+	var plain, source strings.Builder
+	last := 0
+	for _, loc := range mxidPattern.FindAllStringIndex(body, -1) {
+		userID := body[loc[0]:loc[1]]
+		name, ok := names[userID]
+		if !ok {
+			continue
+		}
+
+		plain.WriteString(body[last:loc[0]])
+		plain.WriteString(name)
+		source.WriteString(body[last:loc[0]])
+		fmt.Fprintf(&source, "[%s](%s)", escapeMarkdownLink(name), matrixToURL(userID))
+		last = loc[1]
+
+		mentions.Add(id.UserID(userID))
+	}
+	plain.WriteString(body[last:])
+	source.WriteString(body[last:])
+
+	if containsWord(body, roomMention) {
+		mentions.Room = true
+	}
+
+	return plain.String(), source.String(), mentions
+}
+
+func escapeMarkdownLink(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(text)
+}
+
+func containsWord(body, word string) bool {
+	for i := 0; ; {
+		idx := strings.Index(body[i:], word)
+		if idx < 0 {
+			return false
+		}
+		start, end := i+idx, i+idx+len(word)
+		if (start == 0 || !isWordChar(body[start-1])) && (end == len(body) || !isWordChar(body[end])) {
+			return true
+		}
+		i = end
+	}
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '-' || c == ':' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// textContent builds the content for an outgoing text message, including
+// pills, m.mentions and the Markdown formatted body.
+func (t *MessageTree) textContent(body string) *event.MessageEventContent {
+	plain, source, mentions := t.resolveMentions(body)
+
+	content := &event.MessageEventContent{
+		MsgType:  event.MsgText,
+		Body:     plain,
+		Mentions: mentions,
+	}
+	setFormattedBody(content, source)
+	return content
+}
+
+// mentionsUser reports whether an incoming message mentions userID. Messages
+// without m.mentions fall back to looking for the ID or display name.
+func mentionsUser(content *event.MessageEventContent, userID string, displayName string) bool {
+	if content.Mentions != nil {
+		return content.Mentions.Room || content.Mentions.Has(id.UserID(userID))
+	}
+
+	body := strings.ToLower(content.Body)
+	if strings.Contains(body, strings.ToLower(userID)) ||
+		strings.Contains(content.FormattedBody, matrixToURL(userID)) {
+		return true
+	}
+	return displayName != "" && containsWord(body, strings.ToLower(displayName))
+}
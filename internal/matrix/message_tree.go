@@ -1,10 +1,9 @@
-// TODO: implement a "view-only" data structure to ensure only a specific number of messages are in the DOM at a time
-
 // Package matrix provides Matrix protocol client functionality.
 //
 // This file (message_tree.go) contains the MessageTree which handles:
 // - Thread-safe message storage using BTree
 // - Message loading and pagination
+// - The window of messages rendered in the DOM
 // - Encryption/decryption handling
 // - Real-time event listening
 // - URL embed fetching
@@ -13,8 +12,11 @@ package matrix
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -41,6 +43,19 @@ type MessageTree struct {
 
 	rawEncryptedEvents *xsync.Map[string, *event.Event]
 
+	reactions *reactionIndex
+	edits     *editIndex
+
+	threads       *xsync.Map[string, *Thread]
+	threadReplies *xsync.Map[string, string]
+
+	// dropped lists the messages that left the tree but still have their
+	// relations indexed, oldest first. Guarded by mu.
+	dropped []string
+
+	replyPreviews *xsync.Map[string, models.ReplyPreview]
+	replyWaiters  *xsync.Map[string, []string]
+
 	matrixSession *MatrixSession
 
 	evtListenerId atomic.Uint64
@@ -50,8 +65,14 @@ type MessageTree struct {
 	listenerCancel context.CancelFunc
 	listenerCh     chan MessageTreeEvent
 
-	roomID      string
-	isEncrypted bool
+	roomID string
+	// encryptionKnown is unset while the room's encryption state couldn't
+	// be looked up, e.g. when the tree was created offline
+	isEncrypted     atomic.Bool
+	encryptionKnown atomic.Bool
+
+	powerLevels atomic.Pointer[event.PowerLevelsEventContent]
+	pinned      atomic.Pointer[[]id.EventID]
 
 	embedCache *cache.Cache[[]models.Embed]
 
@@ -60,8 +81,17 @@ type MessageTree struct {
 	prevBatch     string
 	prevBatchMu   sync.RWMutex
 	noMoreHistory atomic.Bool
+	boundaries    []pageBoundary
+
+	view   sync.RWMutex
+	window messageWindow
+	gap    *timelineGap
+	focus  *models.Message
 
 	populating sync.Mutex
+	// trimming is set while a trimLiveWindow is queued, so a burst of live
+	// messages only starts one
+	trimming atomic.Bool
 
 	wg sync.WaitGroup
 }
@@ -72,6 +102,9 @@ const (
 	AddEvent MessageTreeEventType = iota
 	RemoveEvent
 	UpdateEvent
+	// EvictEvent removes messages that scrolled out of the window from the
+	// DOM; they stay in the tree.
+	EvictEvent
 )
 
 type MessageTreeEvent struct {
@@ -79,6 +112,10 @@ type MessageTreeEvent struct {
 	UpdateNonce string
 	Message     models.Message
 	Neighbors   Neighbors
+	ThreadID    string
+	Evicted     []models.Message
+	// Newer is set when an EvictEvent trimmed the newer end of the window.
+	Newer bool
 }
 
 type Neighbors struct {
@@ -103,13 +140,48 @@ func newMessageTree(mxSession *MatrixSession, roomID string) *MessageTree {
 		pendingRedactions:  xsync.NewMap[string, *event.Event](),
 		nonces:             xsync.NewMap[string, *models.Message](),
 		rawEncryptedEvents: xsync.NewMap[string, *event.Event](),
+		reactions:          newReactionIndex(),
+		edits:              newEditIndex(),
+		threads:            xsync.NewMap[string, *Thread](),
+		threadReplies:      xsync.NewMap[string, string](),
+		replyPreviews:      xsync.NewMap[string, models.ReplyPreview](),
+		replyWaiters:       xsync.NewMap[string, []string](),
 		roomID:             roomID,
 		embedCache:         cache.New[[]models.Embed](24 * time.Hour),
 	}
 }
 
 func (t *MessageTree) IsE2EE() bool {
-	return t.isEncrypted
+	return t.isEncrypted.Load()
+}
+
+// lookupEncryption fetches the room's encryption state, falling back to the
+// state store when the server can't be reached. It reports whether the
+// state is known.
+func (t *MessageTree) lookupEncryption(ctx context.Context) bool {
+	client := t.matrixSession.GetClient()
+	rid := id.RoomID(t.roomID)
+
+	var encEvt event.EncryptionEventContent
+	err := client.StateEvent(ctx, rid, event.StateEncryption, "", &encEvt)
+	switch {
+	case err == nil:
+		t.isEncrypted.Store(encEvt.Algorithm != "")
+	case errors.Is(err, mautrix.MNotFound):
+		t.isEncrypted.Store(false)
+	default:
+		// the store can only confirm that a room is encrypted
+		if client.StateStore == nil {
+			return t.encryptionKnown.Load()
+		}
+		encrypted, storeErr := client.StateStore.IsEncrypted(ctx, rid)
+		if storeErr != nil || !encrypted {
+			return t.encryptionKnown.Load()
+		}
+		t.isEncrypted.Store(true)
+	}
+	t.encryptionKnown.Store(true)
+	return true
 }
 
 func (t *MessageTree) Initialize(ctx context.Context) {
@@ -117,7 +189,22 @@ func (t *MessageTree) Initialize(ctx context.Context) {
 		return
 	}
 
-	t.LoadNextMessages(ctx, 30)
+	t.populating.Lock()
+	if t.loadCached(ctx) > 0 {
+		// render from the cache right away and catch up in the background
+		go func() {
+			defer t.populating.Unlock()
+			t.refreshPowerLevels(ctx)
+			t.refreshPins(ctx)
+			t.reconcileCached(ctx)
+		}()
+		return
+	}
+
+	t.refreshPowerLevels(ctx)
+	t.refreshPins(ctx)
+	t.fetchOlder(ctx, windowPage)
+	t.populating.Unlock()
 }
 
 func (t *MessageTree) sendEventToListeners(treeEvt MessageTreeEvent) {
@@ -156,48 +243,44 @@ func (t *MessageTree) populateEmbed(msg models.Message) []models.Embed {
 	return embeds
 }
 
+func embedCacheKey(roomID, messageID string) string {
+	return fmt.Sprintf("embed:%s:%s", roomID, messageID)
+}
+
 func (t *MessageTree) fetchAndApplyEmbeds(msg models.Message) {
-	cacheKey := fmt.Sprintf("embed:%s:%s", t.roomID, msg.ID)
-	result, _ := t.embedCache.Get(cacheKey, func() ([]models.Embed, error) {
+	result, _ := t.embedCache.Get(embedCacheKey(t.roomID, msg.ID), func() ([]models.Embed, error) {
 		return t.populateEmbed(msg), nil
 	})
 
-	msg.Embeds = result
-	if len(msg.Embeds) == 0 {
+	if len(result) == 0 {
 		return
 	}
 
 	t.mu.Lock()
-	t.BTreeG.Set(msg)
-	t.messagesMap.Store(msg.ID, &msg)
+	current, ok := t.messagesMap.Load(msg.ID)
+	if !ok || current.Redacted || len(current.Embeds) == len(result) {
+		t.mu.Unlock()
+		return
+	}
+	updated := *current
+	updated.Embeds = result
+	t.BTreeG.Set(updated)
+	t.messagesMap.Store(updated.ID, &updated)
 	t.mu.Unlock()
 
 	t.sendEventToListeners(MessageTreeEvent{
-		Message:   msg,
+		Message:   updated,
 		EventType: UpdateEvent,
 	})
 }
 
-func (t *MessageTree) LoadNextMessages(ctx context.Context, limit int) bool {
-	t.populating.Lock()
-	defer t.populating.Unlock()
-
-	if t.noMoreHistory.Load() {
-		return false
-	}
-
-	t.prevBatchMu.RLock()
-	token := t.prevBatch
-	t.prevBatchMu.RUnlock()
-
-	t.populateTree(ctx, token, "", limit)
-	return !t.noMoreHistory.Load()
-}
-
 func (t *MessageTree) DeleteMessage(msg models.Message) {
 	t.mu.Lock()
 	t.BTreeG.Delete(msg)
 	t.mu.Unlock()
+	t.matrixSession.unindexMessage(msg)
+	t.matrixSession.uncacheMessage(msg)
+	t.matrixSession.forgetEncryptedMedia(msg)
 
 	t.sendEventToListeners(MessageTreeEvent{
 		Message:   msg,
@@ -205,6 +288,66 @@ func (t *MessageTree) DeleteMessage(msg models.Message) {
 	})
 }
 
+func (t *MessageTree) refreshMessage(messageID string) {
+	msg, ok := t.messagesMap.Load(messageID)
+	if !ok {
+		t.updateThreadReply(messageID, t.decorate)
+		// otherwise applied by Set once the message is loaded
+		return
+	}
+	t.Set(*msg)
+}
+
+func (t *MessageTree) decorate(m *models.Message) {
+	m.IsOwn = m.Author.ID == t.matrixSession.id
+	t.resolveReplyPreview(m)
+	m.IsPinned = m.EventID != "" && t.isPinned(m.EventID)
+
+	if m.IsPending() || m.IsDecrypting() || m.Undecryptable || m.Redacted {
+		m.CanRedact = false
+		m.CanPin = false
+		return
+	}
+
+	m.CanRedact = t.canRedact(m)
+	m.CanPin = t.canPin()
+
+	t.edits.apply(m)
+	m.Reactions = t.reactions.summary(m.ID, t.matrixSession.id)
+
+	if th, ok := t.threads.Load(m.ID); ok {
+		th.applySummary(m)
+	}
+}
+
+func (t *MessageTree) updateMessage(messageID string, fn func(*models.Message)) bool {
+	t.mu.RLock()
+	msg, ok := t.messagesMap.Load(messageID)
+	t.mu.RUnlock()
+
+	if !ok {
+		return t.updateThreadReply(messageID, fn)
+	}
+
+	updated := *msg
+	fn(&updated)
+	t.Set(updated)
+	return true
+}
+
+func (t *MessageTree) dropNonce(nonce string) {
+	if nonce == "" {
+		return
+	}
+
+	placeholder, ok := t.nonces.LoadAndDelete(nonce)
+	if !ok {
+		return
+	}
+	t.messagesMap.Delete(placeholder.ID)
+	t.DeleteMessage(*placeholder)
+}
+
 func (t *MessageTree) redactedMessageFrom(
 	original models.Message,
 	evt *event.Event,
@@ -260,11 +403,9 @@ func (t *MessageTree) handleEncrypted(ctx context.Context, requestedSessions *xs
 func (t *MessageTree) populateTree(ctx context.Context, from, to string, limit int) {
 	roomID := t.roomID
 	rid := id.RoomID(roomID)
-	client := t.matrixSession.GetClient()
-	requestedSessions := xsync.NewMap[id.SessionID, struct{}]()
 
 	_, _ = t.matrixSession.keyBackupMgr.RestoreRoomKeys(ctx, rid)
-	resp, err := client.Messages(ctx, rid, from, to, mautrix.DirectionBackward, nil, limit)
+	resp, threads, err := t.messages(ctx, from, to, mautrix.DirectionBackward, limit)
 	if err != nil {
 		t.matrixSession.logger.Error("failed to get messages", "roomID", roomID, "error", err)
 		return
@@ -275,11 +416,62 @@ func (t *MessageTree) populateTree(ctx context.Context, from, to string, limit i
 		t.noMoreHistory.Store(true)
 	}
 	t.prevBatch = resp.End
+	if oldest, ok := oldestTimestamp(resp.Chunk); ok && resp.End != "" {
+		t.boundaries = append(t.boundaries, pageBoundary{token: resp.End, at: oldest})
+	}
 	t.prevBatchMu.Unlock()
 
+	t.applyChunk(ctx, resp.Chunk, threads)
+}
+
+// messages is client.Messages, also returning the bundled thread summaries
+// that mautrix drops while decoding the page.
+func (t *MessageTree) messages(ctx context.Context, from, to string, dir mautrix.Direction, limit int) (*mautrix.RespMessages, threadSummaries, error) {
+	query := map[string]string{
+		"dir": string(dir),
+	}
+	if limit != 0 {
+		query["limit"] = strconv.Itoa(limit)
+	}
+	if from != "" {
+		query["from"] = from
+	}
+	if to != "" {
+		query["to"] = to
+	}
+
+	client := t.matrixSession.GetClient()
+	url := client.BuildURLWithQuery(mautrix.ClientURLPath{"v3", "rooms", t.roomID, "messages"}, query)
+
+	var raw struct {
+		Start string            `json:"start"`
+		Chunk []json.RawMessage `json:"chunk"`
+		End   string            `json:"end"`
+	}
+	if _, err := client.MakeRequest(ctx, http.MethodGet, url, nil, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	chunk, threads, err := decodeChunk(raw.Chunk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &mautrix.RespMessages{Start: raw.Start, Chunk: chunk, End: raw.End}, threads, nil
+}
+
+// applyChunk decrypts and stores a batch of timeline events from /messages or
+// /context.
+func (t *MessageTree) applyChunk(ctx context.Context, chunk []*event.Event, threads threadSummaries) {
+	requestedSessions := xsync.NewMap[id.SessionID, struct{}]()
+
 	var wg sync.WaitGroup
-	for _, evt := range resp.Chunk {
+	for _, evt := range chunk {
 		wg.Go(func() {
+			if t.matrixSession.isIgnored(evt.Sender.String()) {
+				return
+			}
+			t.applyBundledThread(evt, threads[evt.ID])
+
 			nonce := ""
 			if evt.Type == event.EventEncrypted {
 				if evt.Unsigned.RedactedBecause != nil {
@@ -306,8 +498,13 @@ func (t *MessageTree) populateTree(ctx context.Context, from, to string, limit i
 				evt = unencrypted
 			}
 
+			if t.handleRelation(evt, false) {
+				t.dropNonce(nonce)
+				return
+			}
+
 			switch evt.Type {
-			case event.EventMessage:
+			case event.EventMessage, event.EventSticker:
 				if evt.Unsigned.RedactedBecause != nil {
 					msg := t.redactedMessage(evt)
 					t.Set(msg)
@@ -319,8 +516,8 @@ func (t *MessageTree) populateTree(ctx context.Context, from, to string, limit i
 					t.Set(*msg)
 				}
 				return
-			case event.EventReaction:
-			case event.EventSticker:
+			default:
+				t.dropNonce(nonce)
 			}
 		})
 	}
@@ -328,6 +525,29 @@ func (t *MessageTree) populateTree(ctx context.Context, from, to string, limit i
 	wg.Wait()
 }
 
+func (t *MessageTree) handleRelation(evt *event.Event, live bool) bool {
+	switch evt.Type {
+	case event.EventReaction:
+		t.handleReaction(evt)
+		return true
+	case event.EventMessage, event.EventSticker:
+		if target, newContent := replaceTarget(evt); target != "" {
+			t.handleEdit(evt, target, newContent)
+			return true
+		}
+
+		if rootID, ok := threadParent(evt); ok {
+			if evt.Unsigned.RedactedBecause != nil {
+				t.addThreadReply(rootID, t.redactedMessage(evt), live)
+				return true
+			}
+			t.handleThreadReply(evt, rootID, live)
+			return true
+		}
+	}
+	return false
+}
+
 func (t *MessageTree) RetryDecryptMessage(ctx context.Context, msg models.Message) bool {
 	if !msg.Undecryptable {
 		return false
@@ -344,7 +564,13 @@ func (t *MessageTree) RetryDecryptMessage(ctx context.Context, msg models.Messag
 		return false
 	}
 
-	if unencrypted.Type != event.EventMessage {
+	if t.handleRelation(unencrypted, false) {
+		t.rawEncryptedEvents.Delete(msg.ID)
+		t.dropNonce(msg.ID)
+		return true
+	}
+
+	if unencrypted.Type != event.EventMessage && unencrypted.Type != event.EventSticker {
 		return false
 	}
 
@@ -430,23 +656,48 @@ func (t *MessageTree) Listen(ctx context.Context, cb func(MessageTreeEvent)) {
 				if evt == nil || evt.RoomID != id.RoomID(t.roomID) {
 					continue
 				}
+				if t.matrixSession.isIgnored(evt.Sender.String()) {
+					continue
+				}
+
+				if t.handleRelation(evt, true) {
+					continue
+				}
 
 				switch evt.Type {
-				case event.EventMessage:
+				case event.EventMessage, event.EventSticker:
 					msg := t.eventToMessage(evt)
 					if msg != nil {
 						t.Set(*msg)
 					}
 				case event.EventRedaction:
-					redactedID := safeHashClass(evt.Redacts.String())
+					redacts := redactedEventID(evt)
+					if targetID, ok := t.reactions.remove(redacts); ok {
+						t.refreshMessage(targetID)
+						continue
+					}
+					if targetID, ok := t.edits.remove(redacts); ok {
+						t.updateMessage(targetID, t.revertEdits)
+						continue
+					}
+
+					redactedID := safeHashClass(redacts.String())
 					msg, ok := t.messagesMap.LoadAndDelete(redactedID)
 					if !ok {
+						if t.deferRedaction(redactedID, evt) {
+							continue
+						}
+						t.updateThreadReply(redactedID, func(m *models.Message) {
+							*m = t.redactedMessageFrom(*m, evt)
+						})
 						continue
 					}
 					t.DeleteMessage(*msg)
 					t.Set(t.redactedMessageFrom(*msg, evt))
-				case event.EventReaction:
-				case event.EventSticker:
+				case event.StatePowerLevels:
+					t.handlePowerLevels(evt)
+				case event.StatePinnedEvents:
+					t.handlePinnedEvents(evt)
 				}
 			}
 		}
@@ -494,50 +745,80 @@ func (t *MessageTree) Close() {
 	t.wg.Wait()
 }
 
-func (t *MessageTree) SendMessage(body string) error {
-	ctx := t.matrixSession.Context()
-
+func (t *MessageTree) SendMessage(body string, replyTo string) error {
 	nonce, err := generateNonce()
 	if err != nil {
 		return err
 	}
 
-	t.Set(t.defaultMessage(body, nonce))
+	content := t.textContent(body)
+	placeholder := t.defaultMessage(content.Body, nonce)
+	placeholder.FormattedContent = formattedBody(content)
 
+	if replyTo != "" {
+		parent := id.EventID(replyTo)
+		content.RelatesTo = (&event.RelatesTo{}).SetReplyTo(parent)
+		placeholder.ReplyTo = t.replyPreview(nonce, parent)
+
+		if p := placeholder.ReplyTo; !p.Loading && p.Author.ID != "" && p.Author.ID != t.matrixSession.id {
+			content.Mentions.Add(id.UserID(p.Author.ID))
+		}
+	}
+
+	t.Set(placeholder)
+
+	return t.queueEvent(event.EventMessage, content, placeholder)
+}
+
+func (t *MessageTree) sendEvent(
+	ctx context.Context,
+	evtType event.Type,
+	content any,
+	txnID string,
+) (*mautrix.RespSendEvent, error) {
 	rid := id.RoomID(t.roomID)
 	client := t.matrixSession.GetClient()
-	content := &event.MessageEventContent{
-		MsgType: event.MsgText,
-		Body:    body,
-	}
 
-	if t.isEncrypted {
+	if t.isEncrypted.Load() {
 		t.shareGroupSession(ctx)
 
 		encrypted, err := t.matrixSession.GetCryptoHelper().Encrypt(
-			ctx, rid, event.EventMessage, content,
+			ctx, rid, evtType, content,
 		)
 		if err != nil {
-			return fmt.Errorf("encrypt: %w", err)
+			return nil, fmt.Errorf("encrypt: %w", err)
+		}
+
+		// relations must stay visible to the server for aggregation
+		if rel, ok := content.(event.Relatable); ok && encrypted.RelatesTo == nil {
+			encrypted.RelatesTo = rel.OptionalGetRelatesTo()
 		}
 
-		_, err = client.SendMessageEvent(
+		return client.SendMessageEvent(
 			ctx, rid, event.EventEncrypted, encrypted,
-			mautrix.ReqSendEvent{TransactionID: nonce},
+			mautrix.ReqSendEvent{TransactionID: txnID},
 		)
-		return err
 	}
 
-	_, err = client.SendMessageEvent(
-		ctx, rid, event.EventMessage, content,
-		mautrix.ReqSendEvent{TransactionID: nonce},
+	return client.SendMessageEvent(
+		ctx, rid, evtType, content,
+		mautrix.ReqSendEvent{TransactionID: txnID},
 	)
-	return err
 }
 
 func (t *MessageTree) Set(m models.Message) (models.Message, bool) {
+	return t.set(m, true)
+}
+
+// set stores m in the tree. persist is false for messages that were just
+// read from the timeline cache.
+func (t *MessageTree) set(m models.Message, persist bool) (models.Message, bool) {
+	// covers messages loaded from the timeline cache
+	if t.matrixSession.isIgnored(m.Author.ID) {
+		return m, false
+	}
+
 	t.mu.Lock()
-	defer t.mu.Unlock()
 	m.RoomID = t.roomID
 
 	replacedPending := false
@@ -559,6 +840,8 @@ func (t *MessageTree) Set(m models.Message) (models.Message, bool) {
 		t.nonces.Store(m.ID, &m)
 	}
 
+	t.decorate(&m)
+
 	_, replaced := t.BTreeG.Set(m)
 	t.messagesMap.Store(m.ID, &m)
 
@@ -569,35 +852,66 @@ func (t *MessageTree) Set(m models.Message) (models.Message, bool) {
 		m = redacted
 	}
 
-	if t.listening.Load() {
+	var treeEvt *MessageTreeEvent
+	if t.listening.Load() && t.inWindow(m) {
 		neighbors := t.getNeighbors(m)
 
-		var treeEvt MessageTreeEvent
 		if !replaced && !replacedPending {
-			treeEvt = MessageTreeEvent{
+			treeEvt = &MessageTreeEvent{
 				Message:   m,
 				EventType: AddEvent,
 				Neighbors: neighbors,
 			}
 		} else {
-			treeEvt = MessageTreeEvent{
+			treeEvt = &MessageTreeEvent{
 				Message:     m,
 				UpdateNonce: replacedNonce,
 				EventType:   UpdateEvent,
 				Neighbors:   neighbors,
 			}
 		}
+	}
+	t.mu.Unlock()
 
-		t.sendEventToListeners(treeEvt)
+	// listeners, the search index and the timeline cache can all block, so
+	// they're only handed the message once the tree is unlocked
+	if treeEvt != nil {
+		t.sendEventToListeners(*treeEvt)
+
+		if treeEvt.EventType == AddEvent && t.followingLive() && t.trimming.CompareAndSwap(false, true) {
+			go t.trimLiveWindow()
+		}
 	}
 
 	if !isPending {
+		if t.isEncrypted.Load() {
+			t.matrixSession.indexMessage(m)
+		}
+		if persist {
+			t.cacheMessage(m)
+		}
 		go t.fetchAndApplyEmbeds(m)
 	}
 
 	return m, replaced
 }
 
+func (t *MessageTree) GetMessage(messageID string) (models.Message, bool) {
+	if msg, ok := t.messagesMap.Load(messageID); ok {
+		return *msg, true
+	}
+
+	rootID, ok := t.threadReplies.Load(messageID)
+	if !ok {
+		return models.Message{}, false
+	}
+	th, ok := t.threads.Load(rootID)
+	if !ok {
+		return models.Message{}, false
+	}
+	return th.get(messageID)
+}
+
 func (t *MessageTree) getNeighbors(m models.Message) Neighbors {
 	var n Neighbors
 	iter := t.Iter()
@@ -606,14 +920,14 @@ func (t *MessageTree) getNeighbors(m models.Message) Neighbors {
 		return n
 	}
 
-	if iter.Prev() {
+	if iter.Prev() && t.inWindow(iter.Item()) {
 		v := iter.Item()
 		n.Prev = &v
 		iter.Next()
 	}
 
 	iter.Seek(m)
-	if iter.Next() {
+	if iter.Next() && t.inWindow(iter.Item()) {
 		v := iter.Item()
 		n.Next = &v
 	}
@@ -621,20 +935,6 @@ func (t *MessageTree) getNeighbors(m models.Message) Neighbors {
 	return n
 }
 
-func (t *MessageTree) Chronological() []models.Message {
-	go t.retryDecryptAll(t.matrixSession.manager.ctx)
-
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-
-	items := make([]models.Message, 0, t.Len())
-	t.Reverse(func(item models.Message) bool {
-		items = append(items, item)
-		return true
-	})
-	return items
-}
-
 func (t *MessageTree) eventToMessage(
 	evt *event.Event,
 ) *models.Message {
@@ -647,14 +947,44 @@ func (t *MessageTree) eventToMessage(
 
 	safeId := safeHashClass(evt.ID.String())
 
-	return &models.Message{
-		ID:        safeId,
-		Content:   content.Body,
-		Author:    profile,
-		Timestamp: time.UnixMilli(evt.Timestamp),
-		RoomID:    t.roomID,
-		Nonce:     evt.Unsigned.TransactionID,
+	msg := &models.Message{
+		ID:               safeId,
+		EventID:          evt.ID.String(),
+		Content:          content.Body,
+		FormattedContent: formattedBody(content),
+		Author:           profile,
+		Timestamp:        time.UnixMilli(evt.Timestamp),
+		RoomID:           t.roomID,
+		Nonce:            evt.Unsigned.TransactionID,
 	}
+
+	if ownID := t.matrixSession.id; evt.Sender.String() != ownID {
+		own, _ := t.matrixSession.GetUserProfile(ownID)
+		msg.MentionsMe = mentionsUser(content, ownID, own.Name)
+	}
+
+	if parent := replyParent(content); parent != "" {
+		msg.Content = stripReplyFallback(content.Body)
+		msg.ReplyTo = t.replyPreview(safeId, parent)
+	}
+
+	if evt.Type == event.EventSticker {
+		msg.Content = ""
+		msg.FormattedContent = ""
+		msg.Attachments = []models.Attachment{
+			t.attachmentFromContent(models.AttachmentSticker, content),
+		}
+	} else if kind, ok := attachmentType(content.MsgType); ok {
+		msg.Content = attachmentCaption(content)
+		if msg.Content == "" {
+			msg.FormattedContent = ""
+		}
+		msg.Attachments = []models.Attachment{
+			t.attachmentFromContent(kind, content),
+		}
+	}
+
+	return msg
 }
 
 func (t *MessageTree) defaultMessage(content, nonce string) models.Message {
@@ -693,6 +1023,7 @@ func (t *MessageTree) undecryptableMessage(
 
 	return models.Message{
 		ID:            safeHashClass(evt.ID.String()),
+		EventID:       evt.ID.String(),
 		Author:        profile,
 		Timestamp:     time.UnixMilli(evt.Timestamp),
 		RoomID:        t.roomID,
@@ -707,6 +1038,7 @@ func (t *MessageTree) redactedMessage(
 
 	return models.Message{
 		ID:        safeHashClass(evt.ID.String()),
+		EventID:   evt.ID.String(),
 		Author:    profile,
 		Timestamp: time.UnixMilli(evt.Timestamp),
 		RoomID:    t.roomID,
@@ -722,13 +1054,13 @@ func (t *MessageTree) shareGroupSession(ctx context.Context) {
 		return
 	}
 
-	members, err := t.matrixSession.GetClient().Members(ctx, rid)
+	members, err := t.matrixSession.joinedMembers(ctx, rid)
 	if err != nil {
 		return
 	}
 
 	var memberIDs []id.UserID
-	for _, evt := range members.Chunk {
+	for _, evt := range members {
 		c, ok := evt.Content.Parsed.(*event.MemberEventContent)
 		if !ok || c.Membership != event.MembershipJoin {
 			continue
@@ -0,0 +1,162 @@
+package matrix
+
+import (
+	"context"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/pushrules"
+)
+
+// events older than this are history arriving late, not something to ping
+// the user about
+const notificationMaxAge = 5 * time.Minute
+
+type NotificationEvent struct {
+	RoomID    string
+	RoomName  string
+	EventID   string
+	Sender    models.User
+	Body      string
+	Highlight bool
+	DMUserID  string
+	SpaceID   string
+}
+
+type pushRoom struct {
+	displayName string
+	memberCount int
+}
+
+func (r pushRoom) GetOwnDisplayname() string {
+	return r.displayName
+}
+
+func (r pushRoom) GetMemberCount() int {
+	return r.memberCount
+}
+
+func (m *MatrixSession) pushRules() (*pushrules.PushRuleset, error) {
+	return m.pushRulesCache.Get("pr:"+m.id, func() (*pushrules.PushRuleset, error) {
+		return m.GetClient().GetPushRules(m.Context())
+	})
+}
+
+func (m *MatrixSession) pushRoom(roomID id.RoomID) pushRoom {
+	room := pushRoom{displayName: id.UserID(m.id).Localpart()}
+
+	members, err := m.getRoomMembers(roomID)
+	if err != nil {
+		return room
+	}
+	room.memberCount = len(members)
+	for _, u := range members {
+		if u.ID == m.id && u.Name != "" {
+			room.displayName = u.Name
+			break
+		}
+	}
+	return room
+}
+
+func (m *MatrixSession) trackCatchUp(ctx context.Context, resp *mautrix.RespSync, since string) bool {
+	m.catchingUp.Store(since == "")
+	return true
+}
+
+func (m *MatrixSession) queueNotification(evt *event.Event) {
+	if m.catchingUp.Load() || m.notificationListeners.Size() == 0 {
+		return
+	}
+	go m.checkNotification(evt)
+}
+
+// checkNotification runs a live event through the account's push rules and
+// hands matches to the notification listeners.
+func (m *MatrixSession) checkNotification(evt *event.Event) {
+	if evt.Sender.String() == m.id || time.Since(time.UnixMilli(evt.Timestamp)) > notificationMaxAge {
+		return
+	}
+
+	rules, err := m.pushRules()
+	if err != nil || rules == nil {
+		m.logger.Debug("failed to load push rules", "err", err)
+		return
+	}
+
+	should := rules.GetActions(m.pushRoom(evt.RoomID), evt).Should()
+	if !should.Notify {
+		return
+	}
+
+	content, ok := evt.Content.Parsed.(*event.MessageEventContent)
+	if !ok {
+		return
+	}
+
+	sender, _ := m.GetUserProfile(evt.Sender.String())
+	if sender.ID == "" {
+		sender = models.User{ID: evt.Sender.String(), Name: evt.Sender.Localpart()}
+	}
+
+	notification := NotificationEvent{
+		RoomID:    evt.RoomID.String(),
+		RoomName:  m.getRoomName(evt.RoomID),
+		EventID:   evt.ID.String(),
+		Sender:    sender,
+		Body:      notificationBody(evt.Type, content),
+		Highlight: should.Highlight,
+	}
+	notification.DMUserID, notification.SpaceID = m.RoomParent(notification.RoomID)
+
+	m.notificationListeners.Range(func(ch chan NotificationEvent, _ struct{}) bool {
+		select {
+		case ch <- notification:
+		default:
+		}
+		return true
+	})
+}
+
+func notificationBody(evtType event.Type, content *event.MessageEventContent) string {
+	if evtType == event.EventSticker {
+		return "Sent a sticker"
+	}
+
+	switch content.MsgType {
+	case event.MsgImage:
+		return "Sent an image"
+	case event.MsgVideo:
+		return "Sent a video"
+	case event.MsgAudio:
+		return "Sent an audio message"
+	case event.MsgFile:
+		return "Sent a file"
+	}
+
+	body := content.Body
+	if content.NewContent != nil {
+		body = content.NewContent.Body
+	}
+	return body
+}
+
+func (m *MatrixSession) NotificationEvents() <-chan NotificationEvent {
+	ch := make(chan NotificationEvent, 16)
+	m.notificationListeners.Store(ch, struct{}{})
+	return ch
+}
+
+func (m *MatrixSession) CloseNotificationListener(ch <-chan NotificationEvent) {
+	m.notificationListeners.Range(func(listener chan NotificationEvent, _ struct{}) bool {
+		if listener == ch {
+			m.notificationListeners.Delete(listener)
+			close(listener)
+			return false
+		}
+		return true
+	})
+}
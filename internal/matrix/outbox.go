@@ -0,0 +1,543 @@
+package matrix
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/arko-chat/arko/internal/models"
+)
+
+const (
+	maxSendAttempts = 6
+	sendBackoffBase = 2 * time.Second
+	sendBackoffMax  = 2 * time.Minute
+	// encryptionRetryDelay is how long a message waits for its room's
+	// encryption state to be looked up again
+	encryptionRetryDelay = 15 * time.Second
+)
+
+var (
+	ErrNotQueued = errors.New("message is not waiting to be sent")
+	ErrSending   = errors.New("message is being sent")
+
+	errEncryptionUnknown = errors.New("room encryption state unknown")
+)
+
+// outboxEntry is a message that hasn't been accepted by the server yet. The
+// transaction ID doubles as the placeholder's nonce, so retries are
+// deduplicated by the server and the sync echo replaces the placeholder.
+type outboxEntry struct {
+	TxnID     string          `json:"txn_id"`
+	RoomID    string          `json:"room_id"`
+	EventType string          `json:"event_type"`
+	Content   json.RawMessage `json:"content"`
+	// Encrypted is the room's state when the message was written. Nothing
+	// is sent to a room until its encryption state is known, and a room
+	// that was encrypted is never sent to in plain.
+	Encrypted bool           `json:"encrypted"`
+	Message   models.Message `json:"message"`
+	// ThreadRoot is set for thread replies, whose placeholder lives in the
+	// thread rather than the room.
+	ThreadRoot string `json:"thread_root,omitempty"`
+	// Target is set for edits and reactions. They have no placeholder of
+	// their own and are shown on the message they relate to until sent.
+	Target   string `json:"target,omitempty"`
+	Attempts int    `json:"attempts"`
+	Failed   bool   `json:"failed"`
+
+	next    time.Time
+	sending bool
+}
+
+// outbox sends queued messages one at a time, oldest first, retrying with
+// backoff. Messages of a room go out in order; a failed one stops blocking
+// the ones behind it until it's retried.
+type outbox struct {
+	session *MatrixSession
+	db      *dbutil.Database
+	aead    cipher.AEAD
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	entries []*outboxEntry
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+func newOutbox(ctx context.Context, session *MatrixSession, db *dbutil.Database, pickleKey []byte) (*outbox, error) {
+	o := &outbox{
+		session: session,
+		db:      db,
+		logger:  session.logger,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if db == nil {
+		return o, nil
+	}
+
+	aead, err := storeAEAD(pickleKey, "arko outbox")
+	if err != nil {
+		return nil, err
+	}
+	o.aead = aead
+
+	_, err = db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS arko_outbox (
+			txn_id  TEXT PRIMARY KEY,
+			created INTEGER NOT NULL,
+			data    BLOB    NOT NULL
+		)`)
+	if err != nil {
+		return nil, fmt.Errorf("create outbox table: %w", err)
+	}
+
+	rows, err := db.Query(ctx, `SELECT txn_id, data FROM arko_outbox ORDER BY created`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			txnID string
+			data  []byte
+		)
+		if err := rows.Scan(&txnID, &data); err != nil {
+			return nil, err
+		}
+		var entry outboxEntry
+		if err := openRow(aead, txnID, data, &entry); err != nil {
+			o.logger.Warn("dropping unreadable outbox entry", "txnID", txnID, "err", err)
+			continue
+		}
+		o.entries = append(o.entries, &entry)
+	}
+	return o, rows.Err()
+}
+
+func (o *outbox) enqueue(t *MessageTree, evtType event.Type, content any, entry *outboxEntry) error {
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+
+	entry.RoomID = t.roomID
+	entry.EventType = evtType.Type
+	entry.Content = raw
+	entry.Encrypted = t.isEncrypted.Load()
+
+	o.mu.Lock()
+	o.entries = append(o.entries, entry)
+	o.persist(entry)
+	o.mu.Unlock()
+
+	o.notify()
+	return nil
+}
+
+// restore puts the placeholders of a room's queued messages back into its
+// tree after a restart.
+func (o *outbox) restore(t *MessageTree) {
+	o.mu.Lock()
+	var pending []outboxEntry
+	for _, e := range o.entries {
+		if e.RoomID == t.roomID {
+			pending = append(pending, *e)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, e := range pending {
+		msg := e.Message
+		msg.SendFailed = e.Failed
+
+		switch {
+		case e.Target != "":
+			content, err := e.parse()
+			if err != nil {
+				continue
+			}
+			t.applyPendingRelation(content.Parsed, e.TxnID, e.Target)
+		case e.ThreadRoot != "":
+			t.addThreadReply(id.EventID(e.ThreadRoot), msg, true)
+		default:
+			t.Set(msg)
+		}
+	}
+}
+
+func (o *outbox) retry(txnID string) error {
+	o.mu.Lock()
+	entry := o.find(txnID)
+	if entry == nil || !entry.Failed {
+		o.mu.Unlock()
+		return ErrNotQueued
+	}
+	entry.Failed = false
+	entry.Attempts = 0
+	entry.next = time.Time{}
+	o.persist(entry)
+	o.mu.Unlock()
+
+	if entry.Target == "" {
+		o.session.GetMessageTree(entry.RoomID).markSendFailed(txnID, false)
+	}
+	o.notify()
+	return nil
+}
+
+func (o *outbox) discard(txnID string) error {
+	o.mu.Lock()
+	entry := o.find(txnID)
+	if entry == nil {
+		o.mu.Unlock()
+		return ErrNotQueued
+	}
+	if entry.sending {
+		o.mu.Unlock()
+		return ErrSending
+	}
+	o.remove(entry)
+	o.mu.Unlock()
+
+	t := o.session.GetMessageTree(entry.RoomID)
+	switch {
+	case entry.Target != "":
+		t.dropPendingRelation(txnID, entry.Target)
+	case entry.ThreadRoot != "":
+		t.dropThreadReply(txnID)
+	default:
+		t.dropNonce(txnID)
+	}
+	return nil
+}
+
+func (o *outbox) run(ctx context.Context) {
+	defer close(o.done)
+
+	for {
+		entry, wait := o.nextDue()
+		if entry != nil {
+			o.attempt(ctx, entry)
+			continue
+		}
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = time.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-timer:
+		}
+	}
+}
+
+// nextDue picks the oldest entry that's at the head of its room's queue and
+// due to be sent. Otherwise it returns how long until one is.
+func (o *outbox) nextDue() (*outboxEntry, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	seen := make(map[string]struct{})
+	for _, e := range o.entries {
+		if e.Failed {
+			continue
+		}
+		if _, ok := seen[e.RoomID]; ok {
+			continue
+		}
+		seen[e.RoomID] = struct{}{}
+
+		if !e.next.After(now) {
+			e.sending = true
+			return e, 0
+		}
+		if d := e.next.Sub(now); wait == 0 || d < wait {
+			wait = d
+		}
+	}
+	return nil, wait
+}
+
+func (o *outbox) attempt(ctx context.Context, entry *outboxEntry) {
+	t := o.session.GetMessageTree(entry.RoomID)
+	evtID, err := o.send(ctx, t, entry)
+
+	o.mu.Lock()
+	entry.sending = false
+
+	if err == nil {
+		o.remove(entry)
+		o.mu.Unlock()
+		if entry.Target != "" {
+			t.confirmPendingRelation(entry.TxnID, evtID, entry.Target)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		o.mu.Unlock()
+		return
+	}
+
+	delay, permanent := sendRetryPolicy(err)
+	if delay == 0 {
+		entry.Attempts++
+		delay = min(sendBackoffBase<<(entry.Attempts-1), sendBackoffMax)
+	}
+
+	if permanent || entry.Attempts >= maxSendAttempts {
+		entry.Failed = true
+	} else {
+		entry.next = time.Now().Add(delay)
+	}
+	failed := entry.Failed
+	// edits and reactions can't be retried from the UI, so they're
+	// reverted instead of being kept around as failed
+	if failed && entry.Target != "" {
+		o.remove(entry)
+	} else {
+		o.persist(entry)
+	}
+	o.mu.Unlock()
+
+	if failed {
+		o.logger.Warn("giving up on message", "roomID", entry.RoomID, "txnID", entry.TxnID, "err", err)
+		if entry.Target != "" {
+			t.dropPendingRelation(entry.TxnID, entry.Target)
+		} else {
+			t.markSendFailed(entry.TxnID, true)
+		}
+		return
+	}
+	o.logger.Debug("message send failed, retrying", "roomID", entry.RoomID, "in", delay, "err", err)
+}
+
+func (e *outboxEntry) parse() (event.Content, error) {
+	evtType := event.Type{Type: e.EventType, Class: event.MessageEventType}
+	content := event.Content{VeryRaw: e.Content}
+	err := content.ParseRaw(evtType)
+	return content, err
+}
+
+func (o *outbox) send(ctx context.Context, t *MessageTree, entry *outboxEntry) (id.EventID, error) {
+	// the state may have been unknown when the tree was created, so it's
+	// looked up again rather than sending in plain
+	if !t.encryptionKnown.Load() || (entry.Encrypted && !t.isEncrypted.Load()) {
+		if !t.lookupEncryption(ctx) || (entry.Encrypted && !t.isEncrypted.Load()) {
+			return "", errEncryptionUnknown
+		}
+	}
+
+	content, err := entry.parse()
+	if err != nil {
+		return "", err
+	}
+
+	evtType := event.Type{Type: entry.EventType, Class: event.MessageEventType}
+	resp, err := t.sendEvent(ctx, evtType, content.Parsed, entry.TxnID)
+	if err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+// sendRetryPolicy looks at why a send failed. Rate limits come with the
+// delay the server asked for, which doesn't count as an attempt. Requests
+// the server rejected outright won't succeed on a retry.
+func sendRetryPolicy(err error) (delay time.Duration, permanent bool) {
+	if errors.Is(err, errEncryptionUnknown) {
+		return encryptionRetryDelay, false
+	}
+
+	var httpErr mautrix.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.RespError == nil {
+		return 0, false
+	}
+
+	resp := httpErr.RespError
+	if resp.ErrCode == mautrix.MLimitExceeded.ErrCode {
+		if ms, ok := resp.ExtraData["retry_after_ms"].(float64); ok && ms > 0 {
+			return time.Duration(ms) * time.Millisecond, false
+		}
+		return sendBackoffBase, false
+	}
+
+	status := resp.StatusCode
+	if status == 0 && httpErr.Response != nil {
+		status = httpErr.Response.StatusCode
+	}
+	return 0, status >= 400 && status < 500 &&
+		status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+}
+
+func (o *outbox) find(txnID string) *outboxEntry {
+	for _, e := range o.entries {
+		if e.TxnID == txnID {
+			return e
+		}
+	}
+	return nil
+}
+
+func (o *outbox) remove(entry *outboxEntry) {
+	o.entries = slices.DeleteFunc(o.entries, func(e *outboxEntry) bool {
+		return e == entry
+	})
+	if o.db == nil {
+		return
+	}
+	if _, err := o.db.Exec(context.Background(), `DELETE FROM arko_outbox WHERE txn_id=$1`, entry.TxnID); err != nil {
+		o.logger.Warn("failed to remove outbox entry", "err", err)
+	}
+}
+
+func (o *outbox) persist(entry *outboxEntry) {
+	if o.db == nil {
+		return
+	}
+	data, err := sealRow(o.aead, entry.TxnID, entry)
+	if err == nil {
+		_, err = o.db.Exec(context.Background(), `
+			INSERT INTO arko_outbox (txn_id, created, data) VALUES ($1, $2, $3)
+			ON CONFLICT (txn_id) DO UPDATE SET data=excluded.data`,
+			entry.TxnID, entry.Message.Timestamp.UnixMilli(), data,
+		)
+	}
+	if err != nil {
+		o.logger.Warn("failed to persist outbox entry", "err", err)
+	}
+}
+
+func (o *outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// queueEvent hands a message with a pending placeholder to the outbox.
+func (t *MessageTree) queueEvent(evtType event.Type, content any, placeholder models.Message) error {
+	return t.queue(evtType, content, &outboxEntry{TxnID: placeholder.ID, Message: placeholder})
+}
+
+// queueThreadReply is queueEvent for a placeholder that lives in a thread.
+func (t *MessageTree) queueThreadReply(rootEventID id.EventID, content any, placeholder models.Message) error {
+	return t.queue(event.EventMessage, content, &outboxEntry{
+		TxnID:      placeholder.ID,
+		Message:    placeholder,
+		ThreadRoot: rootEventID.String(),
+	})
+}
+
+// queueRelation queues an edit or a reaction to the message targetID. It's
+// applied locally right away and reverted if it can't be sent.
+func (t *MessageTree) queueRelation(evtType event.Type, content any, targetID string) error {
+	txnID, err := generateNonce()
+	if err != nil {
+		return err
+	}
+
+	t.applyPendingRelation(content, txnID, targetID)
+	return t.queue(evtType, content, &outboxEntry{
+		TxnID:   txnID,
+		Message: models.Message{ID: txnID, Timestamp: time.Now()},
+		Target:  targetID,
+	})
+}
+
+func (t *MessageTree) queue(evtType event.Type, content any, entry *outboxEntry) error {
+	if o := t.matrixSession.outbox; o != nil {
+		return o.enqueue(t, evtType, content, entry)
+	}
+
+	resp, err := t.sendEvent(t.matrixSession.Context(), evtType, content, entry.TxnID)
+	if entry.Target != "" {
+		if err != nil {
+			t.dropPendingRelation(entry.TxnID, entry.Target)
+		} else {
+			t.confirmPendingRelation(entry.TxnID, resp.EventID, entry.Target)
+		}
+	}
+	return err
+}
+
+// applyPendingRelation shows a queued edit or reaction under its
+// transaction ID until the server gives it an event ID.
+func (t *MessageTree) applyPendingRelation(content any, txnID, targetID string) {
+	switch c := content.(type) {
+	case *event.ReactionEventContent:
+		if t.reactions.add(targetID, c.RelatesTo.Key, t.matrixSession.id, id.EventID(txnID)) {
+			t.refreshMessage(targetID)
+		}
+	case *event.MessageEventContent:
+		if c.NewContent == nil {
+			return
+		}
+		if t.edits.add(targetID, editVersion{
+			eventID:   id.EventID(txnID),
+			sender:    t.matrixSession.id,
+			content:   c.NewContent.Body,
+			formatted: formattedBody(c.NewContent),
+			timestamp: time.Now(),
+		}) {
+			t.updateMessage(targetID, t.edits.apply)
+		}
+	}
+}
+
+func (t *MessageTree) confirmPendingRelation(txnID string, evtID id.EventID, targetID string) {
+	if t.reactions.rename(id.EventID(txnID), evtID) || t.edits.rename(id.EventID(txnID), evtID) {
+		t.refreshMessage(targetID)
+	}
+}
+
+func (t *MessageTree) dropPendingRelation(txnID, targetID string) {
+	if _, ok := t.reactions.remove(id.EventID(txnID)); ok {
+		t.refreshMessage(targetID)
+	}
+	if _, ok := t.edits.remove(id.EventID(txnID)); ok {
+		t.updateMessage(targetID, t.revertEdits)
+	}
+}
+
+func (t *MessageTree) markSendFailed(txnID string, failed bool) {
+	t.updateMessage(txnID, func(m *models.Message) {
+		m.SendFailed = failed
+	})
+}
+
+// RetrySend queues a message that failed to send again.
+func (t *MessageTree) RetrySend(messageID string) error {
+	if t.matrixSession.outbox == nil {
+		return ErrNotQueued
+	}
+	return t.matrixSession.outbox.retry(messageID)
+}
+
+// DiscardSend drops a message that hasn't been sent yet.
+func (t *MessageTree) DiscardSend(messageID string) error {
+	if t.matrixSession.outbox == nil {
+		return ErrNotQueued
+	}
+	return t.matrixSession.outbox.discard(messageID)
+}
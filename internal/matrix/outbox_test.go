@@ -0,0 +1,247 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+)
+
+type mockResponse struct {
+	status int
+	body   any
+}
+
+func TestOutbox_Attempt(t *testing.T) {
+	notFound := mockResponse{http.StatusNotFound, map[string]any{"errcode": "M_NOT_FOUND"}}
+	unencrypted := []mockResponse{notFound}
+	sent := mockResponse{http.StatusOK, mautrix.RespSendEvent{EventID: "$sent"}}
+	serverError := mockResponse{http.StatusInternalServerError, map[string]any{"errcode": "M_UNKNOWN"}}
+
+	tests := []struct {
+		name         string
+		state        []mockResponse
+		sends        []mockResponse
+		attempts     int
+		wantQueued   bool
+		wantAttempts int
+		wantFailed   bool
+		wantSends    int
+	}{
+		{
+			name:      "sent on the first attempt",
+			state:     unencrypted,
+			sends:     []mockResponse{sent},
+			attempts:  1,
+			wantSends: 1,
+		},
+		{
+			name:         "retried after a server error",
+			state:        unencrypted,
+			sends:        []mockResponse{serverError, sent},
+			attempts:     2,
+			wantAttempts: 1,
+			wantSends:    2,
+		},
+		{
+			name:  "rate limits don't count as attempts",
+			state: unencrypted,
+			sends: []mockResponse{{http.StatusTooManyRequests, map[string]any{
+				"errcode":        "M_LIMIT_EXCEEDED",
+				"retry_after_ms": 500,
+			}}},
+			attempts:   1,
+			wantQueued: true,
+			wantSends:  1,
+		},
+		{
+			name:         "gives up after too many attempts",
+			state:        unencrypted,
+			sends:        []mockResponse{serverError},
+			attempts:     maxSendAttempts,
+			wantQueued:   true,
+			wantAttempts: maxSendAttempts,
+			wantFailed:   true,
+			wantSends:    maxSendAttempts,
+		},
+		{
+			name:         "rejected requests fail right away",
+			state:        unencrypted,
+			sends:        []mockResponse{{http.StatusForbidden, map[string]any{"errcode": "M_FORBIDDEN"}}},
+			attempts:     1,
+			wantQueued:   true,
+			wantAttempts: 1,
+			wantFailed:   true,
+			wantSends:    1,
+		},
+		{
+			name:       "unknown encryption state is retried without sending",
+			state:      []mockResponse{serverError},
+			sends:      []mockResponse{sent},
+			attempts:   maxSendAttempts + 1,
+			wantQueued: true,
+		},
+		{
+			name:      "encryption state is looked up again before sending",
+			state:     []mockResponse{serverError, serverError, notFound},
+			sends:     []mockResponse{sent},
+			attempts:  2,
+			wantSends: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockMatrixServer()
+			defer server.Close()
+
+			respond := func(w http.ResponseWriter, responses []mockResponse, call int) {
+				resp := responses[min(call, len(responses)-1)]
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(resp.status)
+				json.NewEncoder(w).Encode(resp.body)
+			}
+
+			stateCalls, sendCalls := 0, 0
+			server.mux.HandleFunc("/_matrix/client/v3/rooms/", func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.Contains(r.URL.Path, "/state/m.room.encryption"):
+					respond(w, tt.state, stateCalls)
+					stateCalls++
+				case strings.Contains(r.URL.Path, "/send/"):
+					respond(w, tt.sends, sendCalls)
+					sendCalls++
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			session := newTestMatrixSessionWithServer(server)
+			defer session.cancel()
+			session.outbox, _ = newOutbox(session.context, session, nil, nil)
+
+			tree := session.GetMessageTree("!room:example.com")
+			placeholder := models.Message{
+				ID:        "pending-1",
+				Author:    models.User{ID: session.id},
+				Content:   "hello",
+				Timestamp: time.Now(),
+			}
+			tree.Set(placeholder)
+
+			content := &event.MessageEventContent{MsgType: event.MsgText, Body: "hello"}
+			if err := tree.queueEvent(event.EventMessage, content, placeholder); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			entry := session.outbox.find(placeholder.ID)
+			for range tt.attempts {
+				session.outbox.attempt(context.Background(), entry)
+			}
+
+			queued := session.outbox.find(placeholder.ID) != nil
+			if queued != tt.wantQueued {
+				t.Errorf("expected queued %v, got %v", tt.wantQueued, queued)
+			}
+			if entry.Attempts != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, entry.Attempts)
+			}
+			if entry.Failed != tt.wantFailed {
+				t.Errorf("expected failed %v, got %v", tt.wantFailed, entry.Failed)
+			}
+			if sendCalls != tt.wantSends {
+				t.Errorf("expected %d sends, got %d", tt.wantSends, sendCalls)
+			}
+
+			msg, _ := tree.GetMessage(placeholder.ID)
+			if msg.SendFailed != tt.wantFailed {
+				t.Errorf("expected placeholder send failed %v, got %v", tt.wantFailed, msg.SendFailed)
+			}
+		})
+	}
+}
+
+func TestOutbox_QueuedReaction(t *testing.T) {
+	tests := []struct {
+		name      string
+		send      mockResponse
+		wantCount int
+		wantEvent string
+	}{
+		{
+			name:      "confirmed under its event ID",
+			send:      mockResponse{http.StatusOK, mautrix.RespSendEvent{EventID: "$sent"}},
+			wantCount: 1,
+			wantEvent: "$sent",
+		},
+		{
+			name:      "reverted when rejected",
+			send:      mockResponse{http.StatusForbidden, map[string]any{"errcode": "M_FORBIDDEN"}},
+			wantCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockMatrixServer()
+			defer server.Close()
+
+			server.mux.HandleFunc("/_matrix/client/v3/rooms/", func(w http.ResponseWriter, r *http.Request) {
+				resp := tt.send
+				if strings.Contains(r.URL.Path, "/state/m.room.encryption") {
+					resp = mockResponse{http.StatusNotFound, map[string]any{"errcode": "M_NOT_FOUND"}}
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(resp.status)
+				json.NewEncoder(w).Encode(resp.body)
+			})
+
+			session := newTestMatrixSessionWithServer(server)
+			defer session.cancel()
+			session.outbox, _ = newOutbox(session.context, session, nil, nil)
+
+			tree := session.GetMessageTree("!room:example.com")
+			tree.Set(models.Message{
+				ID:        "m1",
+				EventID:   "$m1",
+				Author:    models.User{ID: "@alice:example.com"},
+				Timestamp: time.Now(),
+			})
+
+			if err := tree.ToggleReaction("m1", "👍"); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			pending, ok := tree.reactions.find("m1", "👍", session.id)
+			if !ok || !strings.HasPrefix(pending.String(), "pending-") {
+				t.Fatalf("expected a pending reaction, got %q", pending)
+			}
+			if msg, _ := tree.GetMessage("m1"); len(msg.Reactions) != 1 {
+				t.Fatalf("expected the reaction to show before it's sent, got %v", msg.Reactions)
+			}
+
+			session.outbox.attempt(context.Background(), session.outbox.find(pending.String()))
+
+			msg, _ := tree.GetMessage("m1")
+			count := 0
+			for _, r := range msg.Reactions {
+				count += r.Count
+			}
+			if count != tt.wantCount {
+				t.Errorf("expected %d reactions, got %d", tt.wantCount, count)
+			}
+			evtID, _ := tree.reactions.find("m1", "👍", session.id)
+			if string(evtID) != tt.wantEvent {
+				t.Errorf("expected reaction event %q, got %q", tt.wantEvent, evtID)
+			}
+			if session.outbox.find(pending.String()) != nil {
+				t.Error("expected the reaction to leave the outbox")
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"github.com/puzpuzpuz/xsync/v4"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+func (t *MessageTree) refreshPins(ctx context.Context) {
+	var content event.PinnedEventsEventContent
+	err := t.matrixSession.GetClient().StateEvent(
+		ctx, id.RoomID(t.roomID), event.StatePinnedEvents, "", &content,
+	)
+	if err != nil && !errors.Is(err, mautrix.MNotFound) {
+		t.matrixSession.logger.Warn("failed to fetch pinned events", "roomID", t.roomID, "err", err)
+		return
+	}
+	t.applyPins(content.Pinned)
+}
+
+func (t *MessageTree) handlePinnedEvents(evt *event.Event) {
+	_ = evt.Content.ParseRaw(evt.Type)
+	if content, ok := evt.Content.Parsed.(*event.PinnedEventsEventContent); ok {
+		t.applyPins(content.Pinned)
+	}
+}
+
+// applyPins stores the room's pinned events and refreshes the messages
+// whose pinned state changed.
+func (t *MessageTree) applyPins(pinned []id.EventID) {
+	pinned = slices.Clone(pinned)
+	old := t.pinned.Swap(&pinned)
+
+	var previous []id.EventID
+	if old != nil {
+		previous = *old
+	}
+
+	for _, eventID := range previous {
+		if !slices.Contains(pinned, eventID) {
+			t.refreshMessage(safeHashClass(eventID.String()))
+		}
+	}
+	for _, eventID := range pinned {
+		if !slices.Contains(previous, eventID) {
+			t.refreshMessage(safeHashClass(eventID.String()))
+		}
+	}
+}
+
+func (t *MessageTree) isPinned(eventID string) bool {
+	pinned := t.pinned.Load()
+	return pinned != nil && slices.Contains(*pinned, id.EventID(eventID))
+}
+
+func (t *MessageTree) canPin() bool {
+	pl := t.powerLevels.Load()
+	if pl == nil {
+		return false
+	}
+	return pl.GetUserLevel(id.UserID(t.matrixSession.id)) >= pl.GetEventLevel(event.StatePinnedEvents)
+}
+
+// SetPinned pins or unpins an event. The list is read from the server first
+// so pins made elsewhere since the last sync aren't dropped.
+func (t *MessageTree) SetPinned(eventID string, pinned bool) error {
+	ctx := t.matrixSession.Context()
+	if !t.canPin() {
+		return fmt.Errorf("not allowed to pin messages in %s", t.roomID)
+	}
+
+	rid := id.RoomID(t.roomID)
+	client := t.matrixSession.GetClient()
+
+	var content event.PinnedEventsEventContent
+	err := client.StateEvent(ctx, rid, event.StatePinnedEvents, "", &content)
+	if err != nil && !errors.Is(err, mautrix.MNotFound) {
+		return fmt.Errorf("get pinned events: %w", err)
+	}
+
+	evtID := id.EventID(eventID)
+	if slices.Contains(content.Pinned, evtID) == pinned {
+		t.applyPins(content.Pinned)
+		return nil
+	}
+	if pinned {
+		content.Pinned = append(content.Pinned, evtID)
+	} else {
+		content.Pinned = slices.DeleteFunc(content.Pinned, func(e id.EventID) bool {
+			return e == evtID
+		})
+	}
+
+	if _, err := client.SendStateEvent(ctx, rid, event.StatePinnedEvents, "", &content); err != nil {
+		return fmt.Errorf("set pinned events: %w", err)
+	}
+	t.applyPins(content.Pinned)
+	return nil
+}
+
+// PinnedMessages returns the room's pinned messages, most recently pinned
+// first. Events that aren't in the tree are fetched and decrypted.
+func (t *MessageTree) PinnedMessages(ctx context.Context) []models.Message {
+	pinned := t.pinned.Load()
+	if pinned == nil {
+		return nil
+	}
+
+	canPin := t.canPin()
+	messages := make([]models.Message, 0, len(*pinned))
+	for _, eventID := range slices.Backward(*pinned) {
+		msg, ok := t.GetMessage(safeHashClass(eventID.String()))
+		if !ok || msg.IsDecrypting() {
+			msg = t.loadPinnedMessage(ctx, eventID)
+		}
+		msg.IsPinned = true
+		msg.CanPin = canPin
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func (t *MessageTree) loadPinnedMessage(ctx context.Context, eventID id.EventID) models.Message {
+	missing := models.Message{
+		ID:            safeHashClass(eventID.String()),
+		EventID:       eventID.String(),
+		RoomID:        t.roomID,
+		Undecryptable: true,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	evt, err := t.matrixSession.GetClient().GetEvent(ctx, id.RoomID(t.roomID), eventID)
+	if err != nil {
+		t.matrixSession.logger.Debug("failed to fetch pinned event", "eventID", eventID, "err", err)
+		return missing
+	}
+
+	missing.Author, _ = t.matrixSession.GetUserProfile(evt.Sender.String())
+	missing.Timestamp = time.UnixMilli(evt.Timestamp)
+
+	if evt.Unsigned.RedactedBecause != nil {
+		missing.Undecryptable = false
+		missing.Redacted = true
+		return missing
+	}
+
+	if evt.Type == event.EventEncrypted {
+		requestedSessions := xsync.NewMap[id.SessionID, struct{}]()
+		dec, err := t.handleEncrypted(ctx, requestedSessions, evt)
+		if err != nil {
+			return missing
+		}
+		evt = dec
+	}
+
+	_ = evt.Content.ParseRaw(evt.Type)
+	msg := t.eventToMessage(evt)
+	if msg == nil {
+		return missing
+	}
+	return *msg
+}
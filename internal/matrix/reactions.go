@@ -0,0 +1,261 @@
+package matrix
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+type reactionRef struct {
+	targetID string
+	key      string
+	sender   string
+}
+
+type reactionGroup struct {
+	keys    []string
+	senders map[string]map[string]id.EventID
+}
+
+// reactionIndex aggregates m.annotation events by the (hashed) ID of the
+// message they target so reactions that arrive before their target can be
+// applied once it is loaded.
+type reactionIndex struct {
+	mu       sync.Mutex
+	byTarget map[string]*reactionGroup
+	byEvent  map[id.EventID]reactionRef
+}
+
+func newReactionIndex() *reactionIndex {
+	return &reactionIndex{
+		byTarget: make(map[string]*reactionGroup),
+		byEvent:  make(map[id.EventID]reactionRef),
+	}
+}
+
+func (r *reactionIndex) add(targetID, key, sender string, evtID id.EventID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.byEvent[evtID]; ok {
+		return false
+	}
+
+	group, ok := r.byTarget[targetID]
+	if !ok {
+		group = &reactionGroup{senders: make(map[string]map[string]id.EventID)}
+		r.byTarget[targetID] = group
+	}
+
+	senders, ok := group.senders[key]
+	if !ok {
+		senders = make(map[string]id.EventID)
+		group.senders[key] = senders
+		group.keys = append(group.keys, key)
+	}
+
+	// a sender may only count once per key
+	if _, ok := senders[sender]; ok {
+		return false
+	}
+
+	senders[sender] = evtID
+	r.byEvent[evtID] = reactionRef{targetID: targetID, key: key, sender: sender}
+	return true
+}
+
+func (r *reactionIndex) remove(evtID id.EventID) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ref, ok := r.byEvent[evtID]
+	if !ok {
+		return "", false
+	}
+	delete(r.byEvent, evtID)
+
+	group, ok := r.byTarget[ref.targetID]
+	if !ok {
+		return ref.targetID, true
+	}
+
+	senders := group.senders[ref.key]
+	if senders[ref.sender] == evtID {
+		delete(senders, ref.sender)
+	}
+
+	if len(senders) == 0 {
+		delete(group.senders, ref.key)
+		for i, key := range group.keys {
+			if key == ref.key {
+				group.keys = append(group.keys[:i], group.keys[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if len(group.keys) == 0 {
+		delete(r.byTarget, ref.targetID)
+	}
+
+	return ref.targetID, true
+}
+
+// rename moves a reaction from its transaction ID to the event ID it was
+// sent as. If the sync echo got there first, the placeholder is dropped.
+func (r *reactionIndex) rename(oldID, newID id.EventID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ref, ok := r.byEvent[oldID]
+	if !ok {
+		return false
+	}
+	delete(r.byEvent, oldID)
+	if _, ok := r.byEvent[newID]; ok {
+		return true
+	}
+
+	r.byEvent[newID] = ref
+	if group, ok := r.byTarget[ref.targetID]; ok && group.senders[ref.key][ref.sender] == oldID {
+		group.senders[ref.key][ref.sender] = newID
+	}
+	return true
+}
+
+// forget drops every reaction to a message that left the tree.
+func (r *reactionIndex) forget(targetID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.byTarget[targetID]
+	if !ok {
+		return
+	}
+	for _, senders := range group.senders {
+		for _, evtID := range senders {
+			delete(r.byEvent, evtID)
+		}
+	}
+	delete(r.byTarget, targetID)
+}
+
+// events returns the reactions to a message by event ID, in no particular
+// order.
+func (r *reactionIndex) events(targetID string) map[id.EventID]reactionRef {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.byTarget[targetID]
+	if !ok {
+		return nil
+	}
+	events := make(map[id.EventID]reactionRef)
+	for key, senders := range group.senders {
+		for sender, evtID := range senders {
+			events[evtID] = reactionRef{targetID: targetID, key: key, sender: sender}
+		}
+	}
+	return events
+}
+
+func (r *reactionIndex) find(targetID, key, sender string) (id.EventID, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.byTarget[targetID]
+	if !ok {
+		return "", false
+	}
+
+	evtID, ok := group.senders[key][sender]
+	return evtID, ok
+}
+
+func (r *reactionIndex) summary(targetID, currentUserID string) []models.Reaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.byTarget[targetID]
+	if !ok {
+		return nil
+	}
+
+	reactions := make([]models.Reaction, 0, len(group.keys))
+	for _, key := range group.keys {
+		senders := group.senders[key]
+		_, mine := senders[currentUserID]
+		reactions = append(reactions, models.Reaction{
+			Emoji:          key,
+			Count:          len(senders),
+			HasCurrentUser: mine,
+		})
+	}
+	return reactions
+}
+
+func (t *MessageTree) handleReaction(evt *event.Event) {
+	if evt.Unsigned.RedactedBecause != nil {
+		return
+	}
+
+	_ = evt.Content.ParseRaw(evt.Type)
+	content, ok := evt.Content.Parsed.(*event.ReactionEventContent)
+	if !ok {
+		return
+	}
+
+	rel := content.RelatesTo
+	if rel.Type != event.RelAnnotation || rel.EventID == "" || rel.Key == "" {
+		return
+	}
+
+	targetID := safeHashClass(rel.EventID.String())
+	if t.reactions.add(targetID, rel.Key, evt.Sender.String(), evt.ID) {
+		t.refreshMessage(targetID)
+	}
+}
+
+func (t *MessageTree) ToggleReaction(messageID, key string) error {
+	ctx := t.matrixSession.Context()
+
+	msg, ok := t.GetMessage(messageID)
+	if !ok || msg.EventID == "" {
+		return fmt.Errorf("message %s not found", messageID)
+	}
+
+	client := t.matrixSession.GetClient()
+	rid := id.RoomID(t.roomID)
+	userID := t.matrixSession.id
+
+	if own, ok := t.reactions.find(messageID, key, userID); ok {
+		// a reaction that's still queued is taken back before it's sent
+		if strings.HasPrefix(own.String(), "pending-") {
+			return t.DiscardSend(own.String())
+		}
+		if _, err := client.RedactEvent(ctx, rid, own); err != nil {
+			return fmt.Errorf("redact reaction: %w", err)
+		}
+		if _, ok := t.reactions.remove(own); ok {
+			t.refreshMessage(messageID)
+		}
+		return nil
+	}
+
+	content := &event.ReactionEventContent{
+		RelatesTo: event.RelatesTo{
+			Type:    event.RelAnnotation,
+			EventID: id.EventID(msg.EventID),
+			Key:     key,
+		},
+	}
+
+	if err := t.queueRelation(event.EventReaction, content, messageID); err != nil {
+		return fmt.Errorf("send reaction: %w", err)
+	}
+	return nil
+}
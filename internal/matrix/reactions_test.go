@@ -0,0 +1,100 @@
+package matrix
+
+import (
+	"testing"
+
+	"github.com/arko-chat/arko/internal/models"
+)
+
+func TestReactionIndex_Summary(t *testing.T) {
+	const (
+		self  = "@test:example.com"
+		alice = "@alice:example.com"
+	)
+
+	tests := []struct {
+		name  string
+		steps func(r *reactionIndex)
+		want  []models.Reaction
+	}{
+		{
+			name: "reactions are grouped by key in order",
+			steps: func(r *reactionIndex) {
+				r.add("m1", "👍", alice, "$r1")
+				r.add("m1", "🎉", alice, "$r2")
+				r.add("m1", "👍", self, "$r3")
+			},
+			want: []models.Reaction{
+				{Emoji: "👍", Count: 2, HasCurrentUser: true},
+				{Emoji: "🎉", Count: 1},
+			},
+		},
+		{
+			name: "a sender counts once per key",
+			steps: func(r *reactionIndex) {
+				r.add("m1", "👍", alice, "$r1")
+				r.add("m1", "👍", alice, "$r2")
+			},
+			want: []models.Reaction{{Emoji: "👍", Count: 1}},
+		},
+		{
+			name: "duplicate events are ignored",
+			steps: func(r *reactionIndex) {
+				r.add("m1", "👍", alice, "$r1")
+				r.add("m2", "👍", alice, "$r1")
+			},
+			want: []models.Reaction{{Emoji: "👍", Count: 1}},
+		},
+		{
+			name: "toggling off removes the key",
+			steps: func(r *reactionIndex) {
+				r.add("m1", "👍", self, "$r1")
+				r.remove("$r1")
+			},
+		},
+		{
+			name: "removing one sender keeps the others",
+			steps: func(r *reactionIndex) {
+				r.add("m1", "👍", alice, "$r1")
+				r.add("m1", "👍", self, "$r2")
+				r.remove("$r2")
+			},
+			want: []models.Reaction{{Emoji: "👍", Count: 1}},
+		},
+		{
+			name: "toggling back on after removal",
+			steps: func(r *reactionIndex) {
+				r.add("m1", "👍", self, "$r1")
+				r.remove("$r1")
+				r.add("m1", "👍", self, "$r2")
+			},
+			want: []models.Reaction{{Emoji: "👍", Count: 1, HasCurrentUser: true}},
+		},
+		{
+			name: "a pending reaction is confirmed under its event ID",
+			steps: func(r *reactionIndex) {
+				r.add("m1", "👍", self, "pending-1")
+				r.rename("pending-1", "$r1")
+				r.remove("pending-1")
+			},
+			want: []models.Reaction{{Emoji: "👍", Count: 1, HasCurrentUser: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReactionIndex()
+			tt.steps(r)
+
+			got := r.summary("m1", self)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package matrix
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"github.com/puzpuzpuz/xsync/v4"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+type ReadState struct {
+	ReadEventID      string
+	ReadAt           time.Time
+	FullyReadEventID string
+	Unread           models.UnreadCount
+}
+
+// UnreadEvent carries the new counts for a room along with the DM partner
+// and parent spaces whose badges depend on it.
+type UnreadEvent struct {
+	RoomID   string
+	Unread   models.UnreadCount
+	DMUserID string
+	DMUnread models.UnreadCount
+	Spaces   []models.Space
+}
+
+func (m *MatrixSession) readState(roomID string) ReadState {
+	state, _ := m.readStates.Load(roomID)
+	return state
+}
+
+func (m *MatrixSession) updateReadState(roomID string, fn func(*ReadState)) (ReadState, ReadState) {
+	var before, after ReadState
+	m.readStates.Compute(roomID, func(state ReadState, loaded bool) (ReadState, xsync.ComputeOp) {
+		before = state
+		fn(&state)
+		after = state
+		return state, xsync.UpdateOp
+	})
+	return before, after
+}
+
+func (m *MatrixSession) handleReceipt(evt *event.Event) {
+	content, ok := evt.Content.Parsed.(*event.ReceiptEventContent)
+	if !ok {
+		return
+	}
+
+	var (
+		latest id.EventID
+		at     time.Time
+	)
+	for eventID, receipts := range *content {
+		for _, receiptType := range []event.ReceiptType{event.ReceiptTypeRead, event.ReceiptTypeReadPrivate} {
+			receipt, ok := receipts[receiptType][id.UserID(m.id)]
+			if !ok {
+				continue
+			}
+			// thread receipts don't move the room's read position
+			if receipt.ThreadID != "" && receipt.ThreadID != event.ReadReceiptThreadMain {
+				continue
+			}
+			if latest == "" || receipt.Timestamp.After(at) {
+				latest, at = eventID, receipt.Timestamp
+			}
+		}
+	}
+	if latest == "" {
+		return
+	}
+
+	m.updateReadState(evt.RoomID.String(), func(state *ReadState) {
+		if state.ReadAt.After(at) {
+			return
+		}
+		state.ReadEventID = latest.String()
+		state.ReadAt = at
+	})
+}
+
+func (m *MatrixSession) handleFullyRead(evt *event.Event) {
+	content, ok := evt.Content.Parsed.(*event.FullyReadEventContent)
+	if !ok || evt.RoomID == "" {
+		return
+	}
+
+	m.updateReadState(evt.RoomID.String(), func(state *ReadState) {
+		state.FullyReadEventID = content.EventID.String()
+	})
+}
+
+func (m *MatrixSession) handleUnreadCounts(ctx context.Context, resp *mautrix.RespSync, since string) bool {
+	for roomID, room := range resp.Rooms.Join {
+		if room.UnreadNotifications == nil {
+			continue
+		}
+
+		unread := models.UnreadCount{
+			Notifications: room.UnreadNotifications.NotificationCount,
+			Highlights:    room.UnreadNotifications.HighlightCount,
+		}
+		before, _ := m.updateReadState(roomID.String(), func(state *ReadState) {
+			state.Unread = unread
+		})
+		if before.Unread != unread {
+			go m.notifyUnread(roomID.String())
+		}
+	}
+	return true
+}
+
+func (m *MatrixSession) UnreadCount(roomID string) models.UnreadCount {
+	return m.readState(roomID).Unread
+}
+
+// LastReadID returns the event the user has fully read up to, falling back
+// to their read receipt.
+func (m *MatrixSession) LastReadID(roomID string) string {
+	state := m.readState(roomID)
+	if state.FullyReadEventID != "" {
+		return state.FullyReadEventID
+	}
+	if state.ReadEventID != "" {
+		return state.ReadEventID
+	}
+
+	// the marker isn't part of an incremental sync, so ask for it
+	var content event.FullyReadEventContent
+	err := m.GetClient().GetRoomAccountData(
+		m.Context(), id.RoomID(roomID), event.AccountDataFullyRead.Type, &content,
+	)
+	if err != nil || content.EventID == "" {
+		return ""
+	}
+
+	m.updateReadState(roomID, func(state *ReadState) {
+		if state.FullyReadEventID == "" {
+			state.FullyReadEventID = content.EventID.String()
+		}
+	})
+	return content.EventID.String()
+}
+
+// MarkRead moves the read receipt and fully read marker to the newest event
+// in the room.
+func (m *MatrixSession) MarkRead(roomID string) error {
+	tree := m.GetMessageTree(roomID)
+	latest := tree.latestEventID()
+	if latest == "" {
+		return nil
+	}
+
+	state := m.readState(roomID)
+	if state.ReadEventID == latest && state.FullyReadEventID == latest && state.Unread == (models.UnreadCount{}) {
+		return nil
+	}
+
+	err := m.GetClient().SetReadMarkers(m.Context(), id.RoomID(roomID), &mautrix.ReqSetReadMarkers{
+		Read:      id.EventID(latest),
+		FullyRead: id.EventID(latest),
+	})
+	if err != nil {
+		return err
+	}
+
+	before, _ := m.updateReadState(roomID, func(state *ReadState) {
+		state.ReadEventID = latest
+		state.ReadAt = time.Now()
+		state.FullyReadEventID = latest
+		state.Unread = models.UnreadCount{}
+	})
+	if before.Unread != (models.UnreadCount{}) {
+		go m.notifyUnread(roomID)
+	}
+	return nil
+}
+
+func (m *MatrixSession) UnreadEvents() <-chan UnreadEvent {
+	ch := make(chan UnreadEvent, 16)
+	m.unreadListeners.Store(ch, struct{}{})
+	return ch
+}
+
+func (m *MatrixSession) CloseUnreadListener(ch <-chan UnreadEvent) {
+	m.unreadListeners.Range(func(listener chan UnreadEvent, _ struct{}) bool {
+		if listener == ch {
+			m.unreadListeners.Delete(listener)
+			close(listener)
+			return false
+		}
+		return true
+	})
+}
+
+func (m *MatrixSession) notifyUnread(roomID string) {
+	evt := UnreadEvent{
+		RoomID: roomID,
+		Unread: m.UnreadCount(roomID),
+	}
+
+	if userID, rooms := m.dmPartner(roomID); userID != "" {
+		evt.DMUserID = userID
+		for _, r := range rooms {
+			evt.DMUnread = evt.DMUnread.Add(m.UnreadCount(r.String()))
+		}
+	}
+	evt.Spaces = m.parentSpaces(roomID)
+
+	m.unreadListeners.Range(func(ch chan UnreadEvent, _ struct{}) bool {
+		select {
+		case ch <- evt:
+		default:
+		}
+		return true
+	})
+}
+
+// dmPartner returns the user a DM room belongs to along with all of their DM
+// rooms, or an empty user ID for rooms that aren't DMs.
+func (m *MatrixSession) dmPartner(roomID string) (string, []id.RoomID) {
+	direct, err := m.directRooms()
+	if err != nil {
+		return "", nil
+	}
+	for userID, rooms := range direct {
+		if slices.Contains(rooms, id.RoomID(roomID)) {
+			return userID.String(), rooms
+		}
+	}
+	return "", nil
+}
+
+func (m *MatrixSession) parentSpaces(roomID string) []models.Space {
+	spaces, err := m.ListSpaces()
+	if err != nil {
+		return nil
+	}
+
+	var parents []models.Space
+	for _, space := range spaces {
+		children, err := m.getSpaceChildren(id.RoomID(space.ID))
+		if err != nil {
+			continue
+		}
+		if slices.ContainsFunc(children, func(c models.Channel) bool { return c.ID == roomID }) {
+			parents = append(parents, space)
+		}
+	}
+	return parents
+}
+
+// RoomParent returns the partner of a DM room, or otherwise the first space
+// the room belongs to.
+func (m *MatrixSession) RoomParent(roomID string) (string, string) {
+	if userID, _ := m.dmPartner(roomID); userID != "" {
+		return userID, ""
+	}
+	if spaces := m.parentSpaces(roomID); len(spaces) > 0 {
+		return "", spaces[0].ID
+	}
+	return "", ""
+}
+
+func (m *MatrixSession) withChannelUnread(channels []models.Channel) []models.Channel {
+	result := slices.Clone(channels)
+	for i := range result {
+		result[i].Unread = m.UnreadCount(result[i].ID)
+	}
+	return result
+}
+
+func (m *MatrixSession) withSpaceUnread(spaces []models.Space) []models.Space {
+	result := slices.Clone(spaces)
+	for i := range result {
+		children, err := m.getSpaceChildren(id.RoomID(result[i].ID))
+		if err != nil {
+			continue
+		}
+		var unread models.UnreadCount
+		for _, c := range children {
+			unread = unread.Add(m.UnreadCount(c.ID))
+		}
+		result[i].Unread = unread
+	}
+	return result
+}
+
+func (m *MatrixSession) withDMUnread(friends []models.User) []models.User {
+	direct, err := m.directRooms()
+	if err != nil {
+		return friends
+	}
+
+	result := slices.Clone(friends)
+	for i := range result {
+		var unread models.UnreadCount
+		for _, roomID := range direct[id.UserID(result[i].ID)] {
+			unread = unread.Add(m.UnreadCount(roomID.String()))
+		}
+		result[i].Unread = unread
+	}
+	return result
+}
+
+// latestEventID returns the newest message in the tree that the server knows
+// about, skipping local placeholders.
+func (t *MessageTree) latestEventID() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var latest string
+	t.Reverse(func(item models.Message) bool {
+		if item.EventID == "" || !strings.HasPrefix(item.EventID, "$") {
+			return true
+		}
+		latest = item.EventID
+		return false
+	})
+	return latest
+}
+
+func (t *MessageTree) LastReadID() string {
+	return t.matrixSession.LastReadID(t.roomID)
+}
@@ -0,0 +1,159 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+func (t *MessageTree) refreshPowerLevels(ctx context.Context) {
+	var pl event.PowerLevelsEventContent
+	err := t.matrixSession.GetClient().StateEvent(
+		ctx, id.RoomID(t.roomID), event.StatePowerLevels, "", &pl,
+	)
+	if err != nil {
+		t.matrixSession.logger.Warn("failed to fetch power levels", "roomID", t.roomID, "err", err)
+		return
+	}
+	t.applyPowerLevels(&pl)
+}
+
+func (t *MessageTree) handlePowerLevels(evt *event.Event) {
+	_ = evt.Content.ParseRaw(evt.Type)
+	if pl, ok := evt.Content.Parsed.(*event.PowerLevelsEventContent); ok {
+		t.applyPowerLevels(pl)
+	}
+}
+
+// applyPowerLevels stores the room's power levels and refreshes the
+// messages whose delete or pin permission changed.
+func (t *MessageTree) applyPowerLevels(pl *event.PowerLevelsEventContent) {
+	t.powerLevels.Store(pl)
+
+	var changed []string
+	t.mu.RLock()
+	t.BTreeG.Scan(func(m models.Message) bool {
+		if t.permissionsChanged(m) {
+			changed = append(changed, m.ID)
+		}
+		return true
+	})
+	t.mu.RUnlock()
+
+	t.threads.Range(func(_ string, th *Thread) bool {
+		for _, m := range th.Replies() {
+			if t.permissionsChanged(m) {
+				changed = append(changed, m.ID)
+			}
+		}
+		return true
+	})
+
+	for _, messageID := range changed {
+		t.refreshMessage(messageID)
+	}
+}
+
+func (t *MessageTree) permissionsChanged(m models.Message) bool {
+	if m.IsPending() || m.IsDecrypting() || m.Undecryptable || m.Redacted {
+		return false
+	}
+	return m.CanRedact != t.canRedact(&m) || m.CanPin != t.canPin()
+}
+
+// deferRedaction holds on to a redaction of a message that's being deleted
+// from here. Set applies it when the placeholder resolves, even if the
+// request itself reported a failure.
+func (t *MessageTree) deferRedaction(messageID string, evt *event.Event) bool {
+	deleting := false
+	t.nonces.Range(func(_ string, m *models.Message) bool {
+		deleting = m.Deleting && m.EventID == redactedEventID(evt).String()
+		return !deleting
+	})
+	if deleting {
+		t.pendingRedactions.Store(messageID, evt)
+	}
+	return deleting
+}
+
+func (t *MessageTree) PowerLevels() *event.PowerLevelsEventContent {
+	return t.powerLevels.Load()
+}
+
+func (t *MessageTree) canRedact(m *models.Message) bool {
+	pl := t.powerLevels.Load()
+	if pl == nil {
+		return m.IsOwn
+	}
+
+	level := pl.GetUserLevel(id.UserID(t.matrixSession.id))
+	if level < pl.GetEventLevel(event.EventRedaction) {
+		return false
+	}
+	return m.IsOwn || level >= pl.Redact()
+}
+
+func (t *MessageTree) RedactMessage(messageID, reason string) error {
+	ctx := t.matrixSession.Context()
+
+	msg, ok := t.GetMessage(messageID)
+	if !ok || msg.EventID == "" {
+		return fmt.Errorf("message %s not found", messageID)
+	}
+	if !msg.CanRedact {
+		return fmt.Errorf("not allowed to delete message %s", messageID)
+	}
+	msg.DeleteFailed = false
+
+	rid := id.RoomID(t.roomID)
+	client := t.matrixSession.GetClient()
+	req := mautrix.ReqRedact{Reason: reason}
+
+	if msg.ThreadRootID != "" {
+		if _, err := client.RedactEvent(ctx, rid, id.EventID(msg.EventID), req); err != nil {
+			return fmt.Errorf("redact: %w", err)
+		}
+		t.updateThreadReply(messageID, func(m *models.Message) {
+			m.Content = reason
+			m.Redacted = true
+		})
+		return nil
+	}
+
+	nonce, err := generateNonce()
+	if err != nil {
+		return err
+	}
+
+	// swap the message for a pending placeholder so the usual nonce
+	// replacement in Set resolves it to either the redacted or the
+	// original message
+	t.mu.Lock()
+	t.messagesMap.Delete(msg.ID)
+	t.mu.Unlock()
+	t.DeleteMessage(msg)
+
+	placeholder := msg
+	placeholder.ID = nonce
+	placeholder.Deleting = true
+	t.Set(placeholder)
+
+	if _, err := client.RedactEvent(ctx, rid, id.EventID(msg.EventID), req); err != nil {
+		failed := msg
+		failed.Nonce = nonce
+		failed.DeleteFailed = true
+		t.Set(failed)
+		return fmt.Errorf("redact: %w", err)
+	}
+
+	redacted := msg
+	redacted.Nonce = nonce
+	redacted.Content = reason
+	redacted.Redacted = true
+	t.Set(redacted)
+	return nil
+}
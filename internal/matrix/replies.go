@@ -0,0 +1,146 @@
+package matrix
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"github.com/puzpuzpuz/xsync/v4"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+func replyParent(content *event.MessageEventContent) id.EventID {
+	rel := content.RelatesTo
+	if rel == nil || rel.InReplyTo == nil || rel.IsFallingBack {
+		return ""
+	}
+	return rel.InReplyTo.EventID
+}
+
+func stripReplyFallback(body string) string {
+	lines := strings.Split(body, "\n")
+
+	i := 0
+	for i < len(lines) && (strings.HasPrefix(lines[i], "> ") || lines[i] == ">") {
+		i++
+	}
+	if i == 0 {
+		return body
+	}
+	if i < len(lines) && lines[i] == "" {
+		i++
+	}
+	return strings.Join(lines[i:], "\n")
+}
+
+func previewFromMessage(msg models.Message) models.ReplyPreview {
+	return models.ReplyPreview{
+		ID:      msg.ID,
+		EventID: msg.EventID,
+		Author:  msg.Author,
+		Content: msg.Content,
+		Missing: msg.Redacted || msg.Undecryptable,
+	}
+}
+
+func (t *MessageTree) replyPreview(messageID string, parent id.EventID) *models.ReplyPreview {
+	parentID := safeHashClass(parent.String())
+
+	if msg, ok := t.GetMessage(parentID); ok && !msg.IsDecrypting() {
+		preview := previewFromMessage(msg)
+		return &preview
+	}
+
+	if preview, ok := t.replyPreviews.Load(parentID); ok {
+		return &preview
+	}
+
+	fetching := false
+	t.replyWaiters.Compute(parentID, func(waiters []string, loaded bool) ([]string, xsync.ComputeOp) {
+		fetching = loaded
+		return append(waiters, messageID), xsync.UpdateOp
+	})
+	if !fetching {
+		go t.fetchReplyPreview(parent)
+	}
+
+	return &models.ReplyPreview{
+		ID:      parentID,
+		EventID: parent.String(),
+		Loading: true,
+	}
+}
+
+func (t *MessageTree) resolveReplyPreview(m *models.Message) {
+	if m.ReplyTo == nil || !m.ReplyTo.Loading {
+		return
+	}
+	if preview, ok := t.replyPreviews.Load(m.ReplyTo.ID); ok {
+		m.ReplyTo = &preview
+	}
+}
+
+func (t *MessageTree) fetchReplyPreview(parent id.EventID) {
+	parentID := safeHashClass(parent.String())
+
+	preview := t.loadReplyPreview(t.matrixSession.Context(), parent)
+	t.replyPreviews.Store(parentID, preview)
+
+	waiters, _ := t.replyWaiters.LoadAndDelete(parentID)
+	for _, messageID := range waiters {
+		t.updateMessage(messageID, t.resolveReplyPreview)
+	}
+}
+
+func (t *MessageTree) loadReplyPreview(ctx context.Context, parent id.EventID) models.ReplyPreview {
+	missing := models.ReplyPreview{
+		ID:      safeHashClass(parent.String()),
+		EventID: parent.String(),
+		Missing: true,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	evt, err := t.matrixSession.GetClient().GetEvent(ctx, id.RoomID(t.roomID), parent)
+	if err != nil {
+		t.matrixSession.logger.Debug("failed to fetch reply parent", "eventID", parent, "err", err)
+		return missing
+	}
+
+	profile, _ := t.matrixSession.GetUserProfile(evt.Sender.String())
+	missing.Author = profile
+
+	if evt.Unsigned.RedactedBecause != nil {
+		return missing
+	}
+
+	if evt.Type == event.EventEncrypted {
+		requestedSessions := xsync.NewMap[id.SessionID, struct{}]()
+		dec, err := t.handleEncrypted(ctx, requestedSessions, evt)
+		if err != nil {
+			return missing
+		}
+		evt = dec
+	}
+
+	_ = evt.Content.ParseRaw(evt.Type)
+	content, ok := evt.Content.Parsed.(*event.MessageEventContent)
+	if !ok {
+		return missing
+	}
+
+	body := content.Body
+	if replyParent(content) != "" {
+		body = stripReplyFallback(body)
+	}
+
+	return models.ReplyPreview{
+		ID:      missing.ID,
+		EventID: missing.EventID,
+		Author:  profile,
+		Content: body,
+	}
+}
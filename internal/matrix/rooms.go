@@ -2,10 +2,12 @@ package matrix
 
 import (
 	"cmp"
+	"context"
 	"fmt"
 	"math/rand/v2"
 	"slices"
 
+	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 
@@ -92,6 +94,14 @@ func (m *MatrixSession) getRoomAvatar(roomID id.RoomID) string {
 }
 
 func (m *MatrixSession) ListSpaces() ([]models.Space, error) {
+	spaces, err := m.listSpaces()
+	if err != nil {
+		return nil, err
+	}
+	return m.withSpaceUnread(spaces), nil
+}
+
+func (m *MatrixSession) listSpaces() ([]models.Space, error) {
 	return m.spacesCache.Get("ls:"+m.id, func() ([]models.Space, error) {
 		resp, err := m.client.JoinedRooms(m.context)
 		if err != nil {
@@ -118,10 +128,23 @@ func (m *MatrixSession) ListSpaces() ([]models.Space, error) {
 				Status:  "Online",
 				Address: encodeRoomID(roomID.String()),
 			})
+		}
 
-			go m.getSpaceChildren(roomID)
-			go m.getRoomMembers(roomID)
+		// subspaces are shown as categories of the spaces they're in
+		nested := make(map[string]struct{})
+		for _, space := range spaces {
+			categories, err := m.getSpaceCategories(id.RoomID(space.ID))
+			if err != nil || len(categories) == 0 {
+				continue
+			}
+			for _, category := range categories[1:] {
+				nested[category.ID] = struct{}{}
+			}
 		}
+		spaces = slices.DeleteFunc(spaces, func(s models.Space) bool {
+			_, ok := nested[s.ID]
+			return ok
+		})
 
 		slices.SortFunc(spaces, func(a, b models.Space) int {
 			return cmp.Compare(a.Name, b.Name)
@@ -136,9 +159,14 @@ func (m *MatrixSession) GetSpaceDetail(spaceID string) (models.SpaceDetail, erro
 	name := m.getRoomName(roomID)
 	avatar := m.getRoomAvatar(roomID)
 
-	children, err := m.getSpaceChildren(roomID)
-	if err != nil {
-		children = nil
+	var channels []models.Channel
+	var categories []models.Category
+	if all, err := m.getSpaceCategories(roomID); err == nil && len(all) > 0 {
+		channels = m.withChannelUnread(all[0].Channels)
+		categories = slices.Clone(all[1:])
+		for i := range categories {
+			categories[i].Channels = m.withChannelUnread(categories[i].Channels)
+		}
 	}
 
 	members, err := m.getRoomMembers(roomID)
@@ -153,12 +181,13 @@ func (m *MatrixSession) GetSpaceDetail(spaceID string) (models.SpaceDetail, erro
 	}
 
 	return models.SpaceDetail{
-		ID:        spaceID,
-		Name:      name,
-		Avatar:    avatar,
-		Channels:  children,
-		Users:     members,
-		InviteURL: shareUrl,
+		ID:         spaceID,
+		Name:       name,
+		Avatar:     avatar,
+		Channels:   channels,
+		Categories: categories,
+		Users:      members,
+		InviteURL:  shareUrl,
 	}, nil
 }
 
@@ -207,57 +236,27 @@ func (m *MatrixSession) getUrls(roomID id.RoomID) ([]string, error) {
 	})
 }
 
-func (m *MatrixSession) getSpaceChildren(
-	spaceID id.RoomID,
-) ([]models.Channel, error) {
-	return m.channelsCache.Get("gsc:"+spaceID.String(), func() ([]models.Channel, error) {
-		stateMap, err := m.client.State(m.context, spaceID)
-		if err != nil {
-			return nil, err
-		}
-
-		childEvents, ok := stateMap[event.StateSpaceChild]
-		if !ok {
-			return nil, nil
-		}
-
-		var channels []models.Channel
-		for stateKey, childEvent := range childEvents {
-			content, ok := childEvent.Content.Parsed.(*event.SpaceChildEventContent)
-			if !ok || content == nil || len(content.Via) == 0 {
-				continue
-			}
-
-			childRoomID := id.RoomID(stateKey)
-			childName := m.getRoomName(childRoomID)
-
-			channels = append(channels, models.Channel{
-				ID:      childRoomID.String(),
-				Name:    childName,
-				Type:    models.ChannelText,
-				SpaceID: spaceID.String(),
-			})
-
-			go func() {
-				tree := m.GetMessageTree(string(childRoomID))
-				tree.Initialize(m.context)
-			}()
-		}
-
-		slices.SortFunc(channels, func(a, b models.Channel) int {
-			return cmp.Compare(a.Name, b.Name)
-		})
-
-		return channels, nil
+func (m *MatrixSession) directRooms() (map[id.UserID][]id.RoomID, error) {
+	return m.directCache.Get("dr:"+m.id, func() (map[id.UserID][]id.RoomID, error) {
+		var dmMap map[id.UserID][]id.RoomID
+		err := m.client.GetAccountData(
+			m.context, event.AccountDataDirectChats.Type, &dmMap,
+		)
+		return dmMap, err
 	})
 }
 
 func (m *MatrixSession) ListDirectMessages() ([]models.User, error) {
+	friends, err := m.listDirectMessages()
+	if err != nil {
+		return nil, err
+	}
+	return m.withDMUnread(friends), nil
+}
+
+func (m *MatrixSession) listDirectMessages() ([]models.User, error) {
 	return m.dmCache.Get("ldm:"+m.id, func() ([]models.User, error) {
-		var dmMap map[id.UserID][]id.RoomID
-		err := m.client.GetAccountData(
-			m.context, event.AccountDataDirectChats.Type, &dmMap,
-		)
+		dmMap, err := m.directRooms()
 		if err != nil {
 			return nil, fmt.Errorf("get dm list: %w", err)
 		}
@@ -295,10 +294,7 @@ func (m *MatrixSession) ListDirectMessages() ([]models.User, error) {
 }
 
 func (m *MatrixSession) GetDMRoomID(otherUserID string) (string, error) {
-	var dmMap map[id.UserID][]id.RoomID
-	err := m.client.GetAccountData(
-		m.context, event.AccountDataDirectChats.Type, &dmMap,
-	)
+	dmMap, err := m.directRooms()
 	if err != nil {
 		return "", err
 	}
@@ -332,17 +328,21 @@ func (m *MatrixSession) GetChannel(
 	}, nil
 }
 
+func (m *MatrixSession) GetRoomMembers(roomID string) ([]models.User, error) {
+	return m.getRoomMembers(id.RoomID(roomID))
+}
+
 func (m *MatrixSession) getRoomMembers(
 	roomID id.RoomID,
 ) ([]models.User, error) {
 	return m.membersCache.Get("grm:"+roomID.String(), func() ([]models.User, error) {
-		members, err := m.client.Members(m.context, roomID)
+		members, err := m.joinedMembers(m.context, roomID)
 		if err != nil {
 			return nil, err
 		}
 
 		var users []models.User
-		for _, evt := range members.Chunk {
+		for _, evt := range members {
 			content, ok := evt.Content.Parsed.(*event.MemberEventContent)
 			if !ok || content.Membership != event.MembershipJoin {
 				continue
@@ -371,3 +371,16 @@ func (m *MatrixSession) getRoomMembers(
 		return users, nil
 	})
 }
+
+// joinedMembers fetches a room's joined members from the server. Sync lazy
+// loads members, so room state alone doesn't list everyone; /members also
+// fills the state store in for the crypto machine.
+func (m *MatrixSession) joinedMembers(ctx context.Context, roomID id.RoomID) ([]*event.Event, error) {
+	resp, err := m.GetClient().Members(ctx, roomID, mautrix.ReqMembers{
+		Membership: event.MembershipJoin,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Chunk, nil
+}
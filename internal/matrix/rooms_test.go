@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/arko-chat/arko/internal/cache"
@@ -55,11 +57,16 @@ func newTestMatrixSessionWithServer(mockServer *mockMatrixServer) *MatrixSession
 		userCache:             cache.NewDefault[models.User](),
 		aliasesCache:          cache.NewDefault[[]string](),
 		roomCache:             cache.NewDefault[string](),
-		channelsCache:         cache.NewDefault[[]models.Channel](),
+		channelsCache:         cache.NewDefault[[]models.Category](),
 		spacesCache:           cache.NewDefault[[]models.Space](),
 		dmCache:               cache.NewDefault[[]models.User](),
+		directCache:           cache.NewDefault[map[id.UserID][]id.RoomID](),
 		membersCache:          cache.NewDefault[[]models.User](),
 		messageTrees:          xsync.NewMap[string, *MessageTree](),
+		readStates:            xsync.NewMap[string, ReadState](),
+		unreadListeners:       xsync.NewMap[chan UnreadEvent, struct{}](),
+		notificationListeners: xsync.NewMap[chan NotificationEvent, struct{}](),
+		inviteListeners:       xsync.NewMap[chan InviteEvent, struct{}](),
 		verificationListeners: xsync.NewMap[uint64, chan VerificationEvent](),
 		listeners:             xsync.NewMap[uint64, chan *event.Event](),
 	}
@@ -432,6 +439,9 @@ func TestGetRoomMembers_Success(t *testing.T) {
 	defer server.Close()
 
 	server.mux.HandleFunc("/_matrix/client/v3/rooms/!room:example.com/members", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("membership"); got != "join" {
+			t.Errorf("expected membership=join, got %q", got)
+		}
 		json.NewEncoder(w).Encode(mautrix.RespMembers{
 			Chunk: []*event.Event{
 				{
@@ -518,11 +528,11 @@ func TestGetUrls_GetAliasesError(t *testing.T) {
 	}
 }
 
-func TestGetSpaceChildren_StateError(t *testing.T) {
+func TestGetSpaceChildren_HierarchyError(t *testing.T) {
 	server := newMockMatrixServer()
 	defer server.Close()
 
-	server.mux.HandleFunc("/_matrix/client/v3/rooms/!space:example.com/state", func(w http.ResponseWriter, r *http.Request) {
+	server.mux.HandleFunc("/_matrix/client/v1/rooms/!space:example.com/hierarchy", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 	})
 
@@ -534,3 +544,142 @@ func TestGetSpaceChildren_StateError(t *testing.T) {
 		t.Error("expected error, got nil")
 	}
 }
+
+func TestGetSpaceCategories_NestedSpaces(t *testing.T) {
+	server := newMockMatrixServer()
+	defer server.Close()
+
+	child := func(roomID, order string, suggested bool) map[string]any {
+		return map[string]any{
+			"type":      "m.space.child",
+			"state_key": roomID,
+			"content": map[string]any{
+				"via":       []string{"example.com"},
+				"order":     order,
+				"suggested": suggested,
+			},
+		}
+	}
+
+	server.mux.HandleFunc("/_matrix/client/v1/rooms/!space:example.com/hierarchy", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"rooms": []map[string]any{
+				{
+					"room_id":   "!space:example.com",
+					"name":      "Space",
+					"room_type": "m.space",
+					"children_state": []map[string]any{
+						child("!general:example.com", "b", false),
+						child("!sub:example.com", "", false),
+						child("!rules:example.com", "a", true),
+						{
+							"type":      "m.space.child",
+							"state_key": "!removed:example.com",
+							"content":   map[string]any{},
+						},
+					},
+				},
+				{"room_id": "!general:example.com", "name": "general"},
+				{"room_id": "!rules:example.com", "name": "rules"},
+				{"room_id": "!removed:example.com", "name": "removed"},
+				{
+					"room_id":   "!sub:example.com",
+					"name":      "Projects",
+					"room_type": "m.space",
+					"children_state": []map[string]any{
+						child("!arko:example.com", "", false),
+					},
+				},
+				{"room_id": "!arko:example.com", "name": "arko"},
+			},
+		})
+	})
+
+	server.mux.HandleFunc("/_matrix/client/v3/joined_rooms", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(mautrix.RespJoinedRooms{
+			JoinedRooms: []id.RoomID{"!space:example.com", "!sub:example.com"},
+		})
+	})
+
+	session := newTestMatrixSessionWithServer(server)
+	defer session.Close()
+
+	categories, err := session.getSpaceCategories("!space:example.com")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(categories) != 2 {
+		t.Fatalf("expected 2 categories, got %d", len(categories))
+	}
+
+	root := categories[0]
+	if len(root.Channels) != 2 {
+		t.Fatalf("expected 2 top-level channels, got %d", len(root.Channels))
+	}
+	if root.Channels[0].ID != "!rules:example.com" || root.Channels[1].ID != "!general:example.com" {
+		t.Errorf("expected channels ordered by order string, got %s, %s", root.Channels[0].ID, root.Channels[1].ID)
+	}
+	if !root.Channels[0].Suggested {
+		t.Error("expected rules to be suggested")
+	}
+	if !root.Channels[0].Joinable {
+		t.Error("expected unjoined channel to be joinable")
+	}
+
+	sub := categories[1]
+	if sub.ID != "!sub:example.com" || sub.Name != "Projects" || sub.Joinable {
+		t.Errorf("unexpected category %+v", sub)
+	}
+	if len(sub.Channels) != 1 || sub.Channels[0].CategoryID != "!sub:example.com" {
+		t.Errorf("expected arko in the Projects category, got %+v", sub.Channels)
+	}
+	if sub.Channels[0].SpaceID != "!space:example.com" {
+		t.Errorf("expected channel to belong to the top-level space, got %s", sub.Channels[0].SpaceID)
+	}
+}
+
+func TestLeaveSpace_LeavesJoinedChildren(t *testing.T) {
+	server := newMockMatrixServer()
+	defer server.Close()
+
+	server.mux.HandleFunc("/_matrix/client/v1/rooms/!space:example.com/hierarchy", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"rooms": []map[string]any{
+				{"room_id": "!space:example.com", "name": "Space", "room_type": "m.space"},
+				{"room_id": "!general:example.com", "name": "general"},
+				{"room_id": "!other:example.com", "name": "other"},
+			},
+		})
+	})
+
+	server.mux.HandleFunc("/_matrix/client/v3/joined_rooms", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(mautrix.RespJoinedRooms{
+			JoinedRooms: []id.RoomID{"!space:example.com", "!general:example.com"},
+		})
+	})
+
+	var left []string
+	server.mux.HandleFunc("/_matrix/client/v3/rooms/", func(w http.ResponseWriter, r *http.Request) {
+		roomID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/_matrix/client/v3/rooms/"), "/")
+		if action != "leave" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		left = append(left, roomID)
+		w.Write([]byte("{}"))
+	})
+
+	session := newTestMatrixSessionWithServer(server)
+	defer session.Close()
+
+	err := session.LeaveSpace(LeaveSpaceParams{SpaceID: "!space:example.com", LeaveChildren: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []string{"!general:example.com", "!space:example.com"}
+	if !slices.Equal(left, expected) {
+		t.Errorf("expected to leave %v, got %v", expected, left)
+	}
+}
@@ -0,0 +1,267 @@
+package matrix
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"github.com/arko-chat/arko/internal/search"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+const (
+	searchSaveInterval = time.Minute
+	defaultSearchLimit = 50
+)
+
+type reqSearch struct {
+	SearchCategories searchCategories `json:"search_categories"`
+}
+
+type searchCategories struct {
+	RoomEvents searchRoomEvents `json:"room_events"`
+}
+
+type searchRoomEvents struct {
+	SearchTerm string        `json:"search_term"`
+	Keys       []string      `json:"keys,omitempty"`
+	Filter     *searchFilter `json:"filter,omitempty"`
+	OrderBy    string        `json:"order_by,omitempty"`
+}
+
+type searchFilter struct {
+	Rooms   []string `json:"rooms,omitempty"`
+	Senders []string `json:"senders,omitempty"`
+	Limit   int      `json:"limit,omitempty"`
+}
+
+type respSearch struct {
+	SearchCategories struct {
+		RoomEvents struct {
+			Results []struct {
+				Rank   float64      `json:"rank"`
+				Result *event.Event `json:"result"`
+			} `json:"results"`
+		} `json:"room_events"`
+	} `json:"search_categories"`
+}
+
+func loadSearchIndex(path string, key []byte, logger *slog.Logger) *search.Index {
+	f, err := os.Open(path)
+	if err != nil {
+		return search.New()
+	}
+	defer f.Close()
+
+	ix, err := search.Load(f, key)
+	if err != nil {
+		logger.Warn("discarding unreadable search index", "err", err)
+		return search.New()
+	}
+	return ix
+}
+
+func (m *MatrixSession) persistSearchIndex(ctx context.Context) {
+	ticker := time.NewTicker(searchSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.saveSearchIndex()
+		}
+	}
+}
+
+func (m *MatrixSession) saveSearchIndex() {
+	if m.searchIndex == nil || m.searchPath == "" || !m.searchIndex.Dirty() {
+		return
+	}
+
+	tmp := m.searchPath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		m.logger.Warn("failed to save search index", "err", err)
+		return
+	}
+
+	err = m.searchIndex.Save(f, m.searchKey)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, m.searchPath)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		m.logger.Warn("failed to save search index", "err", err)
+	}
+}
+
+// indexMessage keeps the local index in step with decrypted messages, which
+// the server has no way to search.
+func (m *MatrixSession) indexMessage(msg models.Message) {
+	if m.searchIndex == nil || msg.EventID == "" {
+		return
+	}
+	if msg.Redacted || msg.Undecryptable || msg.IsSystem || msg.Content == "" {
+		m.searchIndex.Remove(msg.EventID)
+		return
+	}
+
+	m.searchIndex.Add(search.Document{
+		EventID:    msg.EventID,
+		RoomID:     msg.RoomID,
+		SenderID:   msg.Author.ID,
+		SenderName: msg.Author.Name,
+		Body:       msg.Content,
+		Timestamp:  msg.Timestamp,
+	})
+}
+
+func (m *MatrixSession) unindexMessage(msg models.Message) {
+	if m.searchIndex == nil || msg.EventID == "" {
+		return
+	}
+	m.searchIndex.Remove(msg.EventID)
+}
+
+// SearchMessages combines the server's results for unencrypted rooms with the
+// local index of encrypted ones. Each source is scaled to its own best score
+// so neither drowns out the other.
+func (m *MatrixSession) SearchMessages(q search.Query) ([]models.SearchResult, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultSearchLimit
+	}
+
+	var results []models.SearchResult
+
+	if !m.onlyEncryptedRooms(q.RoomIDs) {
+		remote, err := m.searchServer(q)
+		if err != nil {
+			m.logger.Debug("server search failed", "err", err)
+		}
+		results = append(results, normalizeScores(remote)...)
+	}
+
+	if m.searchIndex != nil {
+		var local []models.SearchResult
+		for _, r := range m.searchIndex.Search(q) {
+			msg, ok := m.GetMessageTree(r.RoomID).GetMessage(safeHashClass(r.EventID))
+			if !ok {
+				msg = models.Message{
+					ID:        safeHashClass(r.EventID),
+					EventID:   r.EventID,
+					RoomID:    r.RoomID,
+					Content:   r.Body,
+					Timestamp: r.Timestamp,
+					Author:    models.User{ID: r.SenderID, Name: r.SenderName},
+				}
+			}
+			local = append(local, models.SearchResult{Message: msg, Score: r.Score})
+		}
+		results = append(results, normalizeScores(local)...)
+	}
+
+	seen := make(map[string]struct{}, len(results))
+	merged := results[:0]
+	for _, r := range results {
+		if _, ok := seen[r.Message.EventID]; ok {
+			continue
+		}
+		seen[r.Message.EventID] = struct{}{}
+		r.RoomName = m.getRoomName(id.RoomID(r.Message.RoomID))
+		merged = append(merged, r)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].Score != merged[j].Score {
+			return merged[i].Score > merged[j].Score
+		}
+		return merged[i].Message.Timestamp.After(merged[j].Message.Timestamp)
+	})
+
+	if len(merged) > q.Limit {
+		merged = merged[:q.Limit]
+	}
+	return merged, nil
+}
+
+func (m *MatrixSession) onlyEncryptedRooms(roomIDs []string) bool {
+	if len(roomIDs) == 0 {
+		return false
+	}
+	for _, roomID := range roomIDs {
+		if !m.GetMessageTree(roomID).IsE2EE() {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MatrixSession) searchServer(q search.Query) ([]models.SearchResult, error) {
+	client := m.GetClient()
+
+	filter := &searchFilter{Rooms: q.RoomIDs, Limit: q.Limit}
+	// display name matches can only be checked once results are back
+	if search.IsUserID(q.Sender) {
+		filter.Senders = []string{q.Sender}
+	}
+
+	req := reqSearch{SearchCategories: searchCategories{RoomEvents: searchRoomEvents{
+		SearchTerm: q.Text,
+		Keys:       []string{"content.body"},
+		Filter:     filter,
+		OrderBy:    "rank",
+	}}}
+
+	var resp respSearch
+	_, err := client.MakeRequest(m.Context(), "POST", client.BuildClientURL("v3", "search"), req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.SearchResult
+	for _, r := range resp.SearchCategories.RoomEvents.Results {
+		evt := r.Result
+		if evt == nil {
+			continue
+		}
+		if err := evt.Content.ParseRaw(evt.Type); err != nil {
+			continue
+		}
+
+		ts := time.UnixMilli(evt.Timestamp)
+		if (!q.After.IsZero() && ts.Before(q.After)) || (!q.Before.IsZero() && !ts.Before(q.Before)) {
+			continue
+		}
+
+		msg := m.GetMessageTree(evt.RoomID.String()).eventToMessage(evt)
+		if msg == nil || !q.MatchesSender(msg.Author.ID, msg.Author.Name) {
+			continue
+		}
+		results = append(results, models.SearchResult{Message: *msg, Score: r.Rank})
+	}
+	return results, nil
+}
+
+func normalizeScores(results []models.SearchResult) []models.SearchResult {
+	var best float64
+	for _, r := range results {
+		best = max(best, r.Score)
+	}
+	for i := range results {
+		if best > 0 {
+			results[i].Score /= best
+		} else {
+			results[i].Score = 1
+		}
+	}
+	return results
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/arko-chat/arko/internal/cache"
 	"github.com/arko-chat/arko/internal/models"
+	"github.com/arko-chat/arko/internal/search"
 	"github.com/arko-chat/arko/internal/session"
 	"github.com/puzpuzpuz/xsync/v4"
 	"maunium.net/go/mautrix"
@@ -24,6 +25,7 @@ import (
 	"maunium.net/go/mautrix/crypto/verificationhelper"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/pushrules"
 )
 
 type MatrixSession struct {
@@ -47,20 +49,41 @@ type MatrixSession struct {
 	listeners             *xsync.Map[uint64, chan *event.Event]
 	idCounter             atomic.Uint64
 	typingTracker         *TypingTracker
+	ignored               atomic.Pointer[map[string]struct{}]
 
 	crossSigningEvent chan struct{}
 
-	profileCache  *cache.Cache[models.User]
-	verifiedCache *cache.Cache[bool]
-	userCache     *cache.Cache[models.User]
-	aliasesCache  *cache.Cache[[]string]
-	roomCache     *cache.Cache[string]
-	channelsCache *cache.Cache[[]models.Channel]
-	spacesCache   *cache.Cache[[]models.Space]
-	dmCache       *cache.Cache[[]models.User]
-	membersCache  *cache.Cache[[]models.User]
-
-	messageTrees *xsync.Map[string, *MessageTree]
+	profileCache   *cache.Cache[models.User]
+	verifiedCache  *cache.Cache[bool]
+	userCache      *cache.Cache[models.User]
+	aliasesCache   *cache.Cache[[]string]
+	roomCache      *cache.Cache[string]
+	channelsCache  *cache.Cache[[]models.Category]
+	spacesCache    *cache.Cache[[]models.Space]
+	dmCache        *cache.Cache[[]models.User]
+	directCache    *cache.Cache[map[id.UserID][]id.RoomID]
+	membersCache   *cache.Cache[[]models.User]
+	mediaCache     *cache.Cache[int64]
+	stickersCache  *cache.Cache[[]models.StickerPack]
+	pushRulesCache *cache.Cache[*pushrules.PushRuleset]
+
+	messageTrees   *xsync.Map[string, *MessageTree]
+	encryptedMedia *xsync.Map[string, *EncryptedMedia]
+
+	readStates      *xsync.Map[string, ReadState]
+	unreadListeners *xsync.Map[chan UnreadEvent, struct{}]
+
+	notificationListeners *xsync.Map[chan NotificationEvent, struct{}]
+	inviteListeners       *xsync.Map[chan InviteEvent, struct{}]
+	catchingUp            atomic.Bool
+
+	searchIndex *search.Index
+	searchPath  string
+	searchKey   []byte
+
+	timelineCache *timelineCache
+	outbox        *outbox
+	invites       *inviteStore
 }
 
 func (m *MatrixSession) Context() context.Context {
@@ -102,12 +125,16 @@ func (m *MatrixSession) GetVerificationUIState() *VerificationUIState {
 func (m *Manager) NewMatrixSession(ctx context.Context, client *mautrix.Client, logger *slog.Logger) (*MatrixSession, error) {
 	ctx, cancel := context.WithCancel(ctx)
 
-	dbPath := fmt.Sprintf(
-		"%s/%s.db",
-		m.cryptoDBPath,
-		url.PathEscape(string(client.UserID)),
-	)
+	dbPath, searchPath := m.storePaths(client.UserID.String())
 	s, err := session.UpdateAndGet(string(client.UserID), func(s *session.Session) {
+		if len(s.SearchKey) == 0 {
+			searchKey, err := generatePickleKey()
+			if err == nil {
+				s.SearchKey = searchKey
+			}
+			_ = os.Remove(searchPath)
+		}
+
 		if len(s.PickleKey) > 0 && s.LoggedIn {
 			return
 		}
@@ -117,13 +144,22 @@ func (m *Manager) NewMatrixSession(ctx context.Context, client *mautrix.Client,
 			s.PickleKey = pickleKey
 		}
 
-		_ = os.Remove(dbPath)
+		// a new login can't reuse the previous device's sync token or keys
+		removeStoreFiles(dbPath)
+		_ = os.Remove(searchPath)
 	})
 
+	db, err := openClientStores(ctx, client, dbPath)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
 	helper, err := cryptohelper.NewCryptoHelper(
-		client, s.PickleKey, dbPath,
+		client, s.PickleKey, db,
 	)
 	if err != nil {
+		_ = db.Close()
 		cancel()
 		return nil, err
 	}
@@ -209,23 +245,60 @@ func (m *Manager) NewMatrixSession(ctx context.Context, client *mautrix.Client,
 		ssssMachine:           ssss.NewSSSSMachine(client),
 		listeners:             xsync.NewMap[uint64, chan *event.Event](),
 		messageTrees:          xsync.NewMap[string, *MessageTree](),
+		encryptedMedia:        xsync.NewMap[string, *EncryptedMedia](),
+		readStates:            xsync.NewMap[string, ReadState](),
+		unreadListeners:       xsync.NewMap[chan UnreadEvent, struct{}](),
+		notificationListeners: xsync.NewMap[chan NotificationEvent, struct{}](),
+		inviteListeners:       xsync.NewMap[chan InviteEvent, struct{}](),
 		profileCache:          cache.NewDefault[models.User](),
 		verifiedCache:         cache.New[bool](time.Minute * 30),
 		userCache:             cache.NewDefault[models.User](),
 		aliasesCache:          cache.NewDefault[[]string](),
 		roomCache:             cache.NewDefault[string](),
-		channelsCache:         cache.NewDefault[[]models.Channel](),
+		channelsCache:         cache.NewDefault[[]models.Category](),
 		spacesCache:           cache.NewDefault[[]models.Space](),
 		dmCache:               cache.NewDefault[[]models.User](),
+		directCache:           cache.NewDefault[map[id.UserID][]id.RoomID](),
 		membersCache:          cache.NewDefault[[]models.User](),
+		mediaCache:            cache.New[int64](time.Hour),
+		stickersCache:         cache.New[[]models.StickerPack](time.Minute),
+		pushRulesCache:        cache.New[*pushrules.PushRuleset](time.Hour),
 		crossSigningEvent:     make(chan struct{}, 2),
 		typingTracker:         NewTypingTracker(s.UserID),
 	}
 
+	mSess.searchIndex = loadSearchIndex(searchPath, s.SearchKey, logger)
+	mSess.searchPath = searchPath
+	mSess.searchKey = s.SearchKey
+	go mSess.persistSearchIndex(ctx)
+
+	mSess.outbox, err = newOutbox(ctx, mSess, db, s.PickleKey)
+	if err != nil {
+		logger.Warn("outbox unavailable, messages won't survive a restart", "err", err)
+		mSess.outbox, _ = newOutbox(ctx, mSess, nil, nil)
+	}
+	go mSess.outbox.run(ctx)
+
+	mSess.invites, err = newInviteStore(ctx, db, s.PickleKey, logger)
+	if err != nil {
+		logger.Warn("invite store unavailable, invites won't survive a restart", "err", err)
+		mSess.invites, _ = newInviteStore(ctx, nil, nil, logger)
+	}
+	go mSess.loadIgnoredUsers(ctx)
+
+	if m.timelineCacheLimit >= 0 {
+		mSess.timelineCache, err = newTimelineCache(ctx, db, s.PickleKey, m.timelineCacheLimit, logger)
+		if err != nil {
+			logger.Warn("timeline cache unavailable", "err", err)
+		}
+	}
+
 	mSess.keyBackupMgr = NewKeyBackupManager(mSess)
 
 	err = mSess.keyBackupMgr.Init(ctx, s.UserID)
 	if err != nil {
+		// stops sync and the session's goroutines and closes the database
+		mSess.Close()
 		return nil, err
 	}
 
@@ -251,6 +324,7 @@ func (m *MatrixSession) initSyncHandlers() {
 				ch <- evt
 				return true
 			})
+			m.queueNotification(evt)
 		},
 	)
 
@@ -276,6 +350,17 @@ func (m *MatrixSession) initSyncHandlers() {
 
 	syncer.OnEventType(
 		event.EventSticker,
+		func(ctx context.Context, evt *event.Event) {
+			m.listeners.Range(func(id uint64, ch chan *event.Event) bool {
+				ch <- evt
+				return true
+			})
+			m.queueNotification(evt)
+		},
+	)
+
+	syncer.OnEventType(
+		event.StatePowerLevels,
 		func(ctx context.Context, evt *event.Event) {
 			m.listeners.Range(func(id uint64, ch chan *event.Event) bool {
 				ch <- evt
@@ -296,6 +381,7 @@ func (m *MatrixSession) initSyncHandlers() {
 				ch <- decrypted
 				return true
 			})
+			m.queueNotification(decrypted)
 		},
 	)
 
@@ -303,14 +389,39 @@ func (m *MatrixSession) initSyncHandlers() {
 		m.membersCache.Invalidate("grm:" + string(evt.RoomID))
 		m.profileCache.Invalidate("gup:" + evt.GetStateKey())
 		m.dmCache.Invalidate("ldm:" + m.id)
+		if evt.GetStateKey() == m.id {
+			m.channelsCache.Clear()
+		}
 	})
 
 	syncer.OnEventType(event.StateSpaceChild, func(ctx context.Context, evt *event.Event) {
-		m.channelsCache.Invalidate("gsc:" + evt.RoomID.String())
+		// the space may be nested in others, whose hierarchy changes too
+		m.channelsCache.Clear()
 	})
 
 	syncer.OnEventType(event.AccountDataDirectChats, func(ctx context.Context, evt *event.Event) {
 		m.dmCache.Invalidate("ldm:" + m.id)
+		m.directCache.Invalidate("dr:" + m.id)
+	})
+
+	syncer.OnEventType(event.AccountDataIgnoredUserList, func(ctx context.Context, evt *event.Event) {
+		m.handleIgnoredUsers(evt)
+	})
+
+	syncer.OnEventType(event.EphemeralEventReceipt, func(ctx context.Context, evt *event.Event) {
+		m.handleReceipt(evt)
+	})
+
+	syncer.OnEventType(event.AccountDataFullyRead, func(ctx context.Context, evt *event.Event) {
+		m.handleFullyRead(evt)
+	})
+
+	syncer.OnSync(m.handleUnreadCounts)
+	syncer.OnSync(m.trackCatchUp)
+	syncer.OnSync(m.handleInvites)
+
+	syncer.OnEventType(event.AccountDataPushRules, func(ctx context.Context, evt *event.Event) {
+		m.pushRulesCache.Invalidate("pr:" + m.id)
 	})
 
 	syncer.OnEventType(event.EphemeralEventPresence, func(ctx context.Context, evt *event.Event) {
@@ -413,15 +524,15 @@ func (m *MatrixSession) GetMessageTree(roomID string) *MessageTree {
 		return tree
 	}
 
-	var encEvt event.EncryptionEventContent
-	err := m.GetClient().StateEvent(
-		m.Context(), id.RoomID(roomID), event.StateEncryption, "", &encEvt,
-	)
-
 	tree := newMessageTree(m, roomID)
-	tree.isEncrypted = err == nil && encEvt.Algorithm != ""
+	tree.lookupEncryption(m.Context())
 
-	m.messageTrees.Store(roomID, tree)
+	if existing, loaded := m.messageTrees.LoadOrStore(roomID, tree); loaded {
+		return existing
+	}
+	if m.outbox != nil {
+		m.outbox.restore(tree)
+	}
 
 	return tree
 }
@@ -569,6 +680,12 @@ func (m *MatrixSession) Close() {
 		close(m.crossSigningEvent)
 		m.crossSigningEvent = nil
 	}
+	if m.outbox != nil {
+		<-m.outbox.done
+	}
+	if m.timelineCache != nil {
+		m.timelineCache.close()
+	}
 	if m.cryptoHelper != nil {
 		m.cryptoHelper.Close()
 	}
@@ -579,6 +696,7 @@ func (m *MatrixSession) Close() {
 		value.Close()
 		return true, false
 	})
+	m.saveSearchIndex()
 	m.listeners.DeleteMatching(func(_ uint64, value chan *event.Event) (delete bool, stop bool) {
 		close(value)
 		return true, false
@@ -587,6 +705,24 @@ func (m *MatrixSession) Close() {
 		close(value)
 		return true, false
 	})
+	m.inviteListeners.DeleteMatching(func(ch chan InviteEvent, _ struct{}) (delete bool, stop bool) {
+		close(ch)
+		return true, false
+	})
+	m.notificationListeners.DeleteMatching(func(ch chan NotificationEvent, _ struct{}) (delete bool, stop bool) {
+		close(ch)
+		return true, false
+	})
+	m.unreadListeners.DeleteMatching(func(ch chan UnreadEvent, _ struct{}) (delete bool, stop bool) {
+		close(ch)
+		return true, false
+	})
+}
+
+func (m *Manager) storePaths(userID string) (dbPath string, searchPath string) {
+	name := url.PathEscape(userID)
+	return fmt.Sprintf("%s/%s.db", m.cryptoDBPath, name),
+		fmt.Sprintf("%s/%s.search", m.cryptoDBPath, name)
 }
 
 func generatePickleKey() ([]byte, error) {
@@ -0,0 +1,279 @@
+package matrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// MSC2545 image packs
+const (
+	userImagePackType = "im.ponies.user_emotes"
+	imagePackRooms    = "im.ponies.emote_rooms"
+	widgetsType       = "m.widgets"
+	stickerWidgetType = "m.stickerpicker"
+)
+
+var roomImagePackType = event.Type{Type: "im.ponies.room_emotes", Class: event.StateEventType}
+
+type packImage struct {
+	URL   id.ContentURIString `json:"url"`
+	Body  string              `json:"body,omitempty"`
+	Info  *event.FileInfo     `json:"info,omitempty"`
+	Usage []string            `json:"usage,omitempty"`
+}
+
+type imagePack struct {
+	Images map[string]packImage `json:"images"`
+	Pack   struct {
+		DisplayName string              `json:"display_name,omitempty"`
+		AvatarURL   id.ContentURIString `json:"avatar_url,omitempty"`
+		Usage       []string            `json:"usage,omitempty"`
+	} `json:"pack"`
+}
+
+type imagePackRoomList struct {
+	Rooms map[id.RoomID]map[string]struct{} `json:"rooms"`
+}
+
+type widgetAccountData struct {
+	Content struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+		Name string `json:"name"`
+	} `json:"content"`
+}
+
+func isSticker(pack imagePack, img packImage) bool {
+	usage := img.Usage
+	if len(usage) == 0 {
+		usage = pack.Pack.Usage
+	}
+	return len(usage) == 0 || slices.Contains(usage, "sticker")
+}
+
+func (p imagePack) stickers(packID string) models.StickerPack {
+	sp := models.StickerPack{
+		ID:   packID,
+		Name: p.Pack.DisplayName,
+	}
+	if p.Pack.AvatarURL != "" {
+		sp.Avatar = mediaURL(p.Pack.AvatarURL)
+	}
+
+	shortcodes := make([]string, 0, len(p.Images))
+	for shortcode := range p.Images {
+		shortcodes = append(shortcodes, shortcode)
+	}
+	sort.Strings(shortcodes)
+
+	for _, shortcode := range shortcodes {
+		img := p.Images[shortcode]
+		if !isSticker(p, img) || img.URL == "" {
+			continue
+		}
+
+		s := models.Sticker{
+			ID:   shortcode,
+			Body: img.Body,
+			URL:  mediaURL(img.URL),
+		}
+		if s.Body == "" {
+			s.Body = shortcode
+		}
+		if img.Info != nil {
+			s.MimeType = img.Info.MimeType
+			s.Width = img.Info.Width
+			s.Height = img.Info.Height
+		}
+		sp.Stickers = append(sp.Stickers, s)
+	}
+
+	if sp.Avatar == "" && len(sp.Stickers) > 0 {
+		sp.Avatar = sp.Stickers[0].URL
+	}
+	return sp
+}
+
+func (m *MatrixSession) imagePacks() (map[string]imagePack, error) {
+	ctx := m.Context()
+	client := m.GetClient()
+	packs := make(map[string]imagePack)
+
+	var personal imagePack
+	if err := client.GetAccountData(ctx, userImagePackType, &personal); err == nil && len(personal.Images) > 0 {
+		if personal.Pack.DisplayName == "" {
+			personal.Pack.DisplayName = "Personal"
+		}
+		packs["user"] = personal
+	}
+
+	var rooms imagePackRoomList
+	if err := client.GetAccountData(ctx, imagePackRooms, &rooms); err != nil {
+		return packs, nil
+	}
+
+	for roomID, stateKeys := range rooms.Rooms {
+		for stateKey := range stateKeys {
+			var pack imagePack
+			err := client.StateEvent(ctx, roomID, roomImagePackType, stateKey, &pack)
+			if err != nil {
+				m.logger.Debug("failed to fetch image pack", "roomID", roomID, "stateKey", stateKey, "err", err)
+				continue
+			}
+			packs[roomID.String()+"|"+stateKey] = pack
+		}
+	}
+
+	return packs, nil
+}
+
+func (m *MatrixSession) StickerPacks() ([]models.StickerPack, error) {
+	return m.stickersCache.Get("packs", func() ([]models.StickerPack, error) {
+		packs, err := m.imagePacks()
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]models.StickerPack, 0, len(packs))
+		for packID, pack := range packs {
+			sp := pack.stickers(packID)
+			if len(sp.Stickers) == 0 {
+				continue
+			}
+			result = append(result, sp)
+		}
+
+		sort.Slice(result, func(i, j int) bool {
+			// the personal pack always comes first
+			if result[i].ID == "user" || result[j].ID == "user" {
+				return result[i].ID == "user"
+			}
+			return result[i].Name < result[j].Name
+		})
+		return result, nil
+	})
+}
+
+func (m *MatrixSession) StickerWidget(roomID string) *models.StickerWidget {
+	var widgets map[string]widgetAccountData
+	if err := m.GetClient().GetAccountData(m.Context(), widgetsType, &widgets); err != nil {
+		return nil
+	}
+
+	for widgetID, w := range widgets {
+		if w.Content.Type != stickerWidgetType || w.Content.URL == "" {
+			continue
+		}
+
+		name := w.Content.Name
+		if name == "" {
+			name = "Stickers"
+		}
+
+		return &models.StickerWidget{
+			ID:   widgetID,
+			Name: name,
+			URL:  widgetURL(w.Content.URL, widgetID, m.id, roomID),
+		}
+	}
+	return nil
+}
+
+func widgetURL(raw, widgetID, userID, roomID string) string {
+	replacer := strings.NewReplacer(
+		"$matrix_user_id", url.QueryEscape(userID),
+		"$matrix_room_id", url.QueryEscape(roomID),
+		"$matrix_widget_id", url.QueryEscape(widgetID),
+		"$matrix_display_name", url.QueryEscape(userID),
+		"$matrix_avatar_url", "",
+	)
+	expanded := replacer.Replace(raw)
+
+	u, err := url.Parse(expanded)
+	if err != nil {
+		return expanded
+	}
+	q := u.Query()
+	q.Set("widgetId", widgetID)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (m *MatrixSession) findSticker(packID, stickerID string) (packImage, error) {
+	packs, err := m.imagePacks()
+	if err != nil {
+		return packImage{}, err
+	}
+
+	pack, ok := packs[packID]
+	if !ok {
+		return packImage{}, fmt.Errorf("sticker pack %s not found", packID)
+	}
+	img, ok := pack.Images[stickerID]
+	if !ok || !isSticker(pack, img) {
+		return packImage{}, fmt.Errorf("sticker %s not found", stickerID)
+	}
+	if img.Body == "" {
+		img.Body = stickerID
+	}
+	return img, nil
+}
+
+func (t *MessageTree) SendPackSticker(packID, stickerID string) error {
+	img, err := t.matrixSession.findSticker(packID, stickerID)
+	if err != nil {
+		return err
+	}
+
+	return t.SendSticker(&event.MessageEventContent{
+		Body: img.Body,
+		URL:  img.URL,
+		Info: img.Info,
+	})
+}
+
+// SendWidgetSticker sends the content a sticker picker widget handed us
+// through the widget API.
+func (t *MessageTree) SendWidgetSticker(raw []byte) error {
+	var content event.MessageEventContent
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return fmt.Errorf("invalid sticker content: %w", err)
+	}
+
+	return t.SendSticker(&event.MessageEventContent{
+		Body: content.Body,
+		URL:  content.URL,
+		Info: content.Info,
+	})
+}
+
+func (t *MessageTree) SendSticker(content *event.MessageEventContent) error {
+	if content.URL == "" && content.File == nil {
+		return fmt.Errorf("sticker has no media")
+	}
+	if content.Info == nil {
+		content.Info = &event.FileInfo{}
+	}
+	content.MsgType = ""
+
+	nonce, err := generateNonce()
+	if err != nil {
+		return err
+	}
+
+	placeholder := t.defaultMessage("", nonce)
+	placeholder.Attachments = []models.Attachment{
+		t.attachmentFromContent(models.AttachmentSticker, content),
+	}
+	t.Set(placeholder)
+
+	return t.queueEvent(event.EventSticker, content, placeholder)
+}
@@ -0,0 +1,176 @@
+package matrix
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.mau.fi/util/dbutil"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/sqlstatestore"
+)
+
+// SQLSyncStore keeps the sync token and filter ID in the session database so
+// a restart resumes incremental sync instead of doing a full initial sync.
+// Rows are tied to the device they were written by; a token from another
+// login is never handed back.
+type SQLSyncStore struct {
+	db       *dbutil.Database
+	deviceID id.DeviceID
+	// filterKey is compared against the key stored with the filter ID, so
+	// a changed filter definition gets uploaded again
+	filterKey string
+}
+
+var _ mautrix.SyncStore = (*SQLSyncStore)(nil)
+
+func NewSQLSyncStore(db *dbutil.Database, deviceID id.DeviceID, filterKey string) *SQLSyncStore {
+	return &SQLSyncStore{db: db, deviceID: deviceID, filterKey: filterKey}
+}
+
+func (s *SQLSyncStore) Init(ctx context.Context) error {
+	_, err := s.db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS arko_sync (
+			user_id    TEXT PRIMARY KEY,
+			device_id  TEXT NOT NULL DEFAULT '',
+			next_batch TEXT NOT NULL DEFAULT '',
+			filter_id  TEXT NOT NULL DEFAULT '',
+			filter_key TEXT NOT NULL DEFAULT ''
+		)`)
+	if err != nil {
+		return fmt.Errorf("create sync table: %w", err)
+	}
+	if s.deviceID != "" {
+		_, err = s.db.Exec(ctx, `DELETE FROM arko_sync WHERE device_id<>$1`, s.deviceID)
+	}
+	return err
+}
+
+func (s *SQLSyncStore) SaveFilterID(ctx context.Context, userID id.UserID, filterID string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO arko_sync (user_id, device_id, filter_id, filter_key) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET
+			device_id=excluded.device_id, filter_id=excluded.filter_id, filter_key=excluded.filter_key`,
+		userID, s.deviceID, filterID, s.filterKey,
+	)
+	return err
+}
+
+func (s *SQLSyncStore) LoadFilterID(ctx context.Context, userID id.UserID) (string, error) {
+	var filterID, key string
+	err := s.db.QueryRow(ctx,
+		`SELECT filter_id, filter_key FROM arko_sync WHERE user_id=$1 AND device_id=$2`,
+		userID, s.deviceID,
+	).Scan(&filterID, &key)
+	if errors.Is(err, sql.ErrNoRows) || key != s.filterKey {
+		return "", nil
+	}
+	return filterID, err
+}
+
+func (s *SQLSyncStore) SaveNextBatch(ctx context.Context, userID id.UserID, nextBatchToken string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO arko_sync (user_id, device_id, next_batch) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET device_id=excluded.device_id, next_batch=excluded.next_batch`,
+		userID, s.deviceID, nextBatchToken,
+	)
+	return err
+}
+
+func (s *SQLSyncStore) LoadNextBatch(ctx context.Context, userID id.UserID) (string, error) {
+	var nextBatch string
+	err := s.db.QueryRow(ctx,
+		`SELECT next_batch FROM arko_sync WHERE user_id=$1 AND device_id=$2`,
+		userID, s.deviceID,
+	).Scan(&nextBatch)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return nextBatch, err
+}
+
+// openClientStores opens the session database and points the client's sync
+// and state stores at it. The crypto store shares the same database.
+func openClientStores(ctx context.Context, client *mautrix.Client, dbPath string) (*dbutil.Database, error) {
+	db, err := dbutil.NewWithDialect(fmt.Sprintf("file:%s?_txlock=immediate", dbPath), "sqlite3-fk-wal")
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+
+	stateStore := sqlstatestore.NewSQLStateStore(
+		db, dbutil.ZeroLogger(client.Log.With().Str("db_section", "matrix_state").Logger()), false,
+	)
+	if err := stateStore.Upgrade(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("upgrade state store: %w", err)
+	}
+
+	filter := syncFilter()
+	syncStore := NewSQLSyncStore(db, client.DeviceID, filterKey(filter))
+	if err := syncStore.Init(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	client.StateStore = stateStore
+	client.Store = syncStore
+	if syncer, ok := client.Syncer.(*mautrix.DefaultSyncer); ok {
+		syncer.FilterJSON = filter
+		syncer.OnEvent(client.StateStoreSyncHandler)
+	}
+	return db, nil
+}
+
+// storeAEAD derives a key for data sealed in the session database from the
+// pickle key, so it's unreadable once the session that wrote it is gone.
+// label keeps the keys of different tables apart.
+func storeAEAD(pickleKey []byte, label string) (cipher.AEAD, error) {
+	key := sha256.Sum256(append([]byte(label+"\x00"), pickleKey...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealRow encrypts v for a row of the session database. ad names the row,
+// so ciphertext can't be moved to another one.
+func sealRow(aead cipher.AEAD, ad string, v any) ([]byte, error) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, []byte(ad)), nil
+}
+
+func openRow(aead cipher.AEAD, ad string, data []byte, v any) error {
+	if len(data) < aead.NonceSize() {
+		return errors.New("sealed row too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(ad))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, v)
+}
+
+// removeStoreFiles deletes a session database along with its WAL files.
+func removeStoreFiles(dbPath string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		_ = os.Remove(dbPath + suffix)
+	}
+}
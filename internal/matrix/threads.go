@@ -0,0 +1,593 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/tidwall/btree"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+const maxThreadParticipants = 3
+
+type Thread struct {
+	mu sync.RWMutex
+
+	rootID      string
+	rootEventID id.EventID
+
+	replies *btree.BTreeG[models.Message]
+	byID    map[string]models.Message
+
+	count         int
+	participants  []models.User
+	latest        time.Time
+	latestEventID id.EventID
+
+	nextBatch string
+	loaded    bool
+	noMore    bool
+	// summarized is set once the server's summary was applied
+	summarized bool
+
+	paginating sync.Mutex
+}
+
+// threadSummary is the bundled m.thread aggregation. mautrix only keeps the
+// count of unknown relation types, so the rest is decoded from the raw
+// events of a page, see decodeChunk.
+type threadSummary struct {
+	Count                   int          `json:"count"`
+	LatestEvent             *event.Event `json:"latest_event"`
+	CurrentUserParticipated bool         `json:"current_user_participated"`
+}
+
+type threadSummaryEvent struct {
+	Unsigned struct {
+		Relations struct {
+			Thread *threadSummary `json:"m.thread"`
+		} `json:"m.relations"`
+	} `json:"unsigned"`
+}
+
+// threadSummaries holds the thread summaries of a page by root event ID.
+type threadSummaries map[id.EventID]*threadSummary
+
+// decodeChunk decodes and parses the raw events of a page along with their
+// bundled thread summaries.
+func decodeChunk(raw []json.RawMessage) ([]*event.Event, threadSummaries, error) {
+	chunk := make([]*event.Event, 0, len(raw))
+	summaries := make(threadSummaries)
+	for _, data := range raw {
+		var evt event.Event
+		if err := json.Unmarshal(data, &evt); err != nil {
+			return nil, nil, err
+		}
+		_ = evt.Content.ParseRaw(evt.Type)
+		chunk = append(chunk, &evt)
+
+		var bundled threadSummaryEvent
+		if err := json.Unmarshal(data, &bundled); err == nil && bundled.Unsigned.Relations.Thread != nil {
+			summaries[evt.ID] = bundled.Unsigned.Relations.Thread
+		}
+	}
+	return chunk, summaries, nil
+}
+
+func newThread(rootID string, rootEventID id.EventID) *Thread {
+	return &Thread{
+		rootID:      rootID,
+		rootEventID: rootEventID,
+		replies: btree.NewBTreeGOptions(byTimestamp, btree.Options{
+			NoLocks: true,
+		}),
+		byID: make(map[string]models.Message),
+	}
+}
+
+func (th *Thread) ID() string {
+	return th.rootID
+}
+
+func (th *Thread) HasMore() bool {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	return !th.loaded || !th.noMore
+}
+
+func (th *Thread) Count() int {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	return th.count
+}
+
+func (th *Thread) Replies() []models.Message {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+
+	items := make([]models.Message, 0, th.replies.Len())
+	th.replies.Scan(func(item models.Message) bool {
+		items = append(items, item)
+		return true
+	})
+	return items
+}
+
+func (th *Thread) add(m models.Message, live bool) (models.Message, string, bool) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	replacedNonce := ""
+	if m.Nonce != "" {
+		if pending, ok := th.byID[m.Nonce]; ok {
+			th.replies.Delete(pending)
+			delete(th.byID, pending.ID)
+			replacedNonce = pending.ID
+		}
+		m.Nonce = ""
+	}
+
+	existing, seen := th.byID[m.ID]
+	if seen {
+		th.replies.Delete(existing)
+	}
+	th.replies.Set(m)
+	th.byID[m.ID] = m
+
+	// a confirmed own reply replaces its placeholder and is counted here,
+	// only replies that were already counted are skipped
+	if seen || m.IsPending() {
+		return m, replacedNonce, false
+	}
+
+	if live {
+		th.count++
+	} else if th.count < len(th.byID) {
+		th.count = len(th.byID)
+	}
+
+	if !m.Timestamp.Before(th.latest) {
+		th.latest = m.Timestamp
+		th.latestEventID = id.EventID(m.EventID)
+	}
+	th.addParticipant(m.Author)
+
+	return m, replacedNonce, true
+}
+
+func (th *Thread) addParticipant(user models.User) {
+	for i, p := range th.participants {
+		if p.ID == user.ID {
+			th.participants = append(th.participants[:i], th.participants[i+1:]...)
+			break
+		}
+	}
+	th.participants = append([]models.User{user}, th.participants...)
+	if len(th.participants) > maxThreadParticipants {
+		th.participants = th.participants[:maxThreadParticipants]
+	}
+}
+
+func (th *Thread) update(messageID string, fn func(*models.Message)) (models.Message, bool) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	msg, ok := th.byID[messageID]
+	if !ok {
+		return models.Message{}, false
+	}
+
+	th.replies.Delete(msg)
+	fn(&msg)
+	th.replies.Set(msg)
+	th.byID[msg.ID] = msg
+	return msg, true
+}
+
+func (th *Thread) remove(messageID string) (models.Message, bool) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	msg, ok := th.byID[messageID]
+	if !ok {
+		return models.Message{}, false
+	}
+	th.replies.Delete(msg)
+	delete(th.byID, messageID)
+	return msg, true
+}
+
+func (th *Thread) get(messageID string) (models.Message, bool) {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	msg, ok := th.byID[messageID]
+	return msg, ok
+}
+
+func (th *Thread) setSummary(count int, latest *models.User, latestAt time.Time, latestEventID id.EventID) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	if count > th.count {
+		th.count = count
+	}
+	if latest != nil && latestAt.After(th.latest) {
+		th.latest = latestAt
+		th.latestEventID = latestEventID
+		th.addParticipant(*latest)
+	}
+}
+
+// restoreSummary applies the thread summary of a message read from the
+// timeline cache, unless the thread was already seen on the server.
+func (th *Thread) restoreSummary(m models.Message) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	if th.count > 0 || th.summarized {
+		return
+	}
+	th.count = m.ThreadCount
+	th.participants = slices.Clone(m.ThreadParticipants)
+	th.latest = m.LastThreadReply
+}
+
+func (th *Thread) setParticipated(user models.User) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	for _, p := range th.participants {
+		if p.ID == user.ID {
+			return
+		}
+	}
+	if len(th.participants) < maxThreadParticipants {
+		th.participants = append(th.participants, user)
+	}
+}
+
+func (th *Thread) applySummary(m *models.Message) {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+
+	if th.count == 0 {
+		return
+	}
+	m.ThreadCount = th.count
+	m.ThreadParticipants = append([]models.User(nil), th.participants...)
+	m.LastThreadReply = th.latest
+}
+
+func (th *Thread) lastEventID() id.EventID {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	if th.latestEventID != "" {
+		return th.latestEventID
+	}
+	return th.rootEventID
+}
+
+func threadParent(evt *event.Event) (id.EventID, bool) {
+	content, ok := evt.Content.Parsed.(*event.MessageEventContent)
+	if !ok || content.RelatesTo == nil {
+		return "", false
+	}
+	if content.RelatesTo.Type != event.RelThread || content.RelatesTo.EventID == "" {
+		return "", false
+	}
+	return content.RelatesTo.EventID, true
+}
+
+func (t *MessageTree) thread(rootID string, rootEventID id.EventID) *Thread {
+	th, _ := t.threads.LoadOrCompute(rootID, func() (*Thread, bool) {
+		return newThread(rootID, rootEventID), false
+	})
+	return th
+}
+
+// applyBundledThread sets up the thread of a root from a page. Roots whose
+// summary wasn't bundled only get a count, the rest is fetched when the
+// thread is opened.
+func (t *MessageTree) applyBundledThread(evt *event.Event, summary *threadSummary) {
+	if summary != nil {
+		if summary.Count > 0 {
+			t.applyThreadSummary(t.thread(safeHashClass(evt.ID.String()), evt.ID), *summary)
+		}
+		return
+	}
+
+	if evt.Unsigned.Relations == nil {
+		return
+	}
+	chunk, ok := evt.Unsigned.Relations.Raw[event.RelThread]
+	if !ok || chunk.Count == 0 {
+		return
+	}
+	th := t.thread(safeHashClass(evt.ID.String()), evt.ID)
+	th.setSummary(chunk.Count, nil, time.Time{}, "")
+}
+
+func (t *MessageTree) applyThreadSummary(th *Thread, summary threadSummary) {
+	th.setSummary(summary.Count, nil, time.Time{}, "")
+	if latest := summary.LatestEvent; latest != nil {
+		profile, _ := t.matrixSession.GetUserProfile(latest.Sender.String())
+		th.setSummary(summary.Count, &profile, time.UnixMilli(latest.Timestamp), latest.ID)
+	}
+	if summary.CurrentUserParticipated {
+		self, _ := t.matrixSession.GetUserProfile(t.matrixSession.id)
+		th.setParticipated(self)
+	}
+
+	th.mu.Lock()
+	th.summarized = true
+	th.mu.Unlock()
+}
+
+func (t *MessageTree) fetchThreadSummary(ctx context.Context, eventID id.EventID) (threadSummary, error) {
+	url := t.matrixSession.client.BuildClientURL("v3", "rooms", t.roomID, "event", eventID)
+
+	var resp threadSummaryEvent
+	if _, err := t.matrixSession.client.MakeRequest(ctx, "GET", url, nil, &resp); err != nil {
+		return threadSummary{}, err
+	}
+	if resp.Unsigned.Relations.Thread == nil {
+		return threadSummary{}, fmt.Errorf("event %s has no thread summary", eventID)
+	}
+	return *resp.Unsigned.Relations.Thread, nil
+}
+
+func (t *MessageTree) handleThreadReply(evt *event.Event, rootEventID id.EventID, live bool) {
+	msg := t.eventToMessage(evt)
+	if msg == nil {
+		return
+	}
+	t.addThreadReply(rootEventID, *msg, live)
+}
+
+func (t *MessageTree) addThreadReply(rootEventID id.EventID, msg models.Message, live bool) bool {
+	rootID := safeHashClass(rootEventID.String())
+	th := t.thread(rootID, rootEventID)
+
+	msg.RoomID = t.roomID
+	msg.ThreadRootID = rootID
+	t.decorate(&msg)
+	t.threadReplies.Store(msg.ID, rootID)
+
+	countBefore := th.Count()
+	added, replacedNonce, isNew := th.add(msg, live)
+	if replacedNonce != "" {
+		t.threadReplies.Delete(replacedNonce)
+	}
+
+	if th.Count() != countBefore {
+		t.refreshMessage(rootID)
+	}
+
+	// paginated replies are rendered by the thread panel itself
+	if !t.listening.Load() || (isNew && !live) {
+		return isNew
+	}
+
+	evtType := UpdateEvent
+	if replacedNonce == "" && (isNew || added.IsPending()) {
+		evtType = AddEvent
+	}
+
+	t.sendEventToListeners(MessageTreeEvent{
+		EventType:   evtType,
+		UpdateNonce: replacedNonce,
+		Message:     added,
+		ThreadID:    rootID,
+	})
+
+	return isNew
+}
+
+func (t *MessageTree) updateThreadReply(messageID string, fn func(*models.Message)) bool {
+	rootID, ok := t.threadReplies.Load(messageID)
+	if !ok {
+		return false
+	}
+
+	th, ok := t.threads.Load(rootID)
+	if !ok {
+		return false
+	}
+
+	msg, ok := th.update(messageID, fn)
+	if !ok {
+		return false
+	}
+
+	if t.listening.Load() {
+		t.sendEventToListeners(MessageTreeEvent{
+			EventType: UpdateEvent,
+			Message:   msg,
+			ThreadID:  rootID,
+		})
+	}
+	return true
+}
+
+func (t *MessageTree) GetThread(ctx context.Context, rootID string) (*Thread, models.Message, error) {
+	root, ok := t.messagesMap.Load(rootID)
+	if !ok || root.EventID == "" {
+		return nil, models.Message{}, fmt.Errorf("thread root %s not found", rootID)
+	}
+
+	th := t.thread(rootID, id.EventID(root.EventID))
+
+	th.mu.RLock()
+	loaded, summarized := th.loaded, th.summarized
+	th.mu.RUnlock()
+
+	if !loaded {
+		if _, err := t.LoadThreadReplies(ctx, th, 30); err != nil {
+			return nil, models.Message{}, err
+		}
+	}
+	if !summarized {
+		summary, err := t.fetchThreadSummary(ctx, th.rootEventID)
+		if err != nil {
+			t.matrixSession.logger.Debug("failed to fetch thread summary", "eventID", th.rootEventID, "error", err)
+		} else {
+			t.applyThreadSummary(th, summary)
+			t.refreshMessage(rootID)
+		}
+	}
+
+	// the root may have been dropped or redacted while the replies loaded
+	current, ok := t.messagesMap.Load(rootID)
+	if !ok {
+		return nil, models.Message{}, fmt.Errorf("thread root %s not found", rootID)
+	}
+	return th, *current, nil
+}
+
+func (t *MessageTree) LoadThreadReplies(ctx context.Context, th *Thread, limit int) ([]models.Message, error) {
+	th.paginating.Lock()
+	defer th.paginating.Unlock()
+
+	th.mu.RLock()
+	token, noMore, loaded := th.nextBatch, th.noMore, th.loaded
+	th.mu.RUnlock()
+
+	if loaded && noMore {
+		return nil, nil
+	}
+
+	rid := id.RoomID(t.roomID)
+	resp, err := t.matrixSession.GetClient().GetRelations(ctx, rid, th.rootEventID, &mautrix.ReqGetRelations{
+		RelationType: event.RelThread,
+		Dir:          mautrix.DirectionBackward,
+		From:         token,
+		Limit:        limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get thread relations: %w", err)
+	}
+
+	th.mu.Lock()
+	th.loaded = true
+	th.nextBatch = resp.NextBatch
+	th.noMore = resp.NextBatch == ""
+	th.mu.Unlock()
+
+	requestedSessions := xsync.NewMap[id.SessionID, struct{}]()
+
+	var (
+		mu    sync.Mutex
+		added []models.Message
+		wg    sync.WaitGroup
+	)
+	for _, evt := range resp.Chunk {
+		wg.Go(func() {
+			if evt.Type == event.EventEncrypted {
+				dec, err := t.handleEncrypted(ctx, requestedSessions, evt)
+				if err != nil {
+					msg := t.undecryptableMessage(evt)
+					if t.addThreadReply(th.rootEventID, msg, false) {
+						mu.Lock()
+						added = append(added, msg)
+						mu.Unlock()
+					}
+					return
+				}
+				evt = dec
+			}
+
+			_ = evt.Content.ParseRaw(evt.Type)
+			if evt.Type != event.EventMessage && evt.Type != event.EventSticker {
+				return
+			}
+
+			var msg *models.Message
+			if evt.Unsigned.RedactedBecause != nil {
+				redacted := t.redactedMessage(evt)
+				msg = &redacted
+			} else {
+				msg = t.eventToMessage(evt)
+			}
+			if msg == nil {
+				return
+			}
+
+			if t.addThreadReply(th.rootEventID, *msg, false) {
+				if current, ok := th.get(msg.ID); ok {
+					mu.Lock()
+					added = append(added, current)
+					mu.Unlock()
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	slices.SortFunc(added, func(a, b models.Message) int {
+		if byTimestamp(a, b) {
+			return -1
+		}
+		if byTimestamp(b, a) {
+			return 1
+		}
+		return 0
+	})
+
+	return added, nil
+}
+
+func (t *MessageTree) SendThreadMessage(rootID, body string) error {
+	th, ok := t.threads.Load(rootID)
+	if !ok {
+		root, ok := t.messagesMap.Load(rootID)
+		if !ok || root.EventID == "" {
+			return fmt.Errorf("thread root %s not found", rootID)
+		}
+		th = t.thread(rootID, id.EventID(root.EventID))
+	}
+
+	nonce, err := generateNonce()
+	if err != nil {
+		return err
+	}
+
+	content := t.textContent(body)
+
+	placeholder := t.defaultMessage(content.Body, nonce)
+	placeholder.FormattedContent = formattedBody(content)
+	t.addThreadReply(th.rootEventID, placeholder, true)
+
+	content.RelatesTo = (&event.RelatesTo{}).SetThread(th.rootEventID, th.lastEventID())
+
+	return t.queueThreadReply(th.rootEventID, content, placeholder)
+}
+
+// dropThreadReply removes a thread reply that was never sent.
+func (t *MessageTree) dropThreadReply(messageID string) {
+	rootID, ok := t.threadReplies.LoadAndDelete(messageID)
+	if !ok {
+		return
+	}
+	th, ok := t.threads.Load(rootID)
+	if !ok {
+		return
+	}
+	msg, ok := th.remove(messageID)
+	if !ok {
+		return
+	}
+
+	t.sendEventToListeners(MessageTreeEvent{
+		EventType: RemoveEvent,
+		Message:   msg,
+		ThreadID:  rootID,
+	})
+}
@@ -0,0 +1,164 @@
+package matrix
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+)
+
+func TestThreadAdd_Counting(t *testing.T) {
+	alice := models.User{ID: "@alice:example.com"}
+	self := models.User{ID: "@test:example.com"}
+	base := time.UnixMilli(1700000000000)
+
+	reply := func(id string, author models.User, offset time.Duration) models.Message {
+		return models.Message{
+			ID:        id,
+			EventID:   "$" + id,
+			Author:    author,
+			Timestamp: base.Add(offset),
+		}
+	}
+
+	tests := []struct {
+		name             string
+		steps            func(th *Thread)
+		wantCount        int
+		wantReplies      int
+		wantParticipants []string
+	}{
+		{
+			name: "live reply",
+			steps: func(th *Thread) {
+				th.add(reply("a", alice, time.Second), true)
+			},
+			wantCount:        1,
+			wantReplies:      1,
+			wantParticipants: []string{alice.ID},
+		},
+		{
+			name: "duplicate reply is counted once",
+			steps: func(th *Thread) {
+				th.add(reply("a", alice, time.Second), true)
+				th.add(reply("a", alice, time.Second), true)
+			},
+			wantCount:        1,
+			wantReplies:      1,
+			wantParticipants: []string{alice.ID},
+		},
+		{
+			name: "pending own reply is not counted",
+			steps: func(th *Thread) {
+				th.add(reply("pending-1", self, time.Second), true)
+			},
+			wantCount:   0,
+			wantReplies: 1,
+		},
+		{
+			name: "confirmed own reply replaces its placeholder",
+			steps: func(th *Thread) {
+				th.add(reply("pending-1", self, time.Second), true)
+				confirmed := reply("b", self, 2*time.Second)
+				confirmed.Nonce = "pending-1"
+				th.add(confirmed, true)
+			},
+			wantCount:        1,
+			wantReplies:      1,
+			wantParticipants: []string{self.ID},
+		},
+		{
+			name: "latest participant comes first",
+			steps: func(th *Thread) {
+				th.add(reply("a", alice, time.Second), true)
+				th.add(reply("pending-1", self, 2*time.Second), true)
+				confirmed := reply("b", self, 2*time.Second)
+				confirmed.Nonce = "pending-1"
+				th.add(confirmed, true)
+			},
+			wantCount:        2,
+			wantReplies:      2,
+			wantParticipants: []string{self.ID, alice.ID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newThread("root", "$root")
+			tt.steps(th)
+
+			if th.Count() != tt.wantCount {
+				t.Errorf("expected count %d, got %d", tt.wantCount, th.Count())
+			}
+			if got := len(th.Replies()); got != tt.wantReplies {
+				t.Errorf("expected %d replies, got %d", tt.wantReplies, got)
+			}
+
+			var participants []string
+			for _, p := range th.participants {
+				participants = append(participants, p.ID)
+			}
+			if len(participants) != len(tt.wantParticipants) {
+				t.Fatalf("expected participants %v, got %v", tt.wantParticipants, participants)
+			}
+			for i := range participants {
+				if participants[i] != tt.wantParticipants[i] {
+					t.Errorf("expected participants %v, got %v", tt.wantParticipants, participants)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeChunk_ThreadSummaries(t *testing.T) {
+	raw := []json.RawMessage{
+		json.RawMessage(`{
+			"event_id": "$root",
+			"type": "m.room.message",
+			"sender": "@alice:example.com",
+			"origin_server_ts": 1700000000000,
+			"content": {"msgtype": "m.text", "body": "root"},
+			"unsigned": {"m.relations": {"m.thread": {
+				"count": 3,
+				"current_user_participated": true,
+				"latest_event": {
+					"event_id": "$latest",
+					"type": "m.room.message",
+					"sender": "@bob:example.com",
+					"origin_server_ts": 1700000060000,
+					"content": {"msgtype": "m.text", "body": "reply"}
+				}
+			}}}
+		}`),
+		json.RawMessage(`{
+			"event_id": "$plain",
+			"type": "m.room.message",
+			"sender": "@alice:example.com",
+			"origin_server_ts": 1700000001000,
+			"content": {"msgtype": "m.text", "body": "plain"}
+		}`),
+	}
+
+	chunk, summaries, err := decodeChunk(raw)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(chunk) != 2 || chunk[0].ID != "$root" || chunk[1].ID != "$plain" {
+		t.Fatalf("expected both events in order, got %v", chunk)
+	}
+	if _, ok := summaries["$plain"]; ok {
+		t.Error("expected no summary for an event without a thread")
+	}
+
+	summary, ok := summaries["$root"]
+	if !ok {
+		t.Fatal("expected a summary for the thread root")
+	}
+	if summary.Count != 3 || !summary.CurrentUserParticipated {
+		t.Errorf("expected count 3 with participation, got %+v", summary)
+	}
+	if summary.LatestEvent == nil || summary.LatestEvent.Sender != "@bob:example.com" {
+		t.Errorf("expected the latest reply from bob, got %+v", summary.LatestEvent)
+	}
+}
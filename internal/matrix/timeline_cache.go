@@ -0,0 +1,460 @@
+package matrix
+
+import (
+	"context"
+	"crypto/cipher"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+	"maunium.net/go/mautrix/crypto/attachment"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/arko-chat/arko/internal/models"
+)
+
+const (
+	// defaultTimelineCacheLimit is how many messages per room are kept on
+	// disk when the config doesn't say otherwise
+	defaultTimelineCacheLimit = 500
+	timelinePruneInterval     = time.Minute
+)
+
+// cachedMessage is what's stored for each message. Message holds the
+// original content and its thread summary. Edits and reactions are kept
+// alongside it and indexed again on load, so the edit history survives a
+// restart, and redacting an edit or a reaction still works on messages
+// that haven't been fetched from the server since. Embeds are left out
+// since they're fetched again.
+type cachedMessage struct {
+	Message   models.Message   `json:"message"`
+	Edits     []cachedEdit     `json:"edits,omitempty"`
+	Reactions []cachedReaction `json:"reactions,omitempty"`
+	Media     []cachedMedia    `json:"media,omitempty"`
+}
+
+type cachedReaction struct {
+	EventID id.EventID `json:"event_id"`
+	Key     string     `json:"key"`
+	Sender  string     `json:"sender"`
+}
+
+type cachedEdit struct {
+	EventID   id.EventID `json:"event_id"`
+	Sender    string     `json:"sender"`
+	Content   string     `json:"content"`
+	Formatted string     `json:"formatted,omitempty"`
+	Timestamp time.Time  `json:"ts"`
+}
+
+// cachedMedia keeps the keys of encrypted attachments, so their URLs still
+// resolve after a restart.
+type cachedMedia struct {
+	Ref      string                   `json:"ref"`
+	Path     string                   `json:"path"`
+	MimeType string                   `json:"mime_type"`
+	File     attachment.EncryptedFile `json:"file"`
+}
+
+type timelineOp struct {
+	roomID  string
+	eventID string
+	// entry is nil for deletions
+	entry *cachedMessage
+}
+
+// timelineCache persists decrypted messages so rooms render before the
+// network responds and stay readable offline. Rows are sealed with a key
+// derived from the session's pickle key. Writes go through a single
+// goroutine so they're applied in the order messages were set.
+type timelineCache struct {
+	db     *dbutil.Database
+	aead   cipher.AEAD
+	limit  int
+	logger *slog.Logger
+
+	ops  chan timelineOp
+	quit chan struct{}
+	done chan struct{}
+
+	dirtyMu sync.Mutex
+	dirty   map[string]struct{}
+}
+
+func newTimelineCache(ctx context.Context, db *dbutil.Database, pickleKey []byte, limit int, logger *slog.Logger) (*timelineCache, error) {
+	if limit == 0 {
+		limit = defaultTimelineCacheLimit
+	}
+
+	aead, err := storeAEAD(pickleKey, "arko timeline cache")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS arko_timeline (
+			event_id TEXT PRIMARY KEY,
+			room_id  TEXT    NOT NULL,
+			ts       INTEGER NOT NULL,
+			data     BLOB    NOT NULL
+		)`)
+	if err == nil {
+		_, err = db.Exec(ctx, `CREATE INDEX IF NOT EXISTS arko_timeline_room_ts ON arko_timeline (room_id, ts)`)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create timeline table: %w", err)
+	}
+
+	c := &timelineCache{
+		db:     db,
+		aead:   aead,
+		limit:  limit,
+		logger: logger,
+		ops:    make(chan timelineOp, 256),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+		dirty:  make(map[string]struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+func (c *timelineCache) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(timelinePruneInterval)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+	for {
+		select {
+		case op := <-c.ops:
+			c.apply(ctx, op)
+		case <-ticker.C:
+			c.prune(ctx)
+		case <-c.quit:
+			for {
+				select {
+				case op := <-c.ops:
+					c.apply(ctx, op)
+				default:
+					c.prune(ctx)
+					return
+				}
+			}
+		}
+	}
+}
+
+// close flushes pending writes. The database is closed by the caller.
+func (c *timelineCache) close() {
+	close(c.quit)
+	<-c.done
+}
+
+func (c *timelineCache) apply(ctx context.Context, op timelineOp) {
+	if op.entry == nil {
+		if _, err := c.db.Exec(ctx, `DELETE FROM arko_timeline WHERE event_id=$1`, op.eventID); err != nil {
+			c.logger.Warn("failed to delete cached message", "err", err)
+		}
+		return
+	}
+
+	data, err := c.seal(op.roomID, op.eventID, op.entry)
+	if err == nil {
+		_, err = c.db.Exec(ctx, `
+			INSERT INTO arko_timeline (event_id, room_id, ts, data) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (event_id) DO UPDATE SET ts=excluded.ts, data=excluded.data`,
+			op.eventID, op.roomID, op.entry.Message.Timestamp.UnixMilli(), data,
+		)
+	}
+	if err != nil {
+		c.logger.Warn("failed to cache message", "err", err)
+		return
+	}
+
+	c.dirtyMu.Lock()
+	c.dirty[op.roomID] = struct{}{}
+	c.dirtyMu.Unlock()
+}
+
+// prune applies the retention limit to rooms written since the last run.
+func (c *timelineCache) prune(ctx context.Context) {
+	c.dirtyMu.Lock()
+	rooms := c.dirty
+	c.dirty = make(map[string]struct{})
+	c.dirtyMu.Unlock()
+
+	for roomID := range rooms {
+		_, err := c.db.Exec(ctx, `
+			DELETE FROM arko_timeline WHERE room_id=$1 AND event_id NOT IN (
+				SELECT event_id FROM arko_timeline WHERE room_id=$1 ORDER BY ts DESC LIMIT $2
+			)`, roomID, c.limit)
+		if err != nil {
+			c.logger.Warn("failed to prune timeline cache", "roomID", roomID, "err", err)
+		}
+	}
+}
+
+func (c *timelineCache) put(roomID string, entry cachedMessage) {
+	c.send(timelineOp{roomID: roomID, eventID: entry.Message.EventID, entry: &entry})
+}
+
+func (c *timelineCache) remove(roomID, eventID string) {
+	c.send(timelineOp{roomID: roomID, eventID: eventID})
+}
+
+func (c *timelineCache) send(op timelineOp) {
+	select {
+	case c.ops <- op:
+	case <-c.quit:
+	}
+}
+
+// load returns up to limit of a room's newest cached messages, newest first.
+// Rows that no longer open, e.g. after the pickle key changed, are skipped.
+func (c *timelineCache) load(ctx context.Context, roomID string, limit int) ([]cachedMessage, error) {
+	rows, err := c.db.Query(ctx,
+		`SELECT event_id, data FROM arko_timeline WHERE room_id=$1 ORDER BY ts DESC LIMIT $2`,
+		roomID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []cachedMessage
+	for rows.Next() {
+		var (
+			eventID string
+			data    []byte
+		)
+		if err := rows.Scan(&eventID, &data); err != nil {
+			return entries, err
+		}
+		entry, err := c.open(roomID, eventID, data)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (c *timelineCache) seal(roomID, eventID string, entry *cachedMessage) ([]byte, error) {
+	// binding the row's keys stops ciphertext from being moved between rows
+	return sealRow(c.aead, roomID+"\x00"+eventID, entry)
+}
+
+func (c *timelineCache) open(roomID, eventID string, data []byte) (cachedMessage, error) {
+	var entry cachedMessage
+	err := openRow(c.aead, roomID+"\x00"+eventID, data, &entry)
+	return entry, err
+}
+
+// cacheMessage writes a settled message through to the timeline cache.
+func (t *MessageTree) cacheMessage(msg models.Message) {
+	m := t.matrixSession
+	if m.timelineCache == nil || msg.EventID == "" {
+		return
+	}
+	if msg.IsPending() || msg.IsDecrypting() || msg.Undecryptable || msg.Deleting {
+		return
+	}
+
+	entry := cachedMessage{Message: msg}
+	entry.Message.Nonce = ""
+	entry.Message.DeleteFailed = false
+	entry.Message.Reactions = nil
+	entry.Message.Embeds = nil
+
+	if original, ok := t.edits.original(msg.ID); ok {
+		entry.Message.Content = original.Content
+		entry.Message.FormattedContent = original.FormattedContent
+		entry.Message.Edited = false
+		entry.Message.EditedAt = time.Time{}
+	}
+	// queued relations are restored from the outbox
+	for _, v := range t.edits.versions(msg.ID) {
+		if isPendingEventID(v.eventID) {
+			continue
+		}
+		entry.Edits = append(entry.Edits, cachedEdit{
+			EventID:   v.eventID,
+			Sender:    v.sender,
+			Content:   v.content,
+			Formatted: v.formatted,
+			Timestamp: v.timestamp,
+		})
+	}
+	for evtID, ref := range t.reactions.events(msg.ID) {
+		if isPendingEventID(evtID) {
+			continue
+		}
+		entry.Reactions = append(entry.Reactions, cachedReaction{
+			EventID: evtID,
+			Key:     ref.key,
+			Sender:  ref.sender,
+		})
+	}
+
+	for _, a := range msg.Attachments {
+		ref := attachmentRef(a.URL)
+		if ref == "" {
+			continue
+		}
+		if media, ok := m.encryptedMedia.Load(ref); ok {
+			entry.Media = append(entry.Media, cachedMedia{
+				Ref:      ref,
+				Path:     media.Path,
+				MimeType: media.MimeType,
+				File:     media.file,
+			})
+		}
+	}
+
+	m.timelineCache.put(msg.RoomID, entry)
+}
+
+func (m *MatrixSession) uncacheMessage(msg models.Message) {
+	if m.timelineCache == nil || msg.EventID == "" || msg.IsPending() || msg.IsDecrypting() {
+		return
+	}
+	m.timelineCache.remove(msg.RoomID, msg.EventID)
+}
+
+func isPendingEventID(evtID id.EventID) bool {
+	return strings.HasPrefix(evtID.String(), "pending-")
+}
+
+func attachmentRef(rawURL string) string {
+	_, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return ""
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return ""
+	}
+	return values.Get("ref")
+}
+
+// loadCached fills an empty tree from the timeline cache and returns how
+// many messages it added.
+func (t *MessageTree) loadCached(ctx context.Context) int {
+	c := t.matrixSession.timelineCache
+	if c == nil {
+		return 0
+	}
+
+	entries, err := c.load(ctx, t.roomID, windowSize)
+	if err != nil {
+		t.matrixSession.logger.Warn("failed to load cached messages", "roomID", t.roomID, "err", err)
+	}
+
+	for _, entry := range entries {
+		for _, media := range entry.Media {
+			t.matrixSession.encryptedMedia.Store(media.Ref, NewEncryptedMedia(media.Path, media.MimeType, media.File))
+		}
+		for _, edit := range entry.Edits {
+			t.edits.add(entry.Message.ID, editVersion{
+				eventID:   edit.EventID,
+				sender:    edit.Sender,
+				content:   edit.Content,
+				formatted: edit.Formatted,
+				timestamp: edit.Timestamp,
+			})
+		}
+		for _, r := range entry.Reactions {
+			t.reactions.add(entry.Message.ID, r.Key, r.Sender, r.EventID)
+		}
+		if entry.Message.ThreadCount > 0 {
+			th := t.thread(entry.Message.ID, id.EventID(entry.Message.EventID))
+			th.restoreSummary(entry.Message)
+		}
+		t.set(entry.Message, false)
+	}
+	return len(entries)
+}
+
+// reconcileCached fetches the newest page from the server over messages
+// loaded from the cache. Cached messages are replaced by the server's
+// versions as pages come in, which brings in edits and redactions made
+// while offline. When the newest page doesn't reach back to the cache,
+// the cached messages would sit on the wrong side of a hole in the
+// timeline, so they're taken out of the tree and paginated back in.
+//
+// Only the newest page is fetched here. Cached messages older than it are
+// shown as they were cached until scrolling back paginates over them, so
+// edits and redactions made to them while offline show up late.
+func (t *MessageTree) reconcileCached(ctx context.Context) {
+	t.mu.RLock()
+	cachedNewest, _ := t.BTreeG.Max()
+	t.mu.RUnlock()
+
+	t.prevBatchMu.RLock()
+	boundaries := len(t.boundaries)
+	t.prevBatchMu.RUnlock()
+
+	t.fetchOlder(ctx, windowPage)
+
+	t.prevBatchMu.RLock()
+	var pageOldest time.Time
+	if len(t.boundaries) > boundaries {
+		pageOldest = t.boundaries[len(t.boundaries)-1].at
+	}
+	t.prevBatchMu.RUnlock()
+
+	if pageOldest.IsZero() || !cachedNewest.Timestamp.Before(pageOldest) {
+		return
+	}
+
+	t.mu.RLock()
+	var stale []models.Message
+	t.BTreeG.Scan(func(m models.Message) bool {
+		if !m.Timestamp.Before(pageOldest) {
+			return false
+		}
+		if !m.IsPending() {
+			stale = append(stale, m)
+		}
+		return true
+	})
+	t.mu.RUnlock()
+
+	var evicted []models.Message
+	for _, m := range stale {
+		if t.inWindow(m) {
+			evicted = append(evicted, m)
+		}
+	}
+
+	t.dropMessages(func(m models.Message) bool {
+		return m.Timestamp.Before(pageOldest) && !m.IsPending()
+	})
+
+	if len(evicted) == 0 {
+		return
+	}
+
+	t.mu.RLock()
+	edge, ok := t.BTreeG.Min()
+	t.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	t.view.Lock()
+	t.window.oldest = &edge
+	t.view.Unlock()
+
+	t.sendEventToListeners(MessageTreeEvent{
+		EventType: EvictEvent,
+		Message:   edge,
+		Evicted:   evicted,
+	})
+}
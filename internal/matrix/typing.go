@@ -25,6 +25,7 @@ type TypingTracker struct {
 	listeners   []chan TypingEvent
 	listenerMu  sync.RWMutex
 	currentUser string
+	ignored     map[string]struct{}
 }
 
 func NewTypingTracker(currentUser string) *TypingTracker {
@@ -38,6 +39,10 @@ func (t *TypingTracker) SetTyping(roomID string, user models.User, typing bool,
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	if _, ok := t.ignored[user.ID]; ok && typing {
+		return
+	}
+
 	if t.rooms[roomID] == nil {
 		t.rooms[roomID] = make(map[string]*TypingUser)
 	}
@@ -57,6 +62,28 @@ func (t *TypingTracker) SetTyping(roomID string, user models.User, typing bool,
 	go t.notifyListeners(roomID)
 }
 
+// SetIgnored hides the typing notices of ignored users, including the ones
+// already shown.
+func (t *TypingTracker) SetIgnored(ignored map[string]struct{}) {
+	t.mu.Lock()
+	t.ignored = ignored
+	var changed []string
+	for roomID, room := range t.rooms {
+		n := len(room)
+		for userID := range ignored {
+			delete(room, userID)
+		}
+		if len(room) != n {
+			changed = append(changed, roomID)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, roomID := range changed {
+		go t.notifyListeners(roomID)
+	}
+}
+
 func (t *TypingTracker) GetTypingUsers(roomID string) []string {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -0,0 +1,603 @@
+package matrix
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"github.com/puzpuzpuz/xsync/v4"
+	"maunium.net/go/mautrix/event"
+)
+
+const (
+	// windowSize is how many messages of a room are rendered at once
+	windowSize = 100
+	// windowPage is how many messages scrolling reveals at a time
+	windowPage = 30
+	// maxTreeMessages bounds how many messages a room keeps in memory
+	maxTreeMessages = 4 * windowSize
+	// maxDroppedRelations bounds how many messages that left the tree keep
+	// their reactions, edits and threads. Those events are usually newer
+	// than the cut, so paginating the message back in doesn't bring them.
+	maxDroppedRelations = 4 * maxTreeMessages
+)
+
+// messageWindow is the range of the tree that's rendered in the DOM.
+// Messages outside of it are kept in the tree without being sent to
+// listeners until scrolling brings them back into view.
+type messageWindow struct {
+	oldest *models.Message
+	// newest is nil while the window follows the live timeline
+	newest *models.Message
+}
+
+// pageBoundary remembers the pagination token that splits the timeline at
+// a given time, so messages on either side of it can be dropped from the
+// tree and fetched again later.
+type pageBoundary struct {
+	token string
+	at    time.Time
+}
+
+func oldestTimestamp(chunk []*event.Event) (time.Time, bool) {
+	var oldest time.Time
+	for _, evt := range chunk {
+		ts := time.UnixMilli(evt.Timestamp)
+		if oldest.IsZero() || ts.Before(oldest) {
+			oldest = ts
+		}
+	}
+	return oldest, !oldest.IsZero()
+}
+
+func newestTimestamp(chunk []*event.Event) (time.Time, bool) {
+	var newest time.Time
+	for _, evt := range chunk {
+		if ts := time.UnixMilli(evt.Timestamp); ts.After(newest) {
+			newest = ts
+		}
+	}
+	return newest, !newest.IsZero()
+}
+
+func (t *MessageTree) inWindow(m models.Message) bool {
+	t.view.RLock()
+	defer t.view.RUnlock()
+
+	w := t.window
+	if w.oldest == nil || byTimestamp(m, *w.oldest) {
+		return false
+	}
+	return w.newest == nil || !byTimestamp(*w.newest, m)
+}
+
+func (t *MessageTree) followingLive() bool {
+	t.view.RLock()
+	defer t.view.RUnlock()
+	return t.window.oldest != nil && t.window.newest == nil
+}
+
+// HasNewer reports whether there are messages after the window, either in
+// the tree or still on the server.
+func (t *MessageTree) HasNewer() bool {
+	t.view.RLock()
+	defer t.view.RUnlock()
+	return t.window.newest != nil
+}
+
+// Chronological returns the messages to render for a fresh view of the room,
+// newest first, and resets the window to them. The window is centred on the
+// last jump target if there is one, and otherwise ends at the newest message.
+func (t *MessageTree) Chronological() []models.Message {
+	go t.retryDecryptAll(t.matrixSession.manager.ctx)
+
+	// the tree lock is always taken before the view lock
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.view.Lock()
+	defer t.view.Unlock()
+
+	var (
+		newer []models.Message
+		older []models.Message
+	)
+
+	switch {
+	case t.focus != nil:
+		t.BTreeG.Ascend(*t.focus, func(item models.Message) bool {
+			if t.gap.hides(item) {
+				return false
+			}
+			newer = append(newer, item)
+			return len(newer) < windowSize/2
+		})
+		t.BTreeG.Descend(*t.focus, func(item models.Message) bool {
+			if item.ID != t.focus.ID {
+				older = append(older, item)
+			}
+			return len(older) < windowSize/2
+		})
+	case t.gap != nil:
+		t.BTreeG.Descend(models.Message{Timestamp: t.gap.newest.Add(time.Millisecond)}, func(item models.Message) bool {
+			older = append(older, item)
+			return len(older) < windowSize
+		})
+	default:
+		t.BTreeG.Reverse(func(item models.Message) bool {
+			older = append(older, item)
+			return len(older) < windowSize
+		})
+	}
+	t.focus = nil
+
+	items := make([]models.Message, 0, len(newer)+len(older))
+	for i := len(newer) - 1; i >= 0; i-- {
+		items = append(items, newer[i])
+	}
+	items = append(items, older...)
+
+	t.window = messageWindow{}
+	if len(items) == 0 {
+		t.window.oldest = &models.Message{}
+		return items
+	}
+
+	oldest := items[len(items)-1]
+	t.window.oldest = &oldest
+
+	latest, _ := t.BTreeG.Max()
+	if t.gap != nil || items[0].ID != latest.ID {
+		newest := items[0]
+		t.window.newest = &newest
+	}
+	return items
+}
+
+// LoadNextMessages reveals older messages, fetching them from the server
+// once the tree runs out.
+func (t *MessageTree) LoadNextMessages(ctx context.Context, limit int) bool {
+	t.populating.Lock()
+	defer t.populating.Unlock()
+
+	if t.countOutsideWindow(false) < limit && !t.noMoreHistory.Load() {
+		t.fetchOlder(ctx, limit)
+	}
+
+	t.revealOlder(limit)
+	t.trimWindow(true)
+	t.enforceTreeLimit()
+
+	return t.countOutsideWindow(false) > 0 || !t.noMoreHistory.Load()
+}
+
+func (t *MessageTree) fetchOlder(ctx context.Context, limit int) {
+	if t.noMoreHistory.Load() {
+		return
+	}
+
+	t.prevBatchMu.RLock()
+	token := t.prevBatch
+	t.prevBatchMu.RUnlock()
+
+	t.populateTree(ctx, token, "", limit)
+}
+
+// LoadNewerMessages reveals messages after the window, paginating a
+// jumped-to chunk forwards when the tree runs out. The window follows the
+// live timeline again once it reaches the newest message.
+func (t *MessageTree) LoadNewerMessages(ctx context.Context, limit int) bool {
+	t.populating.Lock()
+	defer t.populating.Unlock()
+
+	if !t.HasNewer() {
+		return false
+	}
+
+	if t.countOutsideWindow(true) < limit {
+		t.fetchNewer(ctx, limit)
+	}
+
+	t.revealNewer(limit)
+	t.trimWindow(false)
+	t.enforceTreeLimit()
+
+	t.view.RLock()
+	gap := t.gap
+	t.view.RUnlock()
+	if gap != nil || t.countOutsideWindow(true) > 0 {
+		return true
+	}
+
+	t.view.Lock()
+	last := t.window.newest
+	t.window.newest = nil
+	t.view.Unlock()
+
+	// catch anything that arrived while the window still had an end
+	if last != nil {
+		t.mu.RLock()
+		var missed []models.Message
+		t.BTreeG.Ascend(*last, func(item models.Message) bool {
+			if item.ID != last.ID {
+				missed = append(missed, item)
+			}
+			return true
+		})
+		t.mu.RUnlock()
+		for _, m := range missed {
+			t.emitAdd(m)
+		}
+	}
+	return false
+}
+
+// countOutsideWindow counts messages in the tree before or after the window.
+func (t *MessageTree) countOutsideWindow(newer bool) int {
+	w, gap := t.viewSnapshot()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	count := 0
+	switch {
+	case newer && w.newest != nil:
+		t.BTreeG.Ascend(*w.newest, func(item models.Message) bool {
+			if item.ID != w.newest.ID && !gap.hides(item) {
+				count++
+			}
+			return true
+		})
+	case !newer && w.oldest != nil:
+		t.BTreeG.Descend(*w.oldest, func(item models.Message) bool {
+			if item.ID != w.oldest.ID {
+				count++
+			}
+			return true
+		})
+	}
+	return count
+}
+
+func (g *timelineGap) hides(m models.Message) bool {
+	return g != nil && m.Timestamp.After(g.newest)
+}
+
+func (t *MessageTree) viewSnapshot() (messageWindow, *timelineGap) {
+	t.view.RLock()
+	defer t.view.RUnlock()
+
+	if t.gap == nil {
+		return t.window, nil
+	}
+	gap := *t.gap
+	return t.window, &gap
+}
+
+func (t *MessageTree) revealOlder(limit int) {
+	t.view.RLock()
+	pivot := t.window.oldest
+	t.view.RUnlock()
+	if pivot == nil {
+		return
+	}
+
+	var batch []models.Message
+	t.mu.RLock()
+	t.BTreeG.Descend(*pivot, func(item models.Message) bool {
+		if item.ID != pivot.ID {
+			batch = append(batch, item)
+		}
+		return len(batch) < limit
+	})
+	t.mu.RUnlock()
+
+	// newest first, so every message lands before one that's already shown
+	for _, m := range batch {
+		t.view.Lock()
+		t.window.oldest = &m
+		t.view.Unlock()
+		t.emitAdd(m)
+	}
+}
+
+func (t *MessageTree) revealNewer(limit int) {
+	w, gap := t.viewSnapshot()
+	pivot := w.newest
+	if pivot == nil {
+		return
+	}
+
+	var batch []models.Message
+	t.mu.RLock()
+	t.BTreeG.Ascend(*pivot, func(item models.Message) bool {
+		if item.ID == pivot.ID {
+			return true
+		}
+		if gap.hides(item) {
+			return false
+		}
+		batch = append(batch, item)
+		return len(batch) < limit
+	})
+	t.mu.RUnlock()
+
+	// oldest first, so every message lands after one that's already shown
+	for _, m := range batch {
+		t.view.Lock()
+		t.window.newest = &m
+		t.view.Unlock()
+		t.emitAdd(m)
+	}
+}
+
+func (t *MessageTree) emitAdd(m models.Message) {
+	t.mu.RLock()
+	neighbors := t.getNeighbors(m)
+	t.mu.RUnlock()
+
+	t.sendEventToListeners(MessageTreeEvent{
+		Message:   m,
+		EventType: AddEvent,
+		Neighbors: neighbors,
+	})
+}
+
+func (t *MessageTree) trimLiveWindow() {
+	t.populating.Lock()
+	defer t.populating.Unlock()
+	t.trimming.Store(false)
+
+	// leave some slack so a busy room doesn't evict on every message
+	if t.countInWindow() > windowSize+windowPage {
+		t.trimWindow(false)
+		t.enforceTreeLimit()
+	}
+}
+
+func (t *MessageTree) countInWindow() int {
+	t.view.RLock()
+	w := t.window
+	t.view.RUnlock()
+	if w.oldest == nil {
+		return 0
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	count := 0
+	t.BTreeG.Ascend(*w.oldest, func(item models.Message) bool {
+		if w.newest != nil && byTimestamp(*w.newest, item) {
+			return false
+		}
+		count++
+		return true
+	})
+	return count
+}
+
+// trimWindow shrinks the window back to windowSize, evicting messages from
+// the DOM at the newer end when keepOlder is set and at the older end
+// otherwise.
+func (t *MessageTree) trimWindow(keepOlder bool) {
+	excess := t.countInWindow() - windowSize
+	if excess <= 0 {
+		return
+	}
+
+	t.mu.RLock()
+	t.view.Lock()
+
+	var (
+		evicted []models.Message
+		edge    *models.Message
+	)
+	collect := func(item models.Message) bool {
+		if len(evicted) == excess {
+			edge = &item
+			return false
+		}
+		evicted = append(evicted, item)
+		return true
+	}
+
+	w := t.window
+	switch {
+	case !keepOlder:
+		t.BTreeG.Ascend(*w.oldest, collect)
+	case w.newest != nil:
+		t.BTreeG.Descend(*w.newest, collect)
+	default:
+		t.BTreeG.Reverse(collect)
+	}
+
+	if edge != nil {
+		if keepOlder {
+			t.window.newest = edge
+		} else {
+			t.window.oldest = edge
+		}
+	}
+
+	t.view.Unlock()
+	t.mu.RUnlock()
+
+	if edge == nil {
+		return
+	}
+
+	t.sendEventToListeners(MessageTreeEvent{
+		EventType: EvictEvent,
+		Message:   *edge,
+		Evicted:   evicted,
+		Newer:     keepOlder,
+	})
+}
+
+// enforceTreeLimit drops messages far away from the window once the tree
+// holds more than maxTreeMessages, cutting at a page boundary so they can be
+// paginated back in.
+func (t *MessageTree) enforceTreeLimit() {
+	t.mu.RLock()
+	size := t.Len()
+	t.mu.RUnlock()
+	if size <= maxTreeMessages {
+		return
+	}
+
+	t.view.RLock()
+	w := t.window
+	t.view.RUnlock()
+	if w.oldest == nil {
+		return
+	}
+
+	if t.countOutsideWindow(false) >= t.countOutsideWindow(true) {
+		t.dropOlderThan(*w.oldest)
+	} else {
+		t.dropNewerThan(*w.newest)
+	}
+}
+
+func (t *MessageTree) dropOlderThan(oldest models.Message) {
+	t.prevBatchMu.Lock()
+	var cut *pageBoundary
+	for i, b := range t.boundaries {
+		if b.at.After(oldest.Timestamp) {
+			continue
+		}
+		if cut == nil || b.at.After(cut.at) {
+			cut = &t.boundaries[i]
+		}
+	}
+	if cut == nil {
+		t.prevBatchMu.Unlock()
+		return
+	}
+
+	at, token := cut.at, cut.token
+	kept := t.boundaries[:0]
+	for _, b := range t.boundaries {
+		if !b.at.Before(at) {
+			kept = append(kept, b)
+		}
+	}
+	t.boundaries = kept
+	t.prevBatch = token
+	t.noMoreHistory.Store(false)
+	t.prevBatchMu.Unlock()
+
+	t.dropMessages(func(m models.Message) bool {
+		return m.Timestamp.Before(at)
+	})
+}
+
+func (t *MessageTree) dropNewerThan(newest models.Message) {
+	t.prevBatchMu.Lock()
+	var cut *pageBoundary
+	for i, b := range t.boundaries {
+		if !b.at.After(newest.Timestamp) {
+			continue
+		}
+		if cut == nil || b.at.Before(cut.at) {
+			cut = &t.boundaries[i]
+		}
+	}
+	if cut == nil {
+		t.prevBatchMu.Unlock()
+		return
+	}
+
+	at, token := cut.at, cut.token
+	kept := t.boundaries[:0]
+	for _, b := range t.boundaries {
+		if !b.at.After(at) {
+			kept = append(kept, b)
+		}
+	}
+	t.boundaries = kept
+	t.prevBatchMu.Unlock()
+
+	// what's left after the cut is a chunk that has to be paginated
+	// forwards to reach the live timeline again
+	t.view.Lock()
+	if t.gap == nil {
+		t.gap = &timelineGap{}
+	}
+	t.gap.forward = token
+	t.gap.newest = at.Add(-time.Millisecond)
+	t.gap.liveFrom = time.Time{}
+	t.view.Unlock()
+
+	t.dropMessages(func(m models.Message) bool {
+		return !m.Timestamp.Before(at) && !m.IsPending()
+	})
+}
+
+func (t *MessageTree) dropMessages(match func(models.Message) bool) []models.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var dropped []models.Message
+	t.BTreeG.Scan(func(m models.Message) bool {
+		if match(m) {
+			dropped = append(dropped, m)
+		}
+		return true
+	})
+	for _, m := range dropped {
+		t.BTreeG.Delete(m)
+		t.messagesMap.Delete(m.ID)
+		t.forget(m)
+	}
+	return dropped
+}
+
+// forget prunes everything kept by the ID of a message that was dropped from
+// the tree. Its relations are kept until maxDroppedRelations other messages
+// have been dropped after it.
+func (t *MessageTree) forget(m models.Message) {
+	t.rawEncryptedEvents.Delete(m.ID)
+	t.pendingRedactions.Delete(m.ID)
+
+	t.dropped = slices.DeleteFunc(t.dropped, func(id string) bool { return id == m.ID })
+	t.dropped = append(t.dropped, m.ID)
+	for len(t.dropped) > maxDroppedRelations {
+		expired := t.dropped[0]
+		t.dropped = t.dropped[1:]
+		if _, ok := t.messagesMap.Load(expired); !ok {
+			t.forgetRelations(expired)
+		}
+	}
+
+	t.replyPreviews.Delete(m.ID)
+	t.replyWaiters.Range(func(parentID string, _ []string) bool {
+		t.replyWaiters.Compute(parentID, func(waiters []string, loaded bool) ([]string, xsync.ComputeOp) {
+			if !loaded {
+				return nil, xsync.CancelOp
+			}
+			waiters = slices.DeleteFunc(waiters, func(w string) bool { return w == m.ID })
+			if len(waiters) == 0 {
+				return nil, xsync.DeleteOp
+			}
+			return waiters, xsync.UpdateOp
+		})
+		return true
+	})
+
+	t.embedCache.Invalidate(embedCacheKey(t.roomID, m.ID))
+	t.matrixSession.forgetEncryptedMedia(m)
+}
+
+func (t *MessageTree) forgetRelations(messageID string) {
+	t.reactions.forget(messageID)
+	t.edits.forget(messageID)
+
+	if _, ok := t.threads.LoadAndDelete(messageID); ok {
+		t.threadReplies.DeleteMatching(func(_ string, rootID string) (bool, bool) {
+			return rootID == messageID, false
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package matrix
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arko-chat/arko/internal/models"
+	"maunium.net/go/mautrix/id"
+)
+
+func TestMessageTree_DropMessages(t *testing.T) {
+	base := time.UnixMilli(1700000000000)
+	at := func(i int) time.Time { return base.Add(time.Duration(i) * time.Minute) }
+	msgID := func(i int) string { return fmt.Sprintf("m%d", i) }
+
+	tests := []struct {
+		name        string
+		drop        func(tree *MessageTree)
+		wantKept    []int
+		wantGap     bool
+		wantPrev    string
+		wantDropped []int
+	}{
+		{
+			name: "older than the window",
+			drop: func(tree *MessageTree) {
+				msg, _ := tree.GetMessage(msgID(6))
+				tree.dropOlderThan(msg)
+			},
+			wantKept:    []int{4, 5, 6, 7, 8, 9},
+			wantPrev:    "t4",
+			wantDropped: []int{0, 1, 2, 3},
+		},
+		{
+			name: "newer than the window",
+			drop: func(tree *MessageTree) {
+				msg, _ := tree.GetMessage(msgID(3))
+				tree.dropNewerThan(msg)
+			},
+			wantKept:    []int{0, 1, 2, 3},
+			wantGap:     true,
+			wantPrev:    "t0",
+			wantDropped: []int{4, 5, 6, 7, 8, 9},
+		},
+		{
+			name: "without a boundary to cut at",
+			drop: func(tree *MessageTree) {
+				msg, _ := tree.GetMessage(msgID(1))
+				tree.dropOlderThan(msg)
+			},
+			wantKept: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+			wantPrev: "t0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockMatrixServer()
+			defer server.Close()
+
+			tree := newMessageTree(newTestMatrixSessionWithServer(server), "!room:example.com")
+			for i := range 10 {
+				tree.set(models.Message{
+					ID:        msgID(i),
+					EventID:   fmt.Sprintf("$e%d", i),
+					Author:    models.User{ID: "@alice:example.com"},
+					Content:   "hello",
+					Timestamp: at(i),
+				}, false)
+				tree.reactions.add(msgID(i), "👍", "@bob:example.com", id.EventID(fmt.Sprintf("$r%d", i)))
+				tree.thread(msgID(i), id.EventID(fmt.Sprintf("$e%d", i)))
+			}
+			tree.prevBatch = "t0"
+			tree.boundaries = []pageBoundary{{token: "t4", at: at(4)}}
+
+			tt.drop(tree)
+
+			if tree.Len() != len(tt.wantKept) {
+				t.Errorf("expected %d messages, got %d", len(tt.wantKept), tree.Len())
+			}
+			for _, i := range tt.wantKept {
+				if _, ok := tree.GetMessage(msgID(i)); !ok {
+					t.Errorf("expected %s to be kept", msgID(i))
+				}
+			}
+			for _, i := range tt.wantDropped {
+				if _, ok := tree.messagesMap.Load(msgID(i)); ok {
+					t.Errorf("expected %s to be dropped", msgID(i))
+				}
+				if got := tree.reactions.summary(msgID(i), ""); len(got) != 1 {
+					t.Errorf("expected reactions of %s to be kept, got %v", msgID(i), got)
+				}
+				if _, ok := tree.threads.Load(msgID(i)); !ok {
+					t.Errorf("expected thread of %s to be kept", msgID(i))
+				}
+			}
+			if (tree.gap != nil) != tt.wantGap {
+				t.Errorf("expected gap %v, got %v", tt.wantGap, tree.gap)
+			}
+			if tree.prevBatch != tt.wantPrev {
+				t.Errorf("expected prev batch %q, got %q", tt.wantPrev, tree.prevBatch)
+			}
+		})
+	}
+}
+
+func TestMessageTree_DropMessagesRelations(t *testing.T) {
+	base := time.UnixMilli(1700000000000)
+	msg := func(i int) models.Message {
+		return models.Message{
+			ID:        fmt.Sprintf("m%d", i),
+			EventID:   fmt.Sprintf("$e%d", i),
+			Author:    models.User{ID: "@alice:example.com"},
+			Content:   "hello",
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+		}
+	}
+
+	tests := []struct {
+		name          string
+		dropped       int
+		wantRelations bool
+	}{
+		{
+			name:          "kept when the message is paginated back in",
+			dropped:       1,
+			wantRelations: true,
+		},
+		{
+			name:          "pruned once enough other messages were dropped",
+			dropped:       maxDroppedRelations + 1,
+			wantRelations: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockMatrixServer()
+			defer server.Close()
+
+			tree := newMessageTree(newTestMatrixSessionWithServer(server), "!room:example.com")
+			for i := range tt.dropped {
+				tree.set(msg(i), false)
+			}
+			tree.reactions.add("m0", "👍", "@bob:example.com", "$r0")
+			tree.edits.add("m0", editVersion{
+				eventID:   "$edit0",
+				sender:    "@alice:example.com",
+				content:   "edited",
+				timestamp: base.Add(time.Hour),
+			})
+			tree.refreshMessage("m0")
+
+			tree.dropMessages(func(models.Message) bool { return true })
+			if tree.Len() != 0 {
+				t.Fatalf("expected an empty tree, got %d messages", tree.Len())
+			}
+
+			tree.set(msg(0), false)
+			got, _ := tree.GetMessage("m0")
+
+			wantContent, wantReactions := "hello", 0
+			if tt.wantRelations {
+				wantContent, wantReactions = "edited", 1
+			}
+			if got.Content != wantContent {
+				t.Errorf("expected content %q, got %q", wantContent, got.Content)
+			}
+			if got.Edited != tt.wantRelations {
+				t.Errorf("expected edited %v, got %v", tt.wantRelations, got.Edited)
+			}
+			if len(got.Reactions) != wantReactions {
+				t.Errorf("expected %d reactions, got %v", wantReactions, got.Reactions)
+			}
+		})
+	}
+}
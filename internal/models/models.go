@@ -5,6 +5,7 @@ import (
 	"time"
 	"unsafe"
 
+	"github.com/arko-chat/arko/internal/sanitizer"
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
@@ -32,6 +33,7 @@ type User struct {
 	Status     UserStatus
 	Homeserver string
 	E2EE       bool
+	Unread     UnreadCount
 }
 
 type Space struct {
@@ -41,6 +43,7 @@ type Space struct {
 	Status   string
 	Address  string
 	Nickname string
+	Unread   UnreadCount
 }
 
 type Channel struct {
@@ -48,18 +51,93 @@ type Channel struct {
 	Name    string
 	Type    ChannelType
 	SpaceID string
-	Topic   string
-	E2EE    bool
+	// CategoryID is the space or subspace the channel is listed in.
+	CategoryID string
+	Topic      string
+	E2EE       bool
+	Unread     UnreadCount
+	Suggested  bool
+	// Joinable is set for channels the user can see but hasn't joined.
+	Joinable bool
 }
 
-type SpaceDetail struct {
+// Category is a subspace shown as a group of channels.
+type Category struct {
 	ID        string
 	Name      string
-	Avatar    string
-	Address   string
-	InviteURL string
+	SpaceID   string
+	ParentID  string
+	Suggested bool
+	Joinable  bool
 	Channels  []Channel
-	Users     []User
+}
+
+// UnreadCount mirrors a room's unread_notifications from sync.
+type UnreadCount struct {
+	Notifications int
+	Highlights    int
+}
+
+func (u UnreadCount) Add(o UnreadCount) UnreadCount {
+	return UnreadCount{
+		Notifications: u.Notifications + o.Notifications,
+		Highlights:    u.Highlights + o.Highlights,
+	}
+}
+
+type SpaceDetail struct {
+	ID         string
+	Name       string
+	Avatar     string
+	Address    string
+	InviteURL  string
+	Channels   []Channel
+	Categories []Category
+	Users      []User
+}
+
+type DirectoryRoom struct {
+	ID      string
+	Alias   string
+	Name    string
+	Topic   string
+	Avatar  string
+	Members int
+	IsSpace bool
+	Joined  bool
+	// Server is the directory the room was listed in, and a server to join
+	// it through.
+	Server string
+}
+
+type DirectoryPage struct {
+	Server    string
+	Query     string
+	NextBatch string
+	Rooms     []DirectoryRoom
+}
+
+// LeaveSpacePreview describes what leaving a space would affect.
+type LeaveSpacePreview struct {
+	SpaceID  string
+	Name     string
+	Children []Channel
+	// LastAdmin names the rooms, the space included, where nobody else could
+	// administer the room once the user leaves.
+	LastAdmin []string
+}
+
+// Invite is a pending invite to a room, DM or space, described by the
+// stripped state that came with it.
+type Invite struct {
+	RoomID    string
+	Name      string
+	Avatar    string
+	Topic     string
+	IsSpace   bool
+	IsDirect  bool
+	Inviter   User
+	Timestamp time.Time
 }
 
 type Reaction struct {
@@ -68,14 +146,33 @@ type Reaction struct {
 	HasCurrentUser bool
 }
 
+type MessageEdit struct {
+	Content          string
+	FormattedContent string
+	Timestamp        time.Time
+}
+
+type ReplyPreview struct {
+	ID      string
+	EventID string
+	Author  User
+	Content string
+	Loading bool
+	Missing bool
+}
+
 type Message struct {
 	ID                 string
+	EventID            string
 	Content            string
+	FormattedContent   string
 	Author             User
 	Timestamp          time.Time
 	Nonce              string
 	RoomID             string
+	ReplyTo            *ReplyPreview
 	Reactions          []Reaction
+	ThreadRootID       string
 	ThreadCount        int
 	ThreadParticipants []User
 	LastThreadReply    time.Time
@@ -83,22 +180,47 @@ type Message struct {
 	Embeds             []Embed
 	Undecryptable      bool
 	Redacted           bool
+	Edited             bool
+	EditedAt           time.Time
+	IsOwn              bool
+	MentionsMe         bool
+	CanRedact          bool
+	CanPin             bool
+	Deleting           bool
+	DeleteFailed       bool
+	SendFailed         bool
 	IsPinned           bool
 	IsSystem           bool
 	SystemIcon         string
 }
 
+type SearchResult struct {
+	Message  Message
+	RoomName string
+	Score    float64
+}
+
+// HTMLContent returns the sanitized formatted body when the sender provided
+// one and falls back to rendering the plain body as Markdown.
 func (m *Message) HTMLContent() string {
+	if m.FormattedContent != "" {
+		return m.FormattedContent
+	}
+	return RenderMarkdown(m.Content)
+}
+
+func RenderMarkdown(body string) string {
 	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
 	p := parser.NewWithExtensions(extensions)
-	doc := p.Parse([]byte(m.Content))
+	doc := p.Parse([]byte(body))
 
 	htmlFlags := html.CommonFlags | html.HrefTargetBlank
 	opts := html.RendererOptions{Flags: htmlFlags}
 	renderer := html.NewRenderer(opts)
 	bs := markdown.Render(doc, renderer)
 
-	return *(*string)(unsafe.Pointer(&bs))
+	// the body is untrusted and may contain raw HTML
+	return sanitizer.Sanitize(*(*string)(unsafe.Pointer(&bs)), nil)
 }
 
 func (m *Message) IsPending() bool {
@@ -112,8 +234,11 @@ func (m *Message) IsDecrypting() bool {
 type AttachmentType string
 
 const (
-	AttachmentFile  AttachmentType = "file"
-	AttachmentImage AttachmentType = "image"
+	AttachmentFile    AttachmentType = "file"
+	AttachmentImage   AttachmentType = "image"
+	AttachmentVideo   AttachmentType = "video"
+	AttachmentAudio   AttachmentType = "audio"
+	AttachmentSticker AttachmentType = "sticker"
 )
 
 type Attachment struct {
@@ -123,6 +248,35 @@ type Attachment struct {
 	URL      string
 	FileType string
 	AltText  string
+	MimeType string
+	Width    int
+	Height   int
+
+	Uploading bool
+	Progress  int
+	Failed    bool
+}
+
+type Sticker struct {
+	ID       string
+	Body     string
+	URL      string
+	MimeType string
+	Width    int
+	Height   int
+}
+
+type StickerPack struct {
+	ID       string
+	Name     string
+	Avatar   string
+	Stickers []Sticker
+}
+
+type StickerWidget struct {
+	ID   string
+	Name string
+	URL  string
 }
 
 type Embed struct {
@@ -0,0 +1,151 @@
+//go:build linux && !android
+
+package notify
+
+import (
+	"html"
+	"log/slog"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// freedesktop.org Desktop Notifications Specification
+const (
+	dbusDest      = "org.freedesktop.Notifications"
+	dbusPath      = "/org/freedesktop/Notifications"
+	dbusInterface = "org.freedesktop.Notifications"
+
+	defaultAction = "default"
+	urgencyHigh   = byte(2)
+)
+
+type dbusNotifier struct {
+	mu     sync.Mutex
+	conn   *dbus.Conn
+	logger *slog.Logger
+	tags   map[string]uint32
+	clicks map[uint32]func()
+}
+
+func newDesktop(logger *slog.Logger) Notifier {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		logger.Warn("desktop notifications unavailable", "err", err)
+		return noopNotifier{}
+	}
+
+	err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(dbusPath),
+		dbus.WithMatchInterface(dbusInterface),
+	)
+	if err != nil {
+		logger.Warn("failed to watch notification signals", "err", err)
+	}
+
+	n := &dbusNotifier{
+		conn:   conn,
+		logger: logger,
+		tags:   make(map[string]uint32),
+		clicks: make(map[uint32]func()),
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	go n.listen(signals)
+
+	return n
+}
+
+func (n *dbusNotifier) Show(notification Notification) error {
+	n.mu.Lock()
+	replaces := n.tags[notification.Tag]
+	n.mu.Unlock()
+
+	hints := map[string]dbus.Variant{
+		"category":      dbus.MakeVariant("im.received"),
+		"desktop-entry": dbus.MakeVariant("arko"),
+	}
+	if notification.Urgent {
+		hints["urgency"] = dbus.MakeVariant(urgencyHigh)
+	}
+
+	var actions []string
+	if notification.OnClick != nil {
+		actions = []string{defaultAction, "Open"}
+	}
+
+	var notificationID uint32
+	err := n.conn.Object(dbusDest, dbusPath).Call(
+		dbusInterface+".Notify", 0,
+		appName,
+		replaces,
+		"",
+		notification.Title,
+		// servers may treat the body as markup
+		html.EscapeString(notification.Body),
+		actions,
+		hints,
+		int32(-1),
+	).Store(&notificationID)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if replaces != 0 && replaces != notificationID {
+		delete(n.clicks, replaces)
+	}
+	if notification.Tag != "" {
+		n.tags[notification.Tag] = notificationID
+	}
+	if notification.OnClick != nil {
+		n.clicks[notificationID] = notification.OnClick
+	}
+	return nil
+}
+
+func (n *dbusNotifier) listen(signals <-chan *dbus.Signal) {
+	for sig := range signals {
+		if len(sig.Body) < 2 {
+			continue
+		}
+		notificationID, ok := sig.Body[0].(uint32)
+		if !ok {
+			continue
+		}
+
+		switch sig.Name {
+		case dbusInterface + ".ActionInvoked":
+			action, _ := sig.Body[1].(string)
+			if action != defaultAction {
+				continue
+			}
+			n.mu.Lock()
+			onClick := n.clicks[notificationID]
+			n.mu.Unlock()
+			if onClick != nil {
+				go onClick()
+			}
+		case dbusInterface + ".NotificationClosed":
+			n.forget(notificationID)
+		}
+	}
+}
+
+func (n *dbusNotifier) forget(notificationID uint32) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.clicks, notificationID)
+	for tag, id := range n.tags {
+		if id == notificationID {
+			delete(n.tags, tag)
+		}
+	}
+}
+
+func (n *dbusNotifier) Close() error {
+	return n.conn.Close()
+}
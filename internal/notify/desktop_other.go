@@ -0,0 +1,9 @@
+//go:build !linux || android
+
+package notify
+
+import "log/slog"
+
+func newDesktop(logger *slog.Logger) Notifier {
+	return noopNotifier{}
+}
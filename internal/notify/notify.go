@@ -0,0 +1,59 @@
+// Package notify raises native notifications on the platforms Arko runs on.
+package notify
+
+import (
+	"log/slog"
+
+	"github.com/arko-chat/arko/internal/bridge"
+)
+
+const appName = "Arko"
+
+type Notification struct {
+	// Tag groups notifications, a newer one with the same tag replaces the
+	// previous one where the platform supports it.
+	Tag    string
+	Title  string
+	Body   string
+	Urgent bool
+	// OnClick runs when the user activates the notification.
+	OnClick func()
+}
+
+type Notifier interface {
+	Show(n Notification) error
+	Close() error
+}
+
+// New picks the native bridge when one is registered (mobile) and the
+// desktop implementation otherwise.
+func New(logger *slog.Logger) Notifier {
+	if b := bridge.Get(); b != nil {
+		return &bridgeNotifier{bridge: b}
+	}
+	return newDesktop(logger)
+}
+
+type bridgeNotifier struct {
+	bridge bridge.NativeBridge
+}
+
+// Show hands the notification to the native side, which opens the app on
+// click; the bridge has no way to report back which one was tapped.
+func (n *bridgeNotifier) Show(notification Notification) error {
+	return n.bridge.ShowNotification(notification.Title, notification.Body)
+}
+
+func (n *bridgeNotifier) Close() error {
+	return nil
+}
+
+type noopNotifier struct{}
+
+func (noopNotifier) Show(Notification) error {
+	return nil
+}
+
+func (noopNotifier) Close() error {
+	return nil
+}
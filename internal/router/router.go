@@ -65,14 +65,49 @@ func New(
 		r.Get("/friends/search-users", h.HandleSearchUsers)
 		r.Post("/friends/create-dm", h.HandleCreateDM)
 		r.Get("/dm/{userID}", h.HandleDM)
+		r.Post("/users/{userID}/block", h.HandleBlockUser)
+		r.Post("/users/{userID}/unblock", h.HandleUnblockUser)
+		r.Get("/invites/spaces", h.HandleSpaceInvites)
+		r.Post("/invites/{roomID}/accept", h.HandleAcceptInvite)
+		r.Post("/invites/{roomID}/decline", h.HandleDeclineInvite)
 
 		r.Post("/spaces/create", h.HandleCreateSpace)
 		r.Get("/spaces/{spaceID}", h.HandleSpaces)
 		r.Post("/spaces/{spaceID}/channels/create", h.HandleCreateChannel)
 		r.Get("/spaces/{spaceID}/channels/{channelID}", h.HandleChannels)
+		r.Post("/spaces/{spaceID}/channels/{channelID}/join", h.HandleJoinChannel)
+		r.Post("/spaces/{spaceID}/categories/create", h.HandleCreateCategory)
+		r.Post("/spaces/{spaceID}/categories/{categoryID}/join", h.HandleJoinCategory)
+		r.Get("/spaces/{spaceID}/leave", h.HandleLeaveSpaceForm)
+		r.Post("/spaces/{spaceID}/leave", h.HandleLeaveSpace)
+		r.Get("/directory", h.HandleDirectory)
+		r.Post("/join", h.HandleJoin)
 
+		r.Get("/rooms/{roomID}", h.HandleRoom)
 		r.Get("/rooms/{roomID}/next", h.HandleNextMessages)
+		r.Get("/rooms/{roomID}/newer", h.HandleNewerMessages)
 		r.Post("/rooms/typing", h.HandleTyping)
+		r.Post("/rooms/{roomID}/upload", h.HandleUpload)
+		r.Post("/rooms/{roomID}/sticker", h.HandleSendSticker)
+		r.Get("/rooms/{roomID}/mentions", h.HandleMentionSuggestions)
+		r.Get("/stickers", h.HandleStickerPicker)
+
+		r.Post("/message/{messageID}/react", h.HandleReact)
+		r.Get("/message/{messageID}/edit", h.HandleEditForm)
+		r.Get("/message/{messageID}/content", h.HandleMessageContent)
+		r.Get("/message/{messageID}/history", h.HandleEditHistory)
+		r.Get("/message/{messageID}/delete", h.HandleDeleteConfirm)
+		r.Post("/message/{messageID}/delete", h.HandleDeleteMessage)
+		r.Post("/message/{messageID}/retry", h.HandleRetrySend)
+		r.Post("/message/{messageID}/discard", h.HandleDiscardSend)
+		r.Get("/message/{messageID}/thread", h.HandleThread)
+		r.Get("/message/{messageID}/thread/next", h.HandleNextThreadReplies)
+		r.Get("/message/{messageID}/jump", h.HandleJump)
+		r.Post("/message/{messageID}/pin", h.HandlePin)
+		r.Post("/message/{messageID}/unpin", h.HandleUnpin)
+		r.Get("/pins", h.HandlePinnedMessages)
+		r.Get("/thread/close", h.HandleCloseThread)
+		r.Get("/search", h.HandleSearch)
 
 		r.Get("/api/media", h.HandleProxyMedia)
 		r.Post("/api/theme", h.HandleToggleTheme)
@@ -0,0 +1,261 @@
+package sanitizer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxDepth follows the spec's recommendation for limiting nesting.
+const maxDepth = 100
+
+// allowedTags is the list of tags recommended by the Matrix spec for
+// org.matrix.custom.html, mapped to the attributes each one may keep.
+var allowedTags = map[string][]string{
+	"font":       {"data-mx-bg-color", "data-mx-color", "color"},
+	"del":        nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"blockquote": nil,
+	"p":          nil,
+	"a":          {"name", "target", "href"},
+	"ul":         nil,
+	"ol":         {"start"},
+	"sup":        nil,
+	"sub":        nil,
+	"li":         nil,
+	"b":          nil,
+	"i":          nil,
+	"u":          nil,
+	"strong":     nil,
+	"em":         nil,
+	"s":          nil,
+	"strike":     nil,
+	"code":       {"class"},
+	"hr":         nil,
+	"br":         nil,
+	"div":        nil,
+	"table":      nil,
+	"thead":      nil,
+	"tbody":      nil,
+	"tr":         nil,
+	"th":         nil,
+	"td":         nil,
+	"caption":    nil,
+	"pre":        nil,
+	"span":       {"data-mx-bg-color", "data-mx-color", "data-mx-spoiler"},
+	"img":        {"width", "height", "alt", "title", "src"},
+	"details":    nil,
+	"summary":    nil,
+}
+
+// droppedTags are removed together with everything inside them. mx-reply
+// holds the legacy reply fallback, which is rendered separately.
+var droppedTags = map[string]bool{
+	"mx-reply": true,
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"svg":      true,
+	"math":     true,
+	"title":    true,
+	"textarea": true,
+	"select":   true,
+}
+
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"ftp":    true,
+	"mailto": true,
+	"magnet": true,
+}
+
+var (
+	colorPattern    = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	languagePattern = regexp.MustCompile(`^language-[a-zA-Z0-9+#_-]+$`)
+)
+
+// Sanitize strips everything from an HTML fragment that isn't on the Matrix
+// spec's allow list. Images are only kept when mediaURL can turn their
+// mxc:// source into a URL we serve; pass nil to drop all images.
+func Sanitize(input string, mediaURL func(mxc string) string) string {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(input), context)
+	if err != nil {
+		return html.EscapeString(input)
+	}
+
+	s := &sanitizer{mediaURL: mediaURL}
+	var out strings.Builder
+	for _, n := range nodes {
+		for _, clean := range s.clean(n, 0) {
+			_ = html.Render(&out, clean)
+		}
+	}
+	return out.String()
+}
+
+type sanitizer struct {
+	mediaURL func(string) string
+}
+
+func (s *sanitizer) clean(n *html.Node, depth int) []*html.Node {
+	switch n.Type {
+	case html.TextNode:
+		return []*html.Node{{Type: html.TextNode, Data: n.Data}}
+	case html.ElementNode:
+	default:
+		// comments, doctypes and the like
+		return nil
+	}
+
+	tag := strings.ToLower(n.Data)
+	if droppedTags[tag] || depth >= maxDepth {
+		return nil
+	}
+
+	children := s.cleanChildren(n, depth+1)
+
+	attrs, ok := allowedTags[tag]
+	if !ok {
+		// unknown tags are unwrapped so their text survives
+		return children
+	}
+
+	el := &html.Node{
+		Type: html.ElementNode,
+		Data: tag,
+		Attr: s.cleanAttrs(tag, n.Attr, attrs),
+	}
+
+	if tag == "img" && !hasAttr(el, "src") {
+		return nil
+	}
+
+	for _, c := range children {
+		el.AppendChild(c)
+	}
+	return []*html.Node{el}
+}
+
+func (s *sanitizer) cleanChildren(n *html.Node, depth int) []*html.Node {
+	var children []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		children = append(children, s.clean(c, depth)...)
+	}
+	return children
+}
+
+func (s *sanitizer) cleanAttrs(tag string, in []html.Attribute, allowed []string) []html.Attribute {
+	var (
+		out    []html.Attribute
+		styles []string
+	)
+
+	for _, a := range in {
+		key := strings.ToLower(a.Key)
+		if a.Namespace != "" || !contains(allowed, key) {
+			continue
+		}
+
+		val := strings.TrimSpace(a.Val)
+		switch key {
+		case "href":
+			if !safeURL(val) {
+				continue
+			}
+		case "src":
+			if s.mediaURL == nil || !strings.HasPrefix(val, "mxc://") {
+				continue
+			}
+			val = s.mediaURL(val)
+			if val == "" {
+				continue
+			}
+		case "target":
+			continue
+		case "color", "data-mx-color":
+			if !colorPattern.MatchString(val) {
+				continue
+			}
+			styles = append(styles, "color: "+val)
+			if key == "color" {
+				continue
+			}
+		case "data-mx-bg-color":
+			if !colorPattern.MatchString(val) {
+				continue
+			}
+			styles = append(styles, "background-color: "+val)
+		case "class":
+			if tag != "code" || !languagePattern.MatchString(val) {
+				continue
+			}
+		case "start", "width", "height":
+			if _, err := strconv.ParseUint(val, 10, 32); err != nil {
+				continue
+			}
+		}
+
+		out = append(out, html.Attribute{Key: key, Val: val})
+	}
+
+	if len(styles) > 0 {
+		out = append(out, html.Attribute{Key: "style", Val: strings.Join(styles, "; ")})
+	}
+
+	if tag == "a" && hasAttrIn(out, "href") {
+		out = append(out,
+			html.Attribute{Key: "target", Val: "_blank"},
+			html.Attribute{Key: "rel", Val: "noopener noreferrer nofollow"},
+		)
+	}
+
+	return out
+}
+
+func safeURL(raw string) bool {
+	scheme, _, ok := strings.Cut(raw, ":")
+	if !ok {
+		return false
+	}
+	// a colon after a path separator means there is no scheme at all
+	if strings.ContainsAny(scheme, "/?#") {
+		return false
+	}
+	return allowedSchemes[strings.ToLower(scheme)]
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	return hasAttrIn(n.Attr, key)
+}
+
+func hasAttrIn(attrs []html.Attribute, key string) bool {
+	for _, a := range attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package sanitizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func testMediaURL(mxc string) string {
+	return "/api/media?mxc=" + strings.TrimPrefix(mxc, "mxc://")
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "plain text is escaped",
+			input:    "1 < 2 & 3 > 2",
+			expected: "1 &lt; 2 &amp; 3 &gt; 2",
+		},
+		{
+			name:     "allowed formatting survives",
+			input:    "<p><strong>bold</strong> and <em>italic</em></p>",
+			expected: "<p><strong>bold</strong> and <em>italic</em></p>",
+		},
+		{
+			name:     "script is dropped with its content",
+			input:    "hi<script>alert(1)</script>",
+			expected: "hi",
+		},
+		{
+			name:     "style is dropped with its content",
+			input:    "<style>body{display:none}</style>text",
+			expected: "text",
+		},
+		{
+			name:     "event handlers are stripped",
+			input:    `<b onclick="alert(1)" onmouseover="alert(2)">x</b>`,
+			expected: "<b>x</b>",
+		},
+		{
+			name:     "unknown tags are unwrapped",
+			input:    "<marquee><b>x</b></marquee>",
+			expected: "<b>x</b>",
+		},
+		{
+			name:     "javascript links lose their href",
+			input:    `<a href="javascript:alert(1)">x</a>`,
+			expected: "<a>x</a>",
+		},
+		{
+			name:     "mixed case and entity encoded schemes are rejected",
+			input:    `<a href="JaVaScRiPt&#58;alert(1)">x</a>`,
+			expected: "<a>x</a>",
+		},
+		{
+			name:     "data links are rejected",
+			input:    `<a href="data:text/html;base64,PHNjcmlwdD4=">x</a>`,
+			expected: "<a>x</a>",
+		},
+		{
+			name:     "safe links open in a new tab",
+			input:    `<a href="https://example.com" target="_self">x</a>`,
+			expected: `<a href="https://example.com" target="_blank" rel="noopener noreferrer nofollow">x</a>`,
+		},
+		{
+			name:     "relative links are rejected",
+			input:    `<a href="/logout">x</a>`,
+			expected: "<a>x</a>",
+		},
+		{
+			name:     "http images are dropped",
+			input:    `<img src="https://evil.example/track.png">`,
+			expected: "",
+		},
+		{
+			name:     "mxc images are rewritten",
+			input:    `<img src="mxc://example.com/abc" alt="cat" onerror="alert(1)">`,
+			expected: `<img src="/api/media?mxc=example.com/abc" alt="cat"/>`,
+		},
+		{
+			name:     "style attributes are never passed through",
+			input:    `<span style="position:fixed;top:0">x</span>`,
+			expected: "<span>x</span>",
+		},
+		{
+			name:     "valid colors become styles",
+			input:    `<span data-mx-color="#ff0000" data-mx-bg-color="#00ff00">x</span>`,
+			expected: `<span data-mx-color="#ff0000" data-mx-bg-color="#00ff00" style="color: #ff0000; background-color: #00ff00">x</span>`,
+		},
+		{
+			name:     "invalid colors are dropped",
+			input:    `<font color="red;background:url(x)">x</font>`,
+			expected: "<font>x</font>",
+		},
+		{
+			name:     "only language classes on code",
+			input:    `<code class="language-go">x</code><code class="evil">y</code><p class="language-go">z</p>`,
+			expected: `<code class="language-go">x</code><code>y</code><p>z</p>`,
+		},
+		{
+			name:     "ordered list start must be numeric",
+			input:    `<ol start="3"><li>a</li></ol><ol start="x"><li>b</li></ol>`,
+			expected: `<ol start="3"><li>a</li></ol><ol><li>b</li></ol>`,
+		},
+		{
+			name:     "reply fallback is removed",
+			input:    "<mx-reply><blockquote>quoted</blockquote></mx-reply>answer",
+			expected: "answer",
+		},
+		{
+			name:     "comments are removed",
+			input:    "a<!-- <script>alert(1)</script> -->b",
+			expected: "ab",
+		},
+		{
+			name:     "iframes and svg are removed",
+			input:    `<iframe src="https://evil.example"></iframe><svg onload="alert(1)"><script>alert(2)</script></svg>ok`,
+			expected: "ok",
+		},
+		{
+			name:     "attribute breaking is escaped",
+			input:    `<img src="mxc://example.com/a&quot; onerror=&quot;alert(1)">`,
+			expected: `<img src="/api/media?mxc=example.com/a&#34; onerror=&#34;alert(1)"/>`,
+		},
+		{
+			name:     "xmp content stays text",
+			input:    "<xmp><script>alert(1)</script></xmp>",
+			expected: "&lt;script&gt;alert(1)&lt;/script&gt;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.input, testMediaURL); got != tt.expected {
+				t.Errorf("Sanitize() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSanitize_NoMediaURL(t *testing.T) {
+	got := Sanitize(`<img src="mxc://example.com/abc" alt="cat">`, nil)
+	if got != "" {
+		t.Errorf("Sanitize() = %q, want images dropped", got)
+	}
+}
+
+func TestSanitize_MaxDepth(t *testing.T) {
+	input := strings.Repeat("<div>", maxDepth+50) + "deep" + strings.Repeat("</div>", maxDepth+50)
+
+	got := Sanitize(input, nil)
+	if strings.Count(got, "<div>") > maxDepth {
+		t.Errorf("Sanitize() kept %d nested divs, want at most %d", strings.Count(got, "<div>"), maxDepth)
+	}
+}
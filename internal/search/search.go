@@ -0,0 +1,348 @@
+// Package search is a small full-text index for messages the server can't
+// search, i.e. those in end-to-end encrypted rooms.
+package search
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// BM25 parameters
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+var ErrInvalidKey = errors.New("search: index key must be 32 bytes")
+
+type Document struct {
+	EventID    string
+	RoomID     string
+	SenderID   string
+	SenderName string
+	Body       string
+	Timestamp  time.Time
+}
+
+type Query struct {
+	Text    string
+	RoomIDs []string
+	// Sender is either a full user ID or part of a display name.
+	Sender string
+	After  time.Time
+	Before time.Time
+	Limit  int
+}
+
+type Result struct {
+	Document
+	Score float64
+}
+
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*Document
+	terms    map[string]map[string]int
+	lengths  map[string]int
+	totalLen int
+	dirty    bool
+}
+
+func New() *Index {
+	return &Index{
+		docs:    make(map[string]*Document),
+		terms:   make(map[string]map[string]int),
+		lengths: make(map[string]int),
+	}
+}
+
+// Tokenize lowercases text and splits it on anything that isn't a letter or
+// a digit.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Add indexes doc, replacing any earlier version of the same event.
+func (ix *Index) Add(doc Document) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if existing, ok := ix.docs[doc.EventID]; ok && *existing == doc {
+		return
+	}
+	ix.remove(doc.EventID)
+
+	tokens := Tokenize(doc.Body)
+	if len(tokens) == 0 {
+		return
+	}
+
+	ix.docs[doc.EventID] = &doc
+	ix.lengths[doc.EventID] = len(tokens)
+	ix.totalLen += len(tokens)
+	for _, token := range tokens {
+		postings, ok := ix.terms[token]
+		if !ok {
+			postings = make(map[string]int)
+			ix.terms[token] = postings
+		}
+		postings[doc.EventID]++
+	}
+	ix.dirty = true
+}
+
+func (ix *Index) Remove(eventID string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(eventID)
+}
+
+func (ix *Index) remove(eventID string) {
+	doc, ok := ix.docs[eventID]
+	if !ok {
+		return
+	}
+
+	for _, token := range Tokenize(doc.Body) {
+		postings := ix.terms[token]
+		delete(postings, eventID)
+		if len(postings) == 0 {
+			delete(ix.terms, token)
+		}
+	}
+	ix.totalLen -= ix.lengths[eventID]
+	delete(ix.lengths, eventID)
+	delete(ix.docs, eventID)
+	ix.dirty = true
+}
+
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Dirty reports whether the index changed since it was last saved or loaded.
+func (ix *Index) Dirty() bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.dirty
+}
+
+// Search returns documents containing every term of the query, ranked with
+// BM25. The last term also matches as a prefix so results show up while the
+// user is still typing.
+func (ix *Index) Search(q Query) []Result {
+	terms := Tokenize(q.Text)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	n := float64(len(ix.docs))
+	if n == 0 {
+		return nil
+	}
+	avgLen := float64(ix.totalLen) / n
+
+	var scores map[string]float64
+	for i, term := range terms {
+		matches := ix.postings(term, i == len(terms)-1)
+
+		termScores := make(map[string]float64, len(matches))
+		for token, postings := range matches {
+			df := float64(len(postings))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			for eventID, tf := range postings {
+				length := float64(ix.lengths[eventID])
+				score := idf * (float64(tf) * (k1 + 1)) / (float64(tf) + k1*(1-b+b*length/avgLen))
+				// prefix matches rank below whole words
+				if token != term {
+					score *= 0.5
+				}
+				termScores[eventID] = max(termScores[eventID], score)
+			}
+		}
+
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for eventID, score := range scores {
+			if s, ok := termScores[eventID]; ok {
+				scores[eventID] = score + s
+			} else {
+				delete(scores, eventID)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for eventID, score := range scores {
+		doc := ix.docs[eventID]
+		if !q.matches(doc) {
+			continue
+		}
+		results = append(results, Result{Document: *doc, Score: score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Timestamp.After(results[j].Timestamp)
+	})
+
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results
+}
+
+func (ix *Index) postings(term string, prefix bool) map[string]map[string]int {
+	matches := make(map[string]map[string]int)
+	if postings, ok := ix.terms[term]; ok {
+		matches[term] = postings
+	}
+	if !prefix {
+		return matches
+	}
+	for token, postings := range ix.terms {
+		if token != term && strings.HasPrefix(token, term) {
+			matches[token] = postings
+		}
+	}
+	return matches
+}
+
+func (q Query) matches(doc *Document) bool {
+	if len(q.RoomIDs) > 0 && !contains(q.RoomIDs, doc.RoomID) {
+		return false
+	}
+	if !q.After.IsZero() && doc.Timestamp.Before(q.After) {
+		return false
+	}
+	if !q.Before.IsZero() && !doc.Timestamp.Before(q.Before) {
+		return false
+	}
+	return q.MatchesSender(doc.SenderID, doc.SenderName)
+}
+
+// MatchesSender applies the sender filter to a user, matching full user IDs
+// exactly and anything else against the display name.
+func (q Query) MatchesSender(userID, name string) bool {
+	if q.Sender == "" {
+		return true
+	}
+	if IsUserID(q.Sender) {
+		return userID == q.Sender
+	}
+	sender := strings.ToLower(q.Sender)
+	return strings.Contains(strings.ToLower(name), sender) ||
+		strings.Contains(strings.ToLower(userID), sender)
+}
+
+// IsUserID reports whether s looks like a full Matrix user ID rather than a
+// name.
+func IsUserID(s string) bool {
+	return strings.HasPrefix(s, "@") && strings.Contains(s, ":")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes the index encrypted with AES-GCM under key.
+func (ix *Index) Save(w io.Writer, key []byte) error {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	ix.mu.Lock()
+	docs := make([]Document, 0, len(ix.docs))
+	for _, doc := range ix.docs {
+		docs = append(docs, *doc)
+	}
+	ix.dirty = false
+	ix.mu.Unlock()
+
+	var plain bytes.Buffer
+	if err := gob.NewEncoder(&plain).Encode(docs); err != nil {
+		return fmt.Errorf("encode index: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	_, err = w.Write(gcm.Seal(nonce, nonce, plain.Bytes(), nil))
+	return err
+}
+
+// Load reads an index written by Save.
+func Load(r io.Reader, key []byte) (*Index, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("search: index file is truncated")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt index: %w", err)
+	}
+
+	var docs []Document
+	if err := gob.NewDecoder(bytes.NewReader(plain)).Decode(&docs); err != nil {
+		return nil, fmt.Errorf("decode index: %w", err)
+	}
+
+	ix := New()
+	for _, doc := range docs {
+		ix.Add(doc)
+	}
+	ix.dirty = false
+	return ix, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
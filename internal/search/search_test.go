@@ -0,0 +1,161 @@
+package search
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+var base = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testIndex() *Index {
+	ix := New()
+	for _, doc := range []Document{
+		{EventID: "$1", RoomID: "!a", SenderID: "@alice:example.com", SenderName: "Alice", Body: "Deploy the release tonight", Timestamp: base},
+		{EventID: "$2", RoomID: "!a", SenderID: "@bob:example.com", SenderName: "Bob", Body: "release notes are in the wiki", Timestamp: base.Add(time.Hour)},
+		{EventID: "$3", RoomID: "!b", SenderID: "@alice:example.com", SenderName: "Alice", Body: "release release release", Timestamp: base.Add(2 * time.Hour)},
+		{EventID: "$4", RoomID: "!b", SenderID: "@carol:example.com", SenderName: "Carol", Body: "Lunch? Grüße aus München", Timestamp: base.Add(24 * time.Hour)},
+		{EventID: "$5", RoomID: "!a", SenderID: "@bob:example.com", SenderName: "Bob", Body: "deployment went fine", Timestamp: base.Add(48 * time.Hour)},
+	} {
+		ix.Add(doc)
+	}
+	return ix
+}
+
+func eventIDs(results []Result) []string {
+	ids := make([]string, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.EventID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    Query
+		expected []string
+	}{
+		{
+			name:     "ranked by term frequency and length",
+			query:    Query{Text: "release"},
+			expected: []string{"$3", "$1", "$2"},
+		},
+		{
+			name:     "all terms must match",
+			query:    Query{Text: "release notes"},
+			expected: []string{"$2"},
+		},
+		{
+			name:     "last term matches as prefix",
+			query:    Query{Text: "depl"},
+			expected: []string{"$5", "$1"},
+		},
+		{
+			name:     "case and punctuation are ignored",
+			query:    Query{Text: "LUNCH"},
+			expected: []string{"$4"},
+		},
+		{
+			name:     "unicode words",
+			query:    Query{Text: "münchen"},
+			expected: []string{"$4"},
+		},
+		{
+			name:     "room filter",
+			query:    Query{Text: "release", RoomIDs: []string{"!a"}},
+			expected: []string{"$1", "$2"},
+		},
+		{
+			name:     "sender filter by user ID",
+			query:    Query{Text: "release", Sender: "@alice:example.com"},
+			expected: []string{"$3", "$1"},
+		},
+		{
+			name:     "sender filter by display name",
+			query:    Query{Text: "release", Sender: "bo"},
+			expected: []string{"$2"},
+		},
+		{
+			name:     "date range",
+			query:    Query{Text: "release", After: base.Add(30 * time.Minute), Before: base.Add(2 * time.Hour)},
+			expected: []string{"$2"},
+		},
+		{
+			name:     "limit",
+			query:    Query{Text: "release", Limit: 1},
+			expected: []string{"$3"},
+		},
+		{
+			name:     "empty query",
+			query:    Query{Text: "  ?! "},
+			expected: []string{},
+		},
+	}
+
+	ix := testIndex()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := eventIDs(ix.Search(tt.query))
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Search() = %v, want %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Fatalf("Search() = %v, want %v", got, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestIndex_AddReplacesAndRemove(t *testing.T) {
+	ix := testIndex()
+
+	ix.Add(Document{EventID: "$2", RoomID: "!a", SenderID: "@bob:example.com", Body: "edited text", Timestamp: base})
+	if got := ix.Search(Query{Text: "notes"}); len(got) != 0 {
+		t.Errorf("old body still indexed: %v", eventIDs(got))
+	}
+	if got := ix.Search(Query{Text: "edited"}); len(got) != 1 {
+		t.Errorf("new body not indexed: %v", eventIDs(got))
+	}
+
+	ix.Remove("$3")
+	if got := eventIDs(ix.Search(Query{Text: "release"})); len(got) != 1 || got[0] != "$1" {
+		t.Errorf("Search() after Remove = %v, want [$1]", got)
+	}
+}
+
+func TestIndex_SaveLoad(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	ix := testIndex()
+
+	var buf bytes.Buffer
+	if err := ix.Save(&buf, key); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("release")) {
+		t.Fatal("saved index contains plaintext")
+	}
+	if ix.Dirty() {
+		t.Error("index still dirty after Save")
+	}
+
+	loaded, err := Load(bytes.NewReader(buf.Bytes()), key)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Len() != ix.Len() {
+		t.Errorf("Load() has %d docs, want %d", loaded.Len(), ix.Len())
+	}
+	if got := eventIDs(loaded.Search(Query{Text: "release"})); len(got) != 3 || got[0] != "$3" {
+		t.Errorf("Search() on loaded index = %v", got)
+	}
+
+	if _, err := Load(bytes.NewReader(buf.Bytes()), bytes.Repeat([]byte{8}, 32)); err == nil {
+		t.Error("Load() with wrong key succeeded")
+	}
+	if _, err := Load(bytes.NewReader(buf.Bytes()), []byte("short")); err != ErrInvalidKey {
+		t.Errorf("Load() with short key error = %v, want ErrInvalidKey", err)
+	}
+}
@@ -11,14 +11,21 @@ import (
 	"github.com/arko-chat/arko/components/utils"
 	"github.com/arko-chat/arko/internal/matrix"
 	"github.com/arko-chat/arko/internal/models"
+	"github.com/arko-chat/arko/internal/search"
 	"github.com/arko-chat/arko/internal/ws"
 	"github.com/puzpuzpuz/xsync/v4"
 )
 
+// markReadDelay batches the read receipts for a burst of messages in the
+// room being viewed into one.
+const markReadDelay = 2 * time.Second
+
 type ChatService struct {
 	*BaseService
 	initializedTree *xsync.Map[string, struct{}]
 	typingListeners *xsync.Map[string, <-chan matrix.TypingEvent]
+	unreadListeners *xsync.Map[string, <-chan matrix.UnreadEvent]
+	pendingReads    *xsync.Map[string, *time.Timer]
 	logger          *slog.Logger
 }
 
@@ -31,6 +38,8 @@ func NewChatService(
 		BaseService:     NewBaseService(mgr, hub),
 		initializedTree: xsync.NewMap[string, struct{}](),
 		typingListeners: xsync.NewMap[string, <-chan matrix.TypingEvent](),
+		unreadListeners: xsync.NewMap[string, <-chan matrix.UnreadEvent](),
+		pendingReads:    xsync.NewMap[string, *time.Timer](),
 		logger:          logger,
 	}
 }
@@ -44,6 +53,52 @@ func (s *ChatService) LoadNextMessages(roomID string, limit int) (bool, error) {
 	return hasMore, nil
 }
 
+func (s *ChatService) LoadNewerMessages(roomID string, limit int) (bool, error) {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return false, err
+	}
+	return tree.LoadNewerMessages(s.matrix.GetContext(), limit), nil
+}
+
+// JumpToEvent loads the messages around eventID and returns the ID of the
+// message to scroll to.
+func (s *ChatService) JumpToEvent(roomID, eventID string) (string, error) {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return "", err
+	}
+	return tree.JumpToEvent(s.matrix.GetContext(), eventID, 30)
+}
+
+func (s *ChatService) ReturnToPresent(roomID string) error {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return err
+	}
+	tree.ReturnToPresent(s.matrix.GetContext())
+	return nil
+}
+
+// RoomPath returns the page a room is shown on: its DM, its channel in the
+// first joined space that lists it, or a page of its own.
+func (s *ChatService) RoomPath(roomID string) (string, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return "", err
+	}
+	dmUserID, spaceID := session.RoomParent(roomID)
+	return roomPath(roomID, dmUserID, spaceID), nil
+}
+
+func (s *ChatService) GetRoomMembers(roomID string) ([]models.User, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return nil, err
+	}
+	return session.GetRoomMembers(roomID)
+}
+
 func (s *ChatService) GetRoomMessageTree(roomID string) (*matrix.MessageTree, error) {
 	session, err := s.GetCurrentSession()
 	if err != nil {
@@ -66,8 +121,33 @@ func (s *ChatService) GetRoomMessageTree(roomID string) (*matrix.MessageTree, er
 				neighbors.Prev.Author.ID == msg.Author.ID &&
 				utils.WithinMinutes(neighbors.Prev.Timestamp, msg.Timestamp, 5)
 
+			if mte.ThreadID != "" {
+				if err := renderThreadOOB(s.matrix.GetContext(), &buf, mte); err != nil {
+					s.logger.Error("render thread oob", "err", err)
+					return
+				}
+				if s.hub != nil {
+					s.hub.BroadcastToRoom(roomID, buf.Bytes())
+				}
+				return
+			}
+
+			if mte.EventType == matrix.EvictEvent {
+				if err := s.renderEvictOOB(&buf, roomID, mte); err != nil {
+					s.logger.Error("render evict oob", "err", err)
+					return
+				}
+				if s.hub != nil {
+					s.hub.BroadcastToRoom(roomID, buf.Bytes())
+				}
+				return
+			}
+
 			switch mte.EventType {
 			case matrix.AddEvent:
+				if !msg.IsOwn {
+					s.scheduleMarkRead(roomID)
+				}
 				if neighbors.Next != nil {
 					oobTarget := "beforebegin:#msg-" + neighbors.Next.ID
 					if err := renderInsertOOB(s.matrix.GetContext(), &buf, msg, continued, oobTarget); err != nil {
@@ -128,13 +208,333 @@ func (s *ChatService) GetRoomMessageTree(roomID string) (*matrix.MessageTree, er
 	return messageTree, nil
 }
 
-func (s *ChatService) SendRoomMessage(roomID string, author models.User, content string) error {
+func (s *ChatService) SendRoomMessage(roomID string, author models.User, content string, replyTo string) error {
+	session := s.matrix.GetMatrixSession(author.ID)
+	if session == nil {
+		return fmt.Errorf("missing matrix session")
+	}
+	messageTree := session.GetMessageTree(roomID)
+	return messageTree.SendMessage(content, replyTo)
+}
+
+func (s *ChatService) SendAttachment(roomID, name, mimeType string, data []byte) error {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return err
+	}
+	return tree.SendAttachment(name, mimeType, data)
+}
+
+func (s *ChatService) UploadLimit() (int64, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return 0, err
+	}
+	return session.UploadLimit(), nil
+}
+
+func (s *ChatService) EncryptedMedia(ref string) (*matrix.EncryptedMedia, bool) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return nil, false
+	}
+	return session.EncryptedMedia(ref)
+}
+
+func (s *ChatService) GetStickers(roomID string) ([]models.StickerPack, *models.StickerWidget, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	packs, err := session.StickerPacks()
+	if err != nil {
+		return nil, nil, err
+	}
+	return packs, session.StickerWidget(roomID), nil
+}
+
+func (s *ChatService) SendPackSticker(roomID, packID, stickerID string) error {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return err
+	}
+	return tree.SendPackSticker(packID, stickerID)
+}
+
+func (s *ChatService) SendWidgetSticker(roomID string, content []byte) error {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return err
+	}
+	return tree.SendWidgetSticker(content)
+}
+
+func (s *ChatService) MarkRead(roomID string) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return
+	}
+	if err := session.MarkRead(roomID); err != nil {
+		s.logger.Error("mark read", "roomID", roomID, "err", err)
+	}
+}
+
+// scheduleMarkRead marks a room read shortly after a message arrives in it,
+// if it's still being viewed by then.
+func (s *ChatService) scheduleMarkRead(roomID string) {
+	if s.hub == nil || !s.hub.IsViewing(s.GetCurrentUserID(), roomID) {
+		return
+	}
+
+	s.pendingReads.Compute(roomID, func(timer *time.Timer, loaded bool) (*time.Timer, xsync.ComputeOp) {
+		if loaded {
+			return timer, xsync.CancelOp
+		}
+		return time.AfterFunc(markReadDelay, func() {
+			s.pendingReads.Delete(roomID)
+			if s.hub.IsViewing(s.GetCurrentUserID(), roomID) {
+				s.MarkRead(roomID)
+			}
+		}), xsync.UpdateOp
+	})
+}
+
+func (s *ChatService) SubscribeUnread() {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return
+	}
+	userID := s.GetCurrentUserID()
+
+	s.unreadListeners.Compute(userID, func(ch <-chan matrix.UnreadEvent, loaded bool) (<-chan matrix.UnreadEvent, xsync.ComputeOp) {
+		if loaded {
+			return ch, xsync.CancelOp
+		}
+
+		unreadCh := session.UnreadEvents()
+		go s.listenUnreadEvents(userID, unreadCh)
+		return unreadCh, xsync.UpdateOp
+	})
+}
+
+func (s *ChatService) listenUnreadEvents(userID string, ch <-chan matrix.UnreadEvent) {
+	ctx := s.matrix.GetContext()
+	session, _ := s.GetCurrentSession()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if session != nil {
+				session.CloseUnreadListener(ch)
+			}
+			s.unreadListeners.Delete(userID)
+			return
+		case evt, ok := <-ch:
+			if !ok {
+				s.unreadListeners.Delete(userID)
+				return
+			}
+			s.pushUnreadUpdate(userID, evt)
+		}
+	}
+}
+
+func (s *ChatService) pushUnreadUpdate(userID string, evt matrix.UnreadEvent) {
+	if s.hub == nil {
+		return
+	}
+
+	ctx := s.matrix.GetContext()
+	var buf bytes.Buffer
+	if err := ui.UnreadBadgeOOB(ui.ChannelUnreadID(evt.RoomID), evt.Unread).Render(ctx, &buf); err != nil {
+		s.logger.Error("render unread badge", "err", err)
+		return
+	}
+	if evt.DMUserID != "" {
+		if err := ui.UnreadBadgeOOB(ui.DMUnreadID(evt.DMUserID), evt.DMUnread).Render(ctx, &buf); err != nil {
+			s.logger.Error("render unread badge", "err", err)
+			return
+		}
+	}
+	for _, space := range evt.Spaces {
+		if err := ui.UnreadBadgeOOB(ui.SpaceUnreadID(space.ID), space.Unread).Render(ctx, &buf); err != nil {
+			s.logger.Error("render unread badge", "err", err)
+			return
+		}
+	}
+
+	s.hub.Push(userID, buf.Bytes())
+}
+
+func (s *ChatService) SearchMentions(roomID, query string) ([]models.User, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return nil, err
+	}
+	return session.SearchRoomMembers(roomID, query, 8)
+}
+
+func (s *ChatService) SearchMessages(q search.Query) ([]models.SearchResult, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return nil, err
+	}
+	return session.SearchMessages(q)
+}
+
+func (s *ChatService) ToggleReaction(roomID, messageID, emoji string) (models.Message, error) {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	if err := tree.ToggleReaction(messageID, emoji); err != nil {
+		return models.Message{}, err
+	}
+
+	msg, ok := tree.GetMessage(messageID)
+	if !ok {
+		return models.Message{}, fmt.Errorf("message %s not found", messageID)
+	}
+	return msg, nil
+}
+
+func (s *ChatService) SendThreadMessage(roomID string, author models.User, threadID string, content string) error {
+	session := s.matrix.GetMatrixSession(author.ID)
+	if session == nil {
+		return fmt.Errorf("missing matrix session")
+	}
+	messageTree := session.GetMessageTree(roomID)
+	return messageTree.SendThreadMessage(threadID, content)
+}
+
+func (s *ChatService) EditMessage(roomID string, author models.User, messageID string, content string) error {
 	session := s.matrix.GetMatrixSession(author.ID)
 	if session == nil {
 		return fmt.Errorf("missing matrix session")
 	}
 	messageTree := session.GetMessageTree(roomID)
-	return messageTree.SendMessage(content)
+	return messageTree.EditMessage(messageID, content)
+}
+
+func (s *ChatService) RedactMessage(roomID, messageID, reason string) error {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return err
+	}
+	return tree.RedactMessage(messageID, reason)
+}
+
+func (s *ChatService) RetrySend(roomID, messageID string) error {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return err
+	}
+	return tree.RetrySend(messageID)
+}
+
+func (s *ChatService) DiscardSend(roomID, messageID string) error {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return err
+	}
+	return tree.DiscardSend(messageID)
+}
+
+func (s *ChatService) PinnedMessages(roomID string) ([]models.Message, error) {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return nil, err
+	}
+	return tree.PinnedMessages(s.matrix.GetContext()), nil
+}
+
+func (s *ChatService) SetPinned(roomID, eventID string, pinned bool) error {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return err
+	}
+	return tree.SetPinned(eventID, pinned)
+}
+
+func (s *ChatService) GetMessage(roomID, messageID string) (models.Message, error) {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	msg, ok := tree.GetMessage(messageID)
+	if !ok {
+		return models.Message{}, fmt.Errorf("message %s not found", messageID)
+	}
+	return msg, nil
+}
+
+func (s *ChatService) GetEditHistory(roomID, messageID string) ([]models.MessageEdit, error) {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return nil, err
+	}
+	return tree.EditHistory(messageID)
+}
+
+func (s *ChatService) GetThread(roomID, rootID string) (*matrix.Thread, models.Message, error) {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return nil, models.Message{}, err
+	}
+	return tree.GetThread(s.matrix.GetContext(), rootID)
+}
+
+func (s *ChatService) LoadNextThreadReplies(roomID, rootID string, limit int) ([]models.Message, bool, error) {
+	tree, err := s.GetRoomMessageTree(roomID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	thread, _, err := tree.GetThread(s.matrix.GetContext(), rootID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	replies, err := tree.LoadThreadReplies(s.matrix.GetContext(), thread, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	return replies, thread.HasMore(), nil
+}
+
+func renderThreadOOB(
+	ctx context.Context,
+	buf *bytes.Buffer,
+	mte matrix.MessageTreeEvent,
+) error {
+	if mte.EventType == matrix.RemoveEvent {
+		_, err := fmt.Fprintf(buf, `<div id="msg-%s" hx-swap-oob="delete"></div>`, mte.Message.ID)
+		return err
+	}
+
+	var inner bytes.Buffer
+	if err := ui.MessageBubble(mte.Message).Render(ctx, &inner); err != nil {
+		return fmt.Errorf("render thread message oob: %w", err)
+	}
+
+	oobTarget := "beforeend:#thread-replies-" + mte.ThreadID
+	switch {
+	case mte.EventType == matrix.UpdateEvent && mte.UpdateNonce != "":
+		oobTarget = "outerHTML:#msg-" + mte.UpdateNonce
+	case mte.EventType == matrix.UpdateEvent:
+		oobTarget = "outerHTML:#msg-" + mte.Message.ID
+	}
+
+	_, err := fmt.Fprintf(
+		buf,
+		`<div hx-swap-oob="%s">%s</div>`,
+		oobTarget,
+		inner.String(),
+	)
+	return err
 }
 
 func renderInsertOOB(
@@ -163,6 +563,35 @@ func renderInsertOOB(
 	return err
 }
 
+// renderEvictOOB removes messages that scrolled out of the window and puts
+// back the sensor that loads them again.
+func (s *ChatService) renderEvictOOB(buf *bytes.Buffer, roomID string, mte matrix.MessageTreeEvent) error {
+	ctx := s.matrix.GetContext()
+
+	for _, msg := range mte.Evicted {
+		if _, err := fmt.Fprintf(buf, `<div id="msg-%s" hx-swap-oob="delete"></div>`, msg.ID); err != nil {
+			return err
+		}
+	}
+
+	if mte.Newer {
+		path, err := s.RoomPath(roomID)
+		if err != nil {
+			return err
+		}
+		if err := ui.NewerMessageSlotOOB(roomID).Render(ctx, buf); err != nil {
+			return err
+		}
+		return ui.JumpToPresentOOB(path).Render(ctx, buf)
+	}
+
+	// the new first message can't continue a group that's no longer shown
+	if err := ui.MessageBubbleOOB(mte.Message, false, "outerHTML").Render(ctx, buf); err != nil {
+		return err
+	}
+	return ui.MoreMessageScrollSensorOOB(roomID).Render(ctx, buf)
+}
+
 func (s *ChatService) checkRegrouping(
 	msg models.Message,
 	n matrix.Neighbors,
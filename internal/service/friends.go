@@ -1,24 +1,33 @@
 package service
 
 import (
+	"bytes"
 	"fmt"
+	"log/slog"
 	"strings"
 
+	"github.com/arko-chat/arko/components/ui"
 	"github.com/arko-chat/arko/internal/matrix"
 	"github.com/arko-chat/arko/internal/models"
 	"github.com/arko-chat/arko/internal/ws"
+	"github.com/puzpuzpuz/xsync/v4"
 )
 
 type FriendsService struct {
 	*BaseService
+	inviteListeners *xsync.Map[string, <-chan matrix.InviteEvent]
+	logger          *slog.Logger
 }
 
 func NewFriendsService(
 	mgr matrix.ManagerClient,
 	hub *ws.Hub,
+	logger *slog.Logger,
 ) *FriendsService {
 	return &FriendsService{
-		BaseService: NewBaseService(mgr, hub),
+		BaseService:     NewBaseService(mgr, hub),
+		inviteListeners: xsync.NewMap[string, <-chan matrix.InviteEvent](),
+		logger:          logger,
 	}
 }
 
@@ -43,6 +52,20 @@ func (s *FriendsService) FilterFriends(filter string) ([]models.User, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	switch filter {
+	case "pending":
+		var out []models.User
+		for _, invite := range session.ListInvites() {
+			if invite.IsDirect {
+				out = append(out, invite.Inviter)
+			}
+		}
+		return out, nil
+	case "blocked":
+		return session.IgnoredUsers(), nil
+	}
+
 	all, err := session.ListDirectMessages()
 	if err != nil {
 		return nil, err
@@ -59,7 +82,6 @@ func (s *FriendsService) FilterFriends(filter string) ([]models.User, error) {
 			if f.Status == models.StatusOnline {
 				out = append(out, f)
 			}
-		case "pending", "blocked":
 		default:
 			out = append(out, f)
 		}
@@ -110,3 +132,99 @@ func (s *FriendsService) CreateDM(otherUserID string) (models.User, string, erro
 	}
 	return session.CreateDMRoom(otherUserID)
 }
+
+func (s *FriendsService) BlockUser(userID string) error {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return err
+	}
+	return session.SetUserIgnored(userID, true)
+}
+
+func (s *FriendsService) UnblockUser(userID string) error {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return err
+	}
+	return session.SetUserIgnored(userID, false)
+}
+
+func (s *FriendsService) ListInvites() ([]models.Invite, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return nil, err
+	}
+	return session.ListInvites(), nil
+}
+
+func (s *FriendsService) AcceptInvite(roomID string) (models.Invite, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return models.Invite{}, err
+	}
+	return session.AcceptInvite(roomID)
+}
+
+func (s *FriendsService) DeclineInvite(roomID string) error {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return err
+	}
+	return session.DeclineInvite(roomID)
+}
+
+func (s *FriendsService) SubscribeInvites() {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return
+	}
+	userID := s.GetCurrentUserID()
+
+	s.inviteListeners.Compute(userID, func(ch <-chan matrix.InviteEvent, loaded bool) (<-chan matrix.InviteEvent, xsync.ComputeOp) {
+		if loaded {
+			return ch, xsync.CancelOp
+		}
+
+		inviteCh := session.InviteEvents()
+		go s.listenInviteEvents(userID, session, inviteCh)
+		return inviteCh, xsync.UpdateOp
+	})
+}
+
+func (s *FriendsService) listenInviteEvents(userID string, session matrix.SessionClient, ch <-chan matrix.InviteEvent) {
+	ctx := s.matrix.GetContext()
+
+	for {
+		select {
+		case <-ctx.Done():
+			session.CloseInviteListener(ch)
+			s.inviteListeners.Delete(userID)
+			return
+		case evt, ok := <-ch:
+			if !ok {
+				s.inviteListeners.Delete(userID)
+				return
+			}
+			s.pushInvites(userID, evt)
+		}
+	}
+}
+
+func (s *FriendsService) pushInvites(userID string, evt matrix.InviteEvent) {
+	if s.hub == nil {
+		return
+	}
+
+	ctx := s.matrix.GetContext()
+	var buf bytes.Buffer
+	if err := ui.PendingInvitesOOB(evt.Invites).Render(ctx, &buf); err != nil {
+		s.logger.Error("render pending invites", "err", err)
+		return
+	}
+	if err := ui.SpaceInvitesOOB(evt.Invites).Render(ctx, &buf); err != nil {
+		s.logger.Error("render space invites", "err", err)
+		return
+	}
+
+	s.hub.Push(userID, buf.Bytes())
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/arko-chat/arko/internal/matrix"
+	"github.com/arko-chat/arko/internal/notify"
+	"github.com/arko-chat/arko/internal/ws"
+	"github.com/puzpuzpuz/xsync/v4"
+)
+
+type NotificationService struct {
+	*BaseService
+	notifier  notify.Notifier
+	focus     func()
+	listeners *xsync.Map[string, <-chan matrix.NotificationEvent]
+	logger    *slog.Logger
+}
+
+func NewNotificationService(
+	mgr matrix.ManagerClient,
+	hub *ws.Hub,
+	notifier notify.Notifier,
+	focus func(),
+	logger *slog.Logger,
+) *NotificationService {
+	return &NotificationService{
+		BaseService: NewBaseService(mgr, hub),
+		notifier:    notifier,
+		focus:       focus,
+		listeners:   xsync.NewMap[string, <-chan matrix.NotificationEvent](),
+		logger:      logger,
+	}
+}
+
+func (s *NotificationService) Subscribe() {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return
+	}
+	userID := s.GetCurrentUserID()
+
+	s.listeners.Compute(userID, func(ch <-chan matrix.NotificationEvent, loaded bool) (<-chan matrix.NotificationEvent, xsync.ComputeOp) {
+		if loaded {
+			return ch, xsync.CancelOp
+		}
+
+		notificationCh := session.NotificationEvents()
+		go s.listen(userID, session, notificationCh)
+		return notificationCh, xsync.UpdateOp
+	})
+}
+
+func (s *NotificationService) listen(userID string, session matrix.SessionClient, ch <-chan matrix.NotificationEvent) {
+	ctx := s.matrix.GetContext()
+
+	for {
+		select {
+		case <-ctx.Done():
+			session.CloseNotificationListener(ch)
+			s.listeners.Delete(userID)
+			return
+		case evt, ok := <-ch:
+			if !ok {
+				s.listeners.Delete(userID)
+				return
+			}
+			s.show(userID, evt)
+		}
+	}
+}
+
+func (s *NotificationService) show(userID string, evt matrix.NotificationEvent) {
+	// the user is already looking at it
+	if s.hub != nil && s.hub.IsViewing(userID, evt.RoomID) {
+		return
+	}
+
+	path := roomPath(evt.RoomID, evt.DMUserID, evt.SpaceID)
+	err := s.notifier.Show(notify.Notification{
+		Tag:    evt.RoomID,
+		Title:  notificationTitle(evt),
+		Body:   evt.Body,
+		Urgent: evt.Highlight,
+		OnClick: func() {
+			if s.focus != nil {
+				s.focus()
+			}
+			if s.hub != nil {
+				s.hub.Push(userID, ws.RedirectMessage(path))
+			}
+		},
+	})
+	if err != nil {
+		s.logger.Error("show notification", "roomID", evt.RoomID, "err", err)
+	}
+}
+
+func notificationTitle(evt matrix.NotificationEvent) string {
+	if evt.DMUserID != "" || evt.RoomName == "" {
+		return evt.Sender.Name
+	}
+	return fmt.Sprintf("%s (#%s)", evt.Sender.Name, evt.RoomName)
+}
+
+func roomPath(roomID, dmUserID, spaceID string) string {
+	switch {
+	case dmUserID != "":
+		return "/dm/" + dmUserID
+	case spaceID != "":
+		return "/spaces/" + spaceID + "/channels/" + roomID
+	}
+	return "/rooms/" + roomID
+}
@@ -55,15 +55,72 @@ func (s *SpaceService) CreateSpace(name, topic string, public bool) (models.Spac
 	})
 }
 
-func (s *SpaceService) CreateChannel(spaceID, name, topic string, public bool) (models.Channel, error) {
+func (s *SpaceService) CreateChannel(spaceID, categoryID, name, topic string, public bool) (models.Channel, error) {
 	session, err := s.GetCurrentSession()
 	if err != nil {
 		return models.Channel{}, err
 	}
 	return session.CreateChannel(matrix.CreateChannelParams{
+		Name:       name,
+		Topic:      topic,
+		SpaceID:    spaceID,
+		CategoryID: categoryID,
+		Public:     public,
+	})
+}
+
+func (s *SpaceService) CreateCategory(spaceID, name string, public bool) (models.Category, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return models.Category{}, err
+	}
+	return session.CreateCategory(matrix.CreateCategoryParams{
 		Name:    name,
-		Topic:   topic,
 		SpaceID: spaceID,
 		Public:  public,
 	})
 }
+
+func (s *SpaceService) JoinSpaceChild(parentID, childID string) error {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return err
+	}
+	return session.JoinSpaceChild(parentID, childID)
+}
+
+func (s *SpaceService) LeaveSpacePreview(spaceID string) (models.LeaveSpacePreview, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return models.LeaveSpacePreview{}, err
+	}
+	return session.LeaveSpacePreview(spaceID)
+}
+
+func (s *SpaceService) LeaveSpace(spaceID string, leaveChildren, forget bool) error {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return err
+	}
+	return session.LeaveSpace(matrix.LeaveSpaceParams{
+		SpaceID:       spaceID,
+		LeaveChildren: leaveChildren,
+		Forget:        forget,
+	})
+}
+
+func (s *SpaceService) SearchDirectory(server, query, since string) (models.DirectoryPage, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return models.DirectoryPage{}, err
+	}
+	return session.SearchDirectory(server, query, since)
+}
+
+func (s *SpaceService) JoinRoom(input string, via []string) (string, bool, error) {
+	session, err := s.GetCurrentSession()
+	if err != nil {
+		return "", false, err
+	}
+	return session.JoinRoom(input, via)
+}
@@ -98,6 +98,15 @@ func (s *WebViewService) SetTitle(title string) {
 	}
 }
 
+func (s *WebViewService) Focus() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mainWindow != nil {
+		webview.Focus(s.mainWindow)
+	}
+}
+
 func (s *WebViewService) OpenChildWindow(id, title, url string, width, height int) {
 	if _, exists := s.childWindows.Load(id); exists {
 		return
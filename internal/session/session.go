@@ -37,6 +37,7 @@ type Session struct {
 	AccessToken    string `json:"access_token"`
 	RefreshToken   string `json:"refresh_token"`
 	PickleKey      []byte `json:"pickle_key"`
+	SearchKey      []byte `json:"search_key,omitempty"`
 	RecoveryKey    string `json:"recovery_key,omitempty"`
 	Theme          string `json:"theme"`
 	SidebarOpen    bool   `json:"sidebar_open"`
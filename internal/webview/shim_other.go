@@ -34,3 +34,10 @@ func New(debug bool) WebView {
 func NewWindow(debug bool, window unsafe.Pointer) WebView {
 	return webview.NewWindow(debug, window)
 }
+
+// Focus brings the window of w to the front.
+func Focus(w WebView) {
+	w.Dispatch(func() {
+		webview.Present(w)
+	})
+}
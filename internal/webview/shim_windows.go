@@ -4,6 +4,7 @@
 package webview
 
 import (
+	"syscall"
 	"unsafe"
 
 	"github.com/jchv/go-webview2"
@@ -27,6 +28,15 @@ const (
 	HintMax
 )
 
+const swRestore = 9
+
+var (
+	user32                  = syscall.NewLazyDLL("user32.dll")
+	procIsIconic            = user32.NewProc("IsIconic")
+	procShowWindow          = user32.NewProc("ShowWindow")
+	procSetForegroundWindow = user32.NewProc("SetForegroundWindow")
+)
+
 // New creates a new webview in a new window.
 func New(debug bool) WebView {
 	return webview2.New(debug)
@@ -39,3 +49,14 @@ func NewWindow(debug bool, window unsafe.Pointer) WebView {
 		Window: window,
 	})
 }
+
+// Focus brings the window of w to the front, restoring it if minimized.
+func Focus(w WebView) {
+	w.Dispatch(func() {
+		hwnd := uintptr(w.Window())
+		if minimized, _, _ := procIsIconic.Call(hwnd); minimized != 0 {
+			procShowWindow.Call(hwnd, swRestore)
+		}
+		procSetForegroundWindow.Call(hwnd)
+	})
+}
@@ -1,5 +1,12 @@
 #include "webview.h"
 
+#if defined(__APPLE__)
+#include <objc/message.h>
+#include <objc/runtime.h>
+#else
+#include <gtk/gtk.h>
+#endif
+
 #include <dlfcn.h>
 #include <signal.h>
 #include <stdint.h>
@@ -37,6 +44,19 @@ void CgoWebViewUnbind(webview_t w, const char *name) {
   webview_unbind(w, name);
 }
 
+void CgoWebViewPresent(void *window) {
+#if defined(__APPLE__)
+  id app = ((id(*)(id, SEL))objc_msgSend)((id)objc_getClass("NSApplication"),
+                                          sel_registerName("sharedApplication"));
+  ((void (*)(id, SEL, BOOL))objc_msgSend)(
+      app, sel_registerName("activateIgnoringOtherApps:"), YES);
+  ((void (*)(id, SEL, id))objc_msgSend)(
+      (id)window, sel_registerName("makeKeyAndOrderFront:"), NULL);
+#else
+  gtk_window_present(GTK_WINDOW(window));
+#endif
+}
+
 typedef int (*sigaction_fn)(int, const struct sigaction *, struct sigaction *);
 
 int sigaction(int signum, const struct sigaction *act,
@@ -30,6 +30,7 @@ static void setup_alt_stack() {
 void CgoWebViewDispatch(webview_t w, uintptr_t arg);
 void CgoWebViewBind(webview_t w, const char *name, uintptr_t index);
 void CgoWebViewUnbind(webview_t w, const char *name);
+void CgoWebViewPresent(void *window);
 */
 import "C"
 import (
@@ -179,6 +180,12 @@ func (w *webview) Window() unsafe.Pointer {
 	return C.webview_get_window(w.w)
 }
 
+// Present raises the native window of w above other windows and gives it
+// focus. Must be called from the UI thread.
+func Present(w WebView) {
+	C.CgoWebViewPresent(w.Window())
+}
+
 func (w *webview) Navigate(url string) {
 	s := C.CString(url)
 	defer C.free(unsafe.Pointer(s))
@@ -21,9 +21,12 @@ type Client struct {
 }
 
 type ClientRequest struct {
-	Action  string `json:"action"`
-	RoomID  string `json:"roomID"`
-	Message string `json:"message"`
+	Action    string `json:"action"`
+	RoomID    string `json:"roomID"`
+	ThreadID  string `json:"threadID"`
+	MessageID string `json:"messageID"`
+	ReplyTo   string `json:"replyTo"`
+	Message   string `json:"message"`
 }
 
 func NewClient(hub *Hub, conn *websocket.Conn, userID string) *Client {
@@ -69,3 +69,15 @@ func (h *Hub) BroadcastToRoom(roomID string, data []byte) {
 		}
 	}
 }
+
+func (h *Hub) IsViewing(userID, roomID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for c := range h.clients[userID] {
+		if c.GetActiveRoom() == roomID {
+			return true
+		}
+	}
+	return false
+}
@@ -30,6 +30,7 @@ type ContentProps struct {
 	Tree        *matrix.MessageTree
 	RoomID      string
 	TypingUsers []string
+	FocusID     string
 }
 
 func Page(props PageProps) templ.Component {
@@ -129,6 +130,10 @@ func Content(props ContentProps) templ.Component {
 			Placeholder:       "Message " + props.Friend.Name,
 			Messages:          props.Tree.Chronological(),
 			CurrentUserID:     props.User.ID,
+			LastReadID:        props.Tree.LastReadID(),
+			FocusID:           props.FocusID,
+			HasNewer:          props.Tree.HasNewer(),
+			PresentURL:        "/dm/" + props.Friend.ID,
 			CurrentUserName:   props.User.Name,
 			CurrentUserAvatar: props.User.Avatar,
 			WelcomeUser:       &props.Friend,
@@ -137,7 +142,7 @@ func Content(props ContentProps) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</div></div></main>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<div id=\"thread-panel\" class=\"w-[360px] shrink-0 h-full empty:hidden\"></div></div></div></main>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
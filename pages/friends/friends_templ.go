@@ -106,7 +106,7 @@ func Content(props ContentProps) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = friends.View("online").Render(ctx, templ_7745c5c3_Buffer)
+		templ_7745c5c3_Err = friends.View("online", nil, nil).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
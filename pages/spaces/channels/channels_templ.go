@@ -32,6 +32,7 @@ type ContentProps struct {
 	Tree        *matrix.MessageTree
 	RoomID      string
 	TypingUsers []string
+	FocusID     string
 }
 
 func Page(props PageProps) templ.Component {
@@ -138,6 +139,10 @@ func Content(props ContentProps) templ.Component {
 			Placeholder:       "Message #" + props.Channel.Name,
 			Messages:          props.Tree.Chronological(),
 			CurrentUserID:     props.User.ID,
+			LastReadID:        props.Tree.LastReadID(),
+			FocusID:           props.FocusID,
+			HasNewer:          props.Tree.HasNewer(),
+			PresentURL:        "/spaces/" + props.SpaceDetail.ID + "/channels/" + props.Channel.ID,
 			CurrentUserName:   props.User.Name,
 			CurrentUserAvatar: props.User.Avatar,
 			ChannelName:       props.Channel.Name,
@@ -147,7 +152,7 @@ func Content(props ContentProps) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</div><div id=\"thread-panel\" class=\"w-[360px] shrink-0 h-full empty:hidden\"></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}